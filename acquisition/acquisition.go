@@ -0,0 +1,141 @@
+// Package acquisition supervises the goroutines of a run of an experiment.
+//
+// The readers of the sensors put their records in a record.Pipeline, whose
+// single writer hands them to the sinks. Stop cancels the context of the
+// readers, waits for all of them to return, lets the pipeline drain the
+// records still buffered and reports what was written: when it returns
+// nothing else is written for the run.
+package acquisition
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// Reader reads a sensor, putting its records, until ctx is cancelled. It
+// must return soon after the cancellation, and must not put afterwards;
+// the error of a failed reader is reported by Stop.
+type Reader func(ctx context.Context, put func(record.Record)) error
+
+// Report what happened in a run, once all its goroutines ended
+type Report struct {
+	// Readers started
+	Readers int
+	// Records written
+	Records uint64
+	// Pipeline accounting of the buffer of the records
+	Pipeline record.Stats
+	// Errors of the readers and of the sinks
+	Errors []error
+	// Duration of the run
+	Duration time.Duration
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("readers=%d records=%d dropped=%d highWater=%d/%d errors=%d duration=%v",
+		r.Readers, r.Records, r.Pipeline.Dropped, r.Pipeline.HighWater, r.Pipeline.Capacity,
+		len(r.Errors), r.Duration)
+}
+
+// Supervisor the readers and the pipeline of a run
+type Supervisor struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	pipeline *record.Pipeline
+	readers  sync.WaitGroup
+	stop     sync.Once
+
+	mutex  sync.Mutex
+	report Report
+	start  time.Time
+}
+
+// New supervises a run writing to the pipeline; the readers are started
+// with Go
+func New(parent context.Context, pipeline *record.Pipeline) *Supervisor {
+	ctx, cancel := context.WithCancel(parent)
+	return &Supervisor{
+		ctx:      ctx,
+		cancel:   cancel,
+		pipeline: pipeline,
+		start:    time.Now(),
+	}
+}
+
+func (s *Supervisor) fail(err error) {
+	log.Println("acquisition:", err)
+	s.mutex.Lock()
+	s.report.Errors = append(s.report.Errors, err)
+	s.mutex.Unlock()
+}
+
+func (s *Supervisor) put(r record.Record) {
+	s.pipeline.Put(r)
+}
+
+// Go starts the reader called name; it must not be called after Stop
+func (s *Supervisor) Go(name string, reader Reader) {
+	s.mutex.Lock()
+	s.report.Readers++
+	s.mutex.Unlock()
+	s.readers.Add(1)
+	go func() {
+		defer s.readers.Done()
+		if err := reader(s.ctx, s.put); err != nil {
+			s.fail(fmt.Errorf("%s: %v", name, err))
+		}
+	}()
+}
+
+// Stats of the pipeline while running
+func (s *Supervisor) Stats() record.Stats {
+	return s.pipeline.Stats()
+}
+
+// Stop cancels the readers and waits until all of them returned and all
+// their records were written
+func (s *Supervisor) Stop() Report {
+	s.stop.Do(func() {
+		s.cancel()
+		s.readers.Wait()
+		stats, err := s.pipeline.Close()
+		if err != nil {
+			s.fail(fmt.Errorf("writer: %v", err))
+		}
+		s.mutex.Lock()
+		s.report.Pipeline = stats
+		s.report.Records = stats.Written
+		s.report.Duration = time.Since(s.start)
+		s.mutex.Unlock()
+	})
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report := s.report
+	report.Errors = append([]error(nil), s.report.Errors...)
+	return report
+}
+
+// OnCancel calls f if ctx is cancelled before the returned release is
+// called; it unblocks the readers waiting for their sensors. Once release
+// returns, f has been called or will never be.
+func OnCancel(ctx context.Context, f func()) (release func()) {
+	done := make(chan struct{})
+	ended := make(chan struct{})
+	go func() {
+		defer close(ended)
+		select {
+		case <-ctx.Done():
+			f()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-ended
+	}
+}
@@ -0,0 +1,307 @@
+// Package api serves the JSON API of the platform under Prefix: the same
+// workflow of the web pages, for scripts and apps.
+//
+//	GET      state          the state, configuration, run and link quality
+//	GET      config         the configuration
+//	PUT/POST config         configures the platform
+//	POST     run            begins a run, 201 with the run
+//	POST     stop           stops it, when its data are written
+//	GET      runs?q=&area=  the runs of the catalog
+//	GET      runs/cart/2    a run, and runs/cart/2/data its data file
+//	GET      live           the records of the run, as they come
+//
+// The Handler only speaks JSON; the Platform behind it keeps the state of
+// the platform, and must guard it, as the requests come concurrently with
+// the ones of the web pages.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/catalog"
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/experiment"
+	"github.com/ecalman/OSHIWASP/kinematics"
+	"github.com/ecalman/OSHIWASP/state"
+)
+
+// Prefix root of the API, with its version
+const Prefix = "/api/v1/"
+
+// Platform what the API drives
+type Platform interface {
+	// State of the platform now
+	State() State
+	// Config the current configuration
+	Config() Config
+	// Configure sets the configuration, returning the one set; the error is
+	// a *ConfigError or an *experiment.NameError if it is wrong
+	Configure(config Config) (Config, error)
+	// Start begins a new run of the configuration; the error is a
+	// *state.Error if the platform can't run now
+	Start() (catalog.Entry, error)
+	// Stop stops the run once its records are written
+	Stop() (catalog.Entry, error)
+	// Runs the runs of the catalog in the area matching the search
+	Runs(area experiment.Area, query string) []catalog.Entry
+	// Run the entry of the run and the area where it is kept, false if
+	// there's no such run
+	Run(run experiment.Run) (catalog.Entry, experiment.Area, bool)
+	// ServeData sends the data file of the run of the area
+	ServeData(w http.ResponseWriter, req *http.Request, area experiment.Area, run experiment.Run)
+}
+
+// State the state of the platform
+type State struct {
+	State         string `json:"state"`
+	Configuration string `json:"configuration,omitempty"`
+	// Run being acquired, or the last one, and when it began
+	Run   string     `json:"run,omitempty"`
+	Start *time.Time `json:"start,omitempty"`
+	// Link quality of the link and Suppressed edges dropped by the filters
+	// in the run
+	Link       *datafile.LinkQuality `json:"link,omitempty"`
+	Suppressed map[string]uint64     `json:"suppressed,omitempty"`
+	// History last changes of state, the oldest first
+	History []Transition `json:"history"`
+}
+
+// Transition a change of state
+type Transition struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// acquiring true if the run is being acquired, so its data file is not
+// complete
+func (s State) acquiring(run string) bool {
+	if s.Run != run {
+		return false
+	}
+	switch s.State {
+	case state.Starting.String(), state.Running.String(), state.Stopping.String():
+		return true
+	}
+	return false
+}
+
+// Config the configuration: the sensors, named as in the data file, and the
+// filters of the trackers A, B, C and D in ms, the defaults if they are
+// missing
+type Config struct {
+	Name        string             `json:"name"`
+	Sensors     map[string]bool    `json:"sensors"`
+	Debounce    map[string]float64 `json:"debounce"`
+	MinInterval map[string]float64 `json:"minInterval"`
+	// Photogates the setup of the trackers A to D, the current one if it
+	// is missing
+	Photogates *kinematics.Setup `json:"photogates,omitempty"`
+}
+
+// ConfigError a configuration the platform can't take, as an unknown
+// sensor or a negative filter
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Error the body of the errors, with the state of the platform
+type Error struct {
+	Error string `json:"error"`
+	State string `json:"state"`
+}
+
+// Handler serves the API of the platform
+type Handler struct {
+	Platform Platform
+	// Live streams the records of the runs; nil if not served
+	Live http.Handler
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	resource := strings.TrimPrefix(req.URL.Path, Prefix)
+	switch {
+	case resource == "state":
+		h.state(w, req)
+	case resource == "config":
+		h.config(w, req)
+	case resource == "run":
+		h.run(w, req)
+	case resource == "stop":
+		h.stop(w, req)
+	case resource == "runs" || strings.HasPrefix(resource, "runs/"):
+		h.runs(w, req, strings.Trim(strings.TrimPrefix(resource, "runs"), "/"))
+	case resource == "live" && h.Live != nil:
+		if h.method(w, req, "GET") {
+			h.Live.ServeHTTP(w, req)
+		}
+	default:
+		h.notFound(w, req)
+	}
+}
+
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// fail writes the error with its status: 409 Conflict if the platform can't
+// do it in its state, 422 if the configuration is wrong, 500 otherwise
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err.(type) {
+	case *state.Error:
+		status = http.StatusConflict
+	case *experiment.NameError, *ConfigError:
+		status = http.StatusUnprocessableEntity
+	}
+	log.Println(err)
+	h.failStatus(w, status, err.Error())
+}
+
+func (h *Handler) failStatus(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, Error{Error: message, State: h.Platform.State().State})
+}
+
+// method false, after the 405 response, if the request hasn't the method
+func (h *Handler) method(w http.ResponseWriter, req *http.Request, method string) bool {
+	if req.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	h.failStatus(w, http.StatusMethodNotAllowed, req.Method+" not allowed, only "+method)
+	return false
+}
+
+// notFound the resources that don't exist
+func (h *Handler) notFound(w http.ResponseWriter, req *http.Request) {
+	h.failStatus(w, http.StatusNotFound, "no such resource: "+req.URL.Path)
+}
+
+// state of the platform, GET
+func (h *Handler) state(w http.ResponseWriter, req *http.Request) {
+	if h.method(w, req, "GET") {
+		writeJSON(w, http.StatusOK, h.Platform.State())
+	}
+}
+
+// config the configuration, GET, or sets a new one, PUT or POST
+func (h *Handler) config(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, h.Platform.Config())
+	case "PUT", "POST":
+		var config Config
+		decoder := json.NewDecoder(req.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			h.failStatus(w, http.StatusBadRequest, "bad configuration: "+err.Error())
+			return
+		}
+		config, err := h.Platform.Configure(config)
+		if err != nil {
+			h.fail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, config)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		h.failStatus(w, http.StatusMethodNotAllowed, req.Method+" not allowed")
+	}
+}
+
+// run begins a new run of the configuration, POST; 201 Created with the run
+func (h *Handler) run(w http.ResponseWriter, req *http.Request) {
+	if !h.method(w, req, "POST") {
+		return
+	}
+	entry, err := h.Platform.Start()
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.Header().Set("Location", Prefix+"runs/"+entry.ID)
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// stop stops the run, POST, when all its records are written; the run
+func (h *Handler) stop(w http.ResponseWriter, req *http.Request) {
+	if !h.method(w, req, "POST") {
+		return
+	}
+	entry, err := h.Platform.Stop()
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// runs the runs of the catalog, GET: runs, all or the ones matching the
+// search ?q= in the area ?area=archive or trash; runs/cart/2, one of them;
+// and runs/cart/2/data, its data file
+func (h *Handler) runs(w http.ResponseWriter, req *http.Request, id string) {
+	if !h.method(w, req, "GET") {
+		return
+	}
+	if id == "" {
+		req.ParseForm()
+		area, ok := parseArea(req.Form.Get("area"))
+		if !ok {
+			h.failStatus(w, http.StatusBadRequest, fmt.Sprintf("no such area %q", req.Form.Get("area")))
+			return
+		}
+		entries := h.Platform.Runs(area, strings.TrimSpace(req.Form.Get("q")))
+		if entries == nil {
+			entries = []catalog.Entry{}
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+	data := strings.HasSuffix(id, "/data")
+	id = strings.TrimSuffix(id, "/data")
+	run, err := experiment.ParseID(id)
+	if err != nil {
+		h.notFound(w, req)
+		return
+	}
+	entry, area, found := h.Platform.Run(run)
+	if !found {
+		h.notFound(w, req)
+		return
+	}
+	if !data {
+		writeJSON(w, http.StatusOK, entry)
+		return
+	}
+	if h.Platform.State().acquiring(run.ID()) {
+		h.failStatus(w, http.StatusConflict, "the run is being acquired, its data file is not complete")
+		return
+	}
+	h.Platform.ServeData(w, req, area, run)
+}
+
+// parseArea the area called name, the active one if empty
+func parseArea(name string) (experiment.Area, bool) {
+	for _, a := range experiment.Areas {
+		if name == a.String() || (a == experiment.Active && name == "") {
+			return a, true
+		}
+	}
+	return experiment.Active, false
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ecalman/OSHIWASP/catalog"
+	"github.com/ecalman/OSHIWASP/experiment"
+	"github.com/ecalman/OSHIWASP/state"
+)
+
+// fakePlatform a platform with the runs of cart, the second one in the
+// trash; its runs are numbered from 3
+type fakePlatform struct {
+	machine *state.Machine
+	config  Config
+	run     string
+	entries []catalog.Entry
+}
+
+func newFakePlatform() *fakePlatform {
+	return &fakePlatform{
+		machine: state.NewMachine(state.Experiment, state.Init),
+		entries: []catalog.Entry{
+			{ID: "cart/1", Experiment: "cart", Run: 1, Notes: "slope"},
+			{ID: "cart/2", Experiment: "cart", Run: 2, Area: "trash"},
+		},
+	}
+}
+
+func (p *fakePlatform) State() State {
+	return State{State: p.machine.Current().String(), Configuration: p.config.Name, Run: p.run, History: []Transition{}}
+}
+
+func (p *fakePlatform) Config() Config {
+	return p.config
+}
+
+func (p *fakePlatform) Configure(config Config) (Config, error) {
+	if err := experiment.ValidateName(config.Name); err != nil {
+		return Config{}, err
+	}
+	for name := range config.Sensors {
+		if name != "trackerA" {
+			return Config{}, &ConfigError{fmt.Errorf("no such sensor %q", name)}
+		}
+	}
+	if err := p.machine.To(state.Configured); err != nil {
+		return Config{}, err
+	}
+	p.config = config
+	return config, nil
+}
+
+func (p *fakePlatform) Start() (catalog.Entry, error) {
+	if err := p.machine.To(state.Starting); err != nil {
+		return catalog.Entry{}, err
+	}
+	n := len(p.entries) + 1
+	entry := catalog.Entry{ID: fmt.Sprintf("%s/%d", p.config.Name, n), Experiment: p.config.Name, Run: n}
+	p.entries = append(p.entries, entry)
+	p.run = entry.ID
+	return entry, p.machine.To(state.Running)
+}
+
+func (p *fakePlatform) Stop() (catalog.Entry, error) {
+	if err := p.machine.To(state.Stopping); err != nil {
+		return catalog.Entry{}, err
+	}
+	return p.entries[len(p.entries)-1], p.machine.To(state.Stopped)
+}
+
+func (p *fakePlatform) Runs(area experiment.Area, query string) []catalog.Entry {
+	var entries []catalog.Entry
+	for _, e := range p.entries {
+		if (e.Area == area.String() || e.Area == "" && area == experiment.Active) && e.Matches(query) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (p *fakePlatform) Run(run experiment.Run) (catalog.Entry, experiment.Area, bool) {
+	for _, e := range p.entries {
+		if e.ID == run.ID() {
+			area, _ := parseArea(e.Area)
+			return e, area, true
+		}
+	}
+	return catalog.Entry{}, experiment.Active, false
+}
+
+func (p *fakePlatform) ServeData(w http.ResponseWriter, req *http.Request, area experiment.Area, run experiment.Run) {
+	fmt.Fprintf(w, "data of %s in %s", run.ID(), area)
+}
+
+// do sends the request to the handler and decodes the JSON of the response
+// in v, if not nil
+func do(t *testing.T, h http.Handler, method, resource, body string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, Prefix+resource, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v in %q", method, resource, err, w.Body)
+		}
+	}
+	return w
+}
+
+func TestWorkflow(t *testing.T) {
+	p := newFakePlatform()
+	h := &Handler{Platform: p}
+
+	var failure Error
+	if w := do(t, h, "POST", "run", "", &failure); w.Code != http.StatusConflict || failure.State != "INIT" {
+		t.Errorf("run before configuring: %d %+v, expected 409 in INIT", w.Code, failure)
+	}
+
+	var config Config
+	w := do(t, h, "PUT", "config", `{"name": "cart", "sensors": {"trackerA": true}}`, &config)
+	if w.Code != http.StatusOK || config.Name != "cart" || !config.Sensors["trackerA"] {
+		t.Errorf("config: %d %+v", w.Code, config)
+	}
+	if w := do(t, h, "GET", "config", "", &config); w.Code != http.StatusOK || config.Name != "cart" {
+		t.Errorf("config read: %d %+v", w.Code, config)
+	}
+
+	var entry catalog.Entry
+	w = do(t, h, "POST", "run", "", &entry)
+	if w.Code != http.StatusCreated || entry.ID != "cart/3" || w.Header().Get("Location") != Prefix+"runs/cart/3" {
+		t.Errorf("run: %d %+v, location %q", w.Code, entry, w.Header().Get("Location"))
+	}
+	var s State
+	if w := do(t, h, "GET", "state", "", &s); w.Code != http.StatusOK || s.State != "RUNNING" || s.Run != "cart/3" {
+		t.Errorf("state: %d %+v", w.Code, s)
+	}
+	if w := do(t, h, "GET", "runs/cart/3/data", "", &failure); w.Code != http.StatusConflict {
+		t.Errorf("data file while running: %d %+v, expected 409", w.Code, failure)
+	}
+	if w := do(t, h, "POST", "stop", "", &entry); w.Code != http.StatusOK || entry.ID != "cart/3" {
+		t.Errorf("stop: %d %+v", w.Code, entry)
+	}
+	if w := do(t, h, "POST", "stop", "", &failure); w.Code != http.StatusConflict || failure.State != "STOPPED" {
+		t.Errorf("stop again: %d %+v, expected 409 in STOPPED", w.Code, failure)
+	}
+	if w := do(t, h, "GET", "runs/cart/3/data", "", nil); w.Code != http.StatusOK || w.Body.String() != "data of cart/3 in active" {
+		t.Errorf("data file: %d %q", w.Code, w.Body)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	h := &Handler{Platform: newFakePlatform()}
+	for _, c := range []struct {
+		method, body string
+		status       int
+	}{
+		{"PUT", `{"name": "cart", "sensors": {"thermometer": true}}`, http.StatusUnprocessableEntity},
+		{"PUT", `{"name": ""}`, http.StatusUnprocessableEntity},
+		{"POST", `{"name": "cart", "color": "red"}`, http.StatusBadRequest},
+		{"PUT", `{"name":`, http.StatusBadRequest},
+		{"DELETE", "", http.StatusMethodNotAllowed},
+	} {
+		var failure Error
+		w := do(t, h, c.method, "config", c.body, &failure)
+		if w.Code != c.status || failure.Error == "" || failure.State != "INIT" {
+			t.Errorf("%s %s: %d %+v, expected %d in INIT", c.method, c.body, w.Code, failure, c.status)
+		}
+	}
+	if w := do(t, h, "DELETE", "config", "", nil); w.Header().Get("Allow") != "GET, PUT, POST" {
+		t.Errorf("allowed %q", w.Header().Get("Allow"))
+	}
+}
+
+func TestRuns(t *testing.T) {
+	h := &Handler{Platform: newFakePlatform()}
+	for _, c := range []struct {
+		query string
+		ids   []string
+	}{
+		{"", []string{"cart/1"}},
+		{"?area=trash", []string{"cart/2"}},
+		{"?q=slope", []string{"cart/1"}},
+		{"?q=pendulum", []string{}},
+	} {
+		var entries []catalog.Entry
+		if w := do(t, h, "GET", "runs"+c.query, "", &entries); w.Code != http.StatusOK {
+			t.Errorf("runs%s: %d", c.query, w.Code)
+		}
+		ids := []string{}
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		if strings.Join(ids, " ") != strings.Join(c.ids, " ") || entries == nil {
+			t.Errorf("runs%s: %v, expected %v", c.query, ids, c.ids)
+		}
+	}
+
+	var entry catalog.Entry
+	if w := do(t, h, "GET", "runs/cart/2", "", &entry); w.Code != http.StatusOK || entry.ID != "cart/2" {
+		t.Errorf("run: %d %+v", w.Code, entry)
+	}
+	if w := do(t, h, "GET", "runs/cart/2/data", "", nil); w.Code != http.StatusOK || w.Body.String() != "data of cart/2 in trash" {
+		t.Errorf("data file in the trash: %d %q", w.Code, w.Body)
+	}
+	for _, resource := range []string{"runs?area=attic", "runs/cart/9", "runs/cart", "runs/../x/1/data", "runners", "live"} {
+		var failure Error
+		w := do(t, h, "GET", resource, "", &failure)
+		if w.Code != http.StatusNotFound && w.Code != http.StatusBadRequest || failure.Error == "" {
+			t.Errorf("%s: %d %+v, expected not found or bad", resource, w.Code, failure)
+		}
+	}
+	if w := do(t, h, "POST", "runs", "", nil); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET" {
+		t.Errorf("runs posted: %d, allowed %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestLive(t *testing.T) {
+	live := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("event: stop\n\n"))
+	})
+	h := &Handler{Platform: newFakePlatform(), Live: live}
+	if w := do(t, h, "GET", "live?rate=5", "", nil); w.Code != http.StatusOK || w.Body.String() != "event: stop\n\n" {
+		t.Errorf("live: %d %q", w.Code, w.Body)
+	}
+	if w := do(t, h, "POST", "live", "", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("live posted: %d, expected 405", w.Code)
+	}
+}
+
+func TestFail(t *testing.T) {
+	h := &Handler{Platform: newFakePlatform()}
+	w := httptest.NewRecorder()
+	h.fail(w, errors.New("disk full"))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("%d %q, expected 500 in JSON", w.Code, w.Header().Get("Content-Type"))
+	}
+}
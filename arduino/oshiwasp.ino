@@ -66,16 +66,20 @@ int pinTracker = 5;
 
 // outputLine
 volatile boolean sincro = false;
+volatile unsigned long tiempoTracker = 0; // micros() when the tracker fired last
 //String line="#";   // line with the message, composed with data from time and data from sensors.
                    // #time us,distance mm, Accx g, Accy g, Accz g, Gyrox º/s, Gyroy º/s, Gyroz º/s, Temp ºC
                    // if starts with @ means a sincronization point detected by the tracker
 
 //
 // binary data output line
+// the layout of the frames read by the server (frame/frame.go):
+// 1 + 4*3 + 4*6 + 1 = 38 bytes, packed and little endian in the AVR
 //
 
 typedef struct {
   char firstChar;
+  unsigned long trackerTime; // micros() when the tracker fired last
   unsigned long theTime;
   unsigned long distance;
   float          accX;
@@ -89,7 +93,15 @@ typedef struct {
 
 volatile OutputLine outputLine;
 int bytesOutputLine; // size of the outputLine after being scaped and in bytes
-volatile byte outputLineInBytes[sizeof(OutputLine)];
+volatile byte outputLineInBytes[2*sizeof(OutputLine)+4]; // room enough for every byte escaped and the checksum
+
+// escaping of the bytes between the marks: 0 - Off, 1 - On
+// set by the 'e' and 'r' commands
+boolean escaping = false;
+
+// checksum trailer before the end mark: 0 - Off, 1 - On
+// set by the 'c' and 'u' commands
+boolean checksum = false;
 
 
 
@@ -97,32 +109,55 @@ volatile byte outputLineInBytes[sizeof(OutputLine)];
 // functions
 //////
 
-void scapeAndBytes() {
-  // tamaño minimo de la trama de tiempo
-  bytesOutputLine=sizeof(OutputLine); 
+void putByte(byte b) {
+  // append b to outputLineInBytes, escaped if needed
+  // 0x7D -> 0x7D 0x00
+  // 0x24 -> 0x7D 0x03  ('$', so it only appears as the end mark)
+  // 0x11 -> 0x7D 0x04  (XON)
+  // 0x13 -> 0x7D 0x05  (XOFF)
+  if (escaping) {
+    switch (b) {
+      case 0x7D: outputLineInBytes[bytesOutputLine++] = 0x7D; outputLineInBytes[bytesOutputLine++] = 0x00; return;
+      case 0x24: outputLineInBytes[bytesOutputLine++] = 0x7D; outputLineInBytes[bytesOutputLine++] = 0x03; return;
+      case 0x11: outputLineInBytes[bytesOutputLine++] = 0x7D; outputLineInBytes[bytesOutputLine++] = 0x04; return;
+      case 0x13: outputLineInBytes[bytesOutputLine++] = 0x7D; outputLineInBytes[bytesOutputLine++] = 0x05; return;
+    }
+  }
+  outputLineInBytes[bytesOutputLine++] = b;
+}
 
-  byte *i = (byte *) &outputLine;
-  byte *o = (byte *) outputLineInBytes;
-  
-  //*o++ = 0x7E;  // inicio trama tiempo
-
-  for (int j=0; j<sizeof(OutputLine); j++, i++) {
-    /*
-    switch (*i) {
-      case 0x7D: *o++ = 0x7D; *o++ = 0x00; bytesOutputLine++; break;
-    // suponemos que no hay perdidas ni inserciones
-    //case 0x7E:  es otro inicio de trama y solo esperamos el final
-    //case 0x23:  es inicio trama de datos y solo esperamos el final
-      case 0x24: *o++ = 0x7D; *o++ = 0x03; bytesOutputLine++; break;
-      case 0x11: *o++ = 0x7D; *o++ = 0x04; bytesOutputLine++; break;
-      case 0x13: *o++ = 0x7D; *o++ = 0x05; bytesOutputLine++; break;
-      default  : *o++ = *i;
+unsigned int crc16(unsigned int crc, byte b) {
+  // CRC-16/CCITT, polynomial 0x1021, starting with 0xFFFF
+  crc ^= (unsigned int) b << 8;
+  for (int k=0; k<8; k++) {
+    if (crc & 0x8000) {
+      crc = (crc << 1) ^ 0x1021;
+    } else {
+      crc = crc << 1;
     }
-    */
-    *o++ = *i;
+  }
+  return crc;
+}
+
+void scapeAndBytes() {
+  // the marks are never escaped, only the bytes between them
+  byte *i = (byte *) &outputLine;
+  unsigned int crc = 0xFFFF;
+
+  bytesOutputLine=0;
+  outputLineInBytes[bytesOutputLine++] = *i++;  // start mark '#' or '@'
+
+  for (int j=1; j<sizeof(OutputLine)-1; j++, i++) {
+    crc = crc16(crc, *i);
+    putByte(*i);
+  }
+
+  if (checksum) { // little endian, as the rest of the data
+    putByte(crc & 0xFF);
+    putByte(crc >> 8);
   }
 
-  //*o = 0x24;    // endding mark '$'
+  outputLineInBytes[bytesOutputLine++] = *i;    // endding mark '$'
 }
 
 
@@ -130,6 +165,8 @@ String aTexto() {
   String linea = "";
   linea += outputLine.firstChar;
   linea += ", ";
+  linea += outputLine.trackerTime;
+  linea += ", ";
   linea += outputLine.theTime;
   linea += ", ";
   linea += outputLine.distance;
@@ -224,6 +261,7 @@ void sendSincro(){
   //Serial.write("@\n");
   //line.setCharAt(0,'@');
   sincro = true;
+  tiempoTracker = micros();
   //Serial.write("~");
 }
 
@@ -295,6 +333,10 @@ void loop()
   // s or S -> Status
   // n or N -> On
   // f or F -> Off
+  // e or E -> Escaped frames
+  // r or R -> Raw frames
+  // c or C -> Checksum in the frames
+  // u or U -> Unchecked frames
   {
     command=(Serial.read());
     switch (command) {
@@ -313,9 +355,29 @@ void loop()
       Serial.println("Stopping ...");
       state = stateOFF;
       break;
+    case 'e': //case 'E':
+      Serial.println("Escaping ...");
+      escaping = true;
+      break;
+    case 'r': //case 'R':
+      Serial.println("Raw ...");
+      escaping = false;
+      break;
+    case 'c': //case 'C':
+      Serial.println("Checksum ...");
+      checksum = true;
+      break;
+    case 'u': //case 'U':
+      Serial.println("Unchecked ...");
+      checksum = false;
+      break;
     default:
       Serial.println("Send 'n' to set readdings ON");
       Serial.println("Send 'f' to set readdings OFF");
+      Serial.println("Send 'e' to escape the frames");
+      Serial.println("Send 'r' to send raw frames");
+      Serial.println("Send 'c' to add a checksum to the frames");
+      Serial.println("Send 'u' to send frames without checksum");
       break;
     }   
   }
@@ -326,7 +388,7 @@ void loop()
     
     if (sincro) { 
       //line = "@"; //first caracter of the output in the case of sincro by tracker
-      outputLine.firstChar=0x64;  // @
+      outputLine.firstChar=0x40;  // @
       sincro = false; // @ set, reset sincro value
     }
     else {
@@ -336,6 +398,7 @@ void loop()
     outputLine.lastChar=0x24; // $
     tiempo = micros();
     //line+= tiempo;
+    outputLine.trackerTime=tiempoTracker;
     outputLine.theTime=micros(); 
     tiempoANT=tiempo;
     //line +=", ";
@@ -395,7 +458,7 @@ void loop()
         
     //Serial.println(aTexto());
     scapeAndBytes();
-    Serial.write((byte *) outputLineInBytes, sizeof(outputLineInBytes));
+    Serial.write((byte *) outputLineInBytes, bytesOutputLine);
   }
   //delay(100);
 }
@@ -0,0 +1,186 @@
+// Package catalog keeps the record of the runs of the experiments: what
+// was acquired, when and by whom, with the notes taken. It is persisted as
+// a JSON file, rewritten whole on every change.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound there's no entry of the run
+var ErrNotFound = errors.New("catalog: run not found")
+
+// Entry a run in the catalog
+type Entry struct {
+	// ID of the run: "cart/2"
+	ID         string `json:"id"`
+	Experiment string `json:"experiment"`
+	Run        int    `json:"run"`
+	// File of the run in its area of the data directory
+	File string `json:"file"`
+	// Area "archive" or "trash" if the run is kept apart, empty if not
+	Area string `json:"area,omitempty"`
+	// Sensors enabled in the run
+	Sensors []string  `json:"sensors"`
+	Start   time.Time `json:"start"`
+	// Stop zero while running, or if the run didn't end properly
+	Stop time.Time `json:"stop"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	// Records written, in total and by source
+	Records uint64            `json:"records"`
+	Sources map[string]uint64 `json:"sources,omitempty"`
+	// Dropped records lost because the buffer was full
+	Dropped uint64 `json:"dropped"`
+	// Tables the data of the run can be exported to
+	Tables []string `json:"tables,omitempty"`
+	// Operator person or group who did the run
+	Operator string `json:"operator,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+// Stopped the run ended properly
+func (e Entry) Stopped() bool {
+	return !e.Stop.IsZero()
+}
+
+// Matches all the terms of the query are in the entry: in the experiment,
+// the operator, the notes, the sensors or the date of the start
+func (e Entry) Matches(query string) bool {
+	text := strings.ToLower(strings.Join(append([]string{e.ID, e.Operator, e.Notes,
+		e.Start.Format("2006-01-02")}, e.Sensors...), " "))
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// Catalog the entries of the runs, safe for concurrent use
+type Catalog struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Open reads the catalog in the file; it's empty if the file doesn't exist
+func Open(path string) (*Catalog, error) {
+	c := &Catalog{path: path, entries: make(map[string]Entry)}
+	return c, c.load()
+}
+
+func (c *Catalog) load() error {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		c.entries[e.ID] = e
+	}
+	return nil
+}
+
+// save writes the file, replacing it only when it's completely written
+func (c *Catalog) save() error {
+	data, err := json.MarshalIndent(c.sorted(nil), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// sorted the entries matching, nil matches all, by start
+func (c *Catalog) sorted(match func(Entry) bool) []Entry {
+	entries := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		if match == nil || match(e) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Start.Equal(entries[j].Start) {
+			return entries[i].Start.Before(entries[j].Start)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Put adds the entry, or replaces the one of its run
+func (c *Catalog) Put(e Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[e.ID] = e
+	return c.save()
+}
+
+// Update changes the entry of the run
+func (c *Catalog) Update(id string, change func(*Entry)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	change(&e)
+	c.entries[e.ID] = e
+	if e.ID != id {
+		delete(c.entries, id)
+	}
+	return c.save()
+}
+
+// Remove deletes the entry of the run
+func (c *Catalog) Remove(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(c.entries, id)
+	return c.save()
+}
+
+// Get the entry of the run
+func (c *Catalog) Get(id string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	return e, ok
+}
+
+// Entries all the entries, by start
+func (c *Catalog) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sorted(nil)
+}
+
+// Search the entries matching the query, by start; all with an empty one
+func (c *Catalog) Search(query string) []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sorted(func(e Entry) bool { return e.Matches(query) })
+}
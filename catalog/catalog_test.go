@@ -0,0 +1,149 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// entries two runs of cart, the second one by a group, and one of pendulum
+// which didn't end properly
+func entries() []Entry {
+	start := time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)
+	return []Entry{
+		{ID: "cart/1", Experiment: "cart", Run: 1, File: "cart/run-001.csv", Sensors: []string{"accelerometer", "trackerA"},
+			Start: start, Stop: start.Add(3 * time.Second), Duration: 3, Records: 76,
+			Sources: map[string]uint64{"Ard": 75, "A": 1}, Tables: []string{"imu", "events"}},
+		{ID: "pendulum/1", Experiment: "pendulum", Run: 1, File: "pendulum/run-001.csv", Sensors: []string{"gyroscope"},
+			Start: start.Add(time.Hour)},
+		{ID: "cart/2", Experiment: "cart", Run: 2, File: "cart/run-002.csv", Sensors: []string{"distance"},
+			Start: start.Add(time.Minute), Stop: start.Add(time.Minute + 2*time.Second), Duration: 2,
+			Operator: "Group 3", Notes: "Slope of 5 degrees"},
+	}
+}
+
+func ids(entries []Entry) []string {
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "catalog.json")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Entries()) != 0 {
+		t.Errorf("entries %v of a new catalog", c.Entries())
+	}
+	for _, e := range entries() {
+		if err := c.Put(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// by start
+	if got, expected := ids(c.Entries()), []string{"cart/1", "cart/2", "pendulum/1"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("entries %v, expected %v", got, expected)
+	}
+	if e, ok := c.Get("cart/1"); !ok || !reflect.DeepEqual(e, entries()[0]) {
+		t.Errorf("entry %+v, %v; expected %+v", e, ok, entries()[0])
+	}
+	if e, ok := c.Get("pendulum/1"); !ok || e.Stopped() {
+		t.Errorf("entry %+v, %v; expected a run not stopped", e, ok)
+	}
+
+	for query, expected := range map[string][]string{
+		"":                 {"cart/1", "cart/2", "pendulum/1"},
+		"cart":             {"cart/1", "cart/2"},
+		"group SLOPE":      {"cart/2"},
+		"gyroscope":        {"pendulum/1"},
+		"2016-10-18 cart":  {"cart/1", "cart/2"},
+		"cart pendulum":    nil,
+		"trackerA imu":     nil,
+		"accelerometer 1/": nil,
+	} {
+		if got := ids(c.Search(query)); !reflect.DeepEqual(got, expected) {
+			t.Errorf("search %q: %v, expected %v", query, got, expected)
+		}
+	}
+}
+
+func TestCatalogUpdate(t *testing.T) {
+	c, err := Open(filepath.Join(t.TempDir(), "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries() {
+		if err := c.Put(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the notes of the stop page
+	if err := c.Update("cart/1", func(e *Entry) { e.Operator, e.Notes = "Group 1", "Flat" }); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := c.Get("cart/1"); e.Operator != "Group 1" || e.Notes != "Flat" || e.Records != 76 {
+		t.Errorf("entry %+v, expected the notes and the rest as it was", e)
+	}
+	// a run moved to another experiment changes its ID
+	if err := c.Update("pendulum/1", func(e *Entry) { e.ID, e.Experiment, e.Run = "cart/3", "cart", 3 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("pendulum/1"); ok {
+		t.Error("the entry of the run moved is still there")
+	}
+	if e, ok := c.Get("cart/3"); !ok || e.Experiment != "cart" {
+		t.Errorf("entry %+v, %v of the run moved", e, ok)
+	}
+	if err := c.Remove("cart/2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := ids(c.Entries()), []string{"cart/1", "cart/3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("entries %v, expected %v", got, expected)
+	}
+	if err := c.Update("cart/2", func(e *Entry) {}); err != ErrNotFound {
+		t.Errorf("updated a run removed: %v", err)
+	}
+	if err := c.Remove("cart/2"); err != ErrNotFound {
+		t.Errorf("removed a run twice: %v", err)
+	}
+}
+
+func TestCatalogLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries() {
+		if err := c.Put(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Remove("pendulum/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Entries(), c.Entries()) {
+		t.Errorf("loaded %+v, expected %+v", loaded.Entries(), c.Entries())
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("a broken catalog loaded")
+	}
+}
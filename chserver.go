@@ -1,22 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"path"
 	"path/filepath"
 	"time"
 
-	"bufio"
-	"bytes"
-	"encoding/binary"
 	"runtime"
 
-	"github.com/mrmorphic/hwio"
+	"github.com/ecalman/OSHIWASP/acquisition"
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/experiment"
+	"github.com/ecalman/OSHIWASP/frame"
+	"github.com/ecalman/OSHIWASP/gpio"
+	"github.com/ecalman/OSHIWASP/record"
+	"github.com/ecalman/OSHIWASP/state"
+	"github.com/ecalman/OSHIWASP/transport"
 	"github.com/tarm/serial"
 )
 
@@ -80,9 +84,6 @@ const StaticRoot string = "static/"
 // DataFilePath path of the data files on StaticRoot
 const DataFilePath string = "data/"
 
-// DataFileExtension extension of the data files
-const DataFileExtension string = ".csv"
-
 //level of attention of the messages
 const (
 	HIDE    = 0
@@ -99,12 +100,14 @@ const (
 //stateSTOPPED = "STOPPED"
 //stateERROR = "ERROR"
 
-//state of system
+//state of system, the transitions between them are in state.Experiment
 const (
-	INIT       = 0
-	CONFIGURED = 1
-	RUNNING    = 2
-	STOPPED    = 3
+	INIT       = state.Init
+	CONFIGURED = state.Configured
+	RUNNING    = state.Running
+	STOPPED    = state.Stopped
+	STARTING   = state.Starting
+	STOPPING   = state.Stopping
 )
 
 //title of pages respect of state
@@ -132,7 +135,7 @@ type Context struct {
 	AlertLevel int // HIDE, INFO, SUCCESS, WARNING, DANGER
 
 	//state of the processed
-	State int //INIT, CONFIGURED, RUNNING, STOPPED
+	State *state.Machine
 	//time of acquisition
 	Time0 time.Time
 
@@ -146,7 +149,15 @@ type Context struct {
 	DataFileName string
 
 	//arduino
-	SerialPort *serial.Port
+	SerialPort *transport.Interruptible
+	//readers and writer of the data of the run
+	supervisor *acquisition.Supervisor
+	//values of the records of the arduino
+	arduinoSchema *record.Schema
+	//run being acquired, or the last one
+	run experiment.Run
+	//writer of the data file of the run
+	dataWriter *datafile.Writer
 
 	//settings of the sensors: ON or OFF
 	SetTrackerA      bool
@@ -168,67 +179,34 @@ type Context struct {
 	StateOfGyroscope     int
 }
 
-// SensorDataInBytes data for sensors in Arduino in bytes
-type SensorDataInBytes struct {
-	trackerMicroSecondsInBytes []byte
-	sensorMicroSecondsInBytes  []byte
-	distanceInBytes            []byte
-	accXInBytes                []byte
-	accYInBytes                []byte
-	accZInBytes                []byte
-	gyrXInBytes                []byte
-	gyrYInBytes                []byte
-	gyrZInBytes                []byte
-}
-
-// SensorData data for sensors in Arduino in numerical data types
-type SensorData struct {
-	trackerMicroSeconds uint32
-	sensorMicroSeconds  uint32
-	distance            uint32
-	accX                float32
-	accY                float32
-	accZ                float32
-	gyrX                float32
-	gyrY                float32
-	gyrZ                float32
-}
-
 // Oshiwasp definition of configPuration of raspberry sensors, leds and buttons
 type Oshiwasp struct {
-	statusLed hwio.Pin
-	actionLed hwio.Pin
-	buttonA   hwio.Pin
-	buttonB   hwio.Pin
-	trackerA  hwio.Pin
-	trackerB  hwio.Pin
-	trackerC  hwio.Pin
-	trackerD  hwio.Pin
+	board gpio.Board
+
+	statusLed gpio.Pin
+	actionLed gpio.Pin
+	buttonA   gpio.Pin
+	buttonB   gpio.Pin
+	trackerA  gpio.Pin
+	trackerB  gpio.Pin
+	trackerC  gpio.Pin
+	trackerD  gpio.Pin
 }
 
 var (
 	c chan int //channel initialitation
-	//actionLed hwio.Pin // indicating action in the system
+	//actionLed gpio.Pin // indicating action in the system
 
 	// templates = template.Must(template.ParseGlob(tmplPath+"*.tmpl"))
 	// validPath = regexp.MustCompile("^/(index|new|status|start|pause|resume|stop|download|data)/([a-zA-Z0-9]+)$")
 
-	theSensorData        = new(SensorData)
-	theSensorDataInBytes = new(SensorDataInBytes)
-
 	//All the context of the execution with system and web data
 	theContext Context //theAcq=new(Acquisition)
 
 	theOshi = new(Oshiwasp)
-	//data channel for receive data from readers of sensors
-	data = make(chan string)
-	//channels for sincronization with gorutines, when TRUE them they return
-	quitR0 = make(chan bool)
-	quitR1 = make(chan bool)
-	quitR2 = make(chan bool)
-	quitR3 = make(chan bool)
-	quitR4 = make(chan bool)
-	quitW0 = make(chan bool)
+
+	//runs of the experiments in the data directory
+	theStore = experiment.NewStore(filepath.Join(StaticRoot, DataFilePath))
 )
 
 //AAAAAAAAAAAAAA
@@ -236,15 +214,16 @@ var (
 //AAAAAAAAAAAAAA
 
 func (cntxt *Context) connectArduinoSerialBT() {
-	var err error
 	// config the comm port for serial via BT
 	commPort := &serial.Config{Name: CommDevName, Baud: Bauds}
 	// open the serial comm with the arduino via BT
-	cntxt.SerialPort, err = serial.OpenPort(commPort)
+	port, err := serial.OpenPort(commPort)
 	if err != nil {
 		log.Printf("error opening the serial port with Arduino")
 		log.Fatal(err)
 	}
+	// the reads are interrupted to stop the run
+	cntxt.SerialPort = transport.NewInterruptible(port)
 	//defer acq.serialPort.Close()
 	log.Printf("Open serial device %s", CommDevName)
 }
@@ -278,38 +257,6 @@ func (cntxt *Context) getTime0() time.Time {
 	return cntxt.Time0
 }
 
-func (cntxt *Context) createOutputFile() {
-	var e error
-	cntxt.DataFileName = DataFilePath + cntxt.ConfigurationName + DataFileExtension
-	cntxt.DataFile, e = os.Create(cntxt.DataFileName)
-	if e != nil {
-		panic(e)
-	}
-	statusLine := fmt.Sprintf("### %v Data Acquisition: %s \n\n", time.Now(), cntxt.ConfigurationName)
-	cntxt.DataFile.WriteString(statusLine)
-	formatLine := fmt.Sprintf("### [Ard], localTime(us), sensorTime(us)")
-	if cntxt.SetTrackerM == ON {
-		formatLine += fmt.Sprintf(", trackerTime(us)")
-	}
-	if cntxt.SetDistance == ON {
-		formatLine += fmt.Sprintf(", distance(mm)")
-	}
-	if cntxt.SetAccelerometer == ON {
-		formatLine += fmt.Sprintf(", accX(g)")
-		formatLine += fmt.Sprintf(", accY(g)")
-		formatLine += fmt.Sprintf(", accZ(g)")
-	}
-	if cntxt.SetGyroscope == ON {
-		formatLine += fmt.Sprintf(", gyrX(gr/s)")
-		formatLine += fmt.Sprintf(", gyrY(gr/s)")
-		formatLine += fmt.Sprintf(", gyrZ(gr/s)")
-	}
-	formatLine += fmt.Sprintf("\n\n")
-	cntxt.DataFile.WriteString(formatLine)
-
-	log.Printf("Cretated output File %s", cntxt.DataFileName)
-}
-
 // func (acq *Acquisition) reopenOutputFile() {
 // 	var e error
 // 	acq.outputFile, e = os.OpenFile(acq.outputFileName, os.O_WRONLY|os.O_APPEND, 0666)
@@ -326,251 +273,242 @@ func (cntxt *Context) createOutputFile() {
 
 func (cntxt *Context) initiate() {
 	//acq.setOutputFileName(dataPath+dataFileName+dataFileExtension)
-	//acq.createOutputFile()
 	cntxt.connectArduinoSerialBT()
 	log.Printf("Arduino connected!")
 	//cntxt.setStateNEW()
-	cntxt.State = INIT
+	cntxt.State = state.NewMachine(state.Experiment, INIT)
+	cntxt.State.OnTransition(func(t state.Transition) {
+		log.Printf("State %s", t)
+	})
 }
 
 //OOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOO
 // Oshiwasp section: Raspberry sensors
 //OOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOO
 
-func (oshi *Oshiwasp) initiate() {
+func (oshi *Oshiwasp) initiate(board gpio.Board) {
 
 	var e error
+	oshi.board = board
 	// Set up 'trakers' as inputs
-	oshi.trackerA, e = hwio.GetPinWithMode(TrackerAPin, hwio.INPUT)
+	oshi.trackerA, e = board.Input(TrackerAPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerA\n", TrackerAPin)
 
-	oshi.trackerB, e = hwio.GetPinWithMode(TrackerBPin, hwio.INPUT)
+	oshi.trackerB, e = board.Input(TrackerBPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerB\n", TrackerBPin)
 
-	oshi.trackerC, e = hwio.GetPinWithMode(TrackerCPin, hwio.INPUT)
+	oshi.trackerC, e = board.Input(TrackerCPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerC\n", TrackerCPin)
 
-	oshi.trackerD, e = hwio.GetPinWithMode(TrackerDPin, hwio.INPUT)
+	oshi.trackerD, e = board.Input(TrackerDPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerD\n", TrackerDPin)
 
 	// Set up 'buttons' as inputs
-	oshi.buttonA, e = hwio.GetPinWithMode(ButtonAPin, hwio.INPUT)
+	oshi.buttonA, e = board.Input(ButtonAPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as buttonA\n", ButtonAPin)
 
-	oshi.buttonB, e = hwio.GetPinWithMode(ButtonBPin, hwio.INPUT)
+	oshi.buttonB, e = board.Input(ButtonBPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as buttonB\n", ButtonBPin)
 
 	// Set up 'leds' as outputs
-	oshi.statusLed, e = hwio.GetPinWithMode(StatusLedPin, hwio.OUTPUT)
+	oshi.statusLed, e = board.Output(StatusLedPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as statusLed\n", StatusLedPin)
 
-	oshi.actionLed, e = hwio.GetPinWithMode(ActionLedPin, hwio.OUTPUT)
+	oshi.actionLed, e = board.Output(ActionLedPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as actionLed\n", ActionLedPin)
 }
 
-func readTracker(name string, TrackerPin hwio.Pin, output chan<- string, quit <-chan bool) {
-	//value readed from tracker, initially set to 0, because the tracker was innactive
-	oldValue := 0
-	// time of the action detected
-	timeAction := time.Now()
-
-	// loop
-	for theContext.State != RUNNING {
-		select {
-		case <-quit:
-			log.Println("readTracker %s closing", name)
-			return
-		default:
-			// Read the tracker value
-			value, e := hwio.DigitalRead(TrackerPin)
-			if e != nil {
-				panic(e)
-			}
-			//timeActionOld=timeAction //store the last time
-			timeAction = time.Now() // time at this point
-			// Did value change?
-			if (value == 1) && (value != oldValue) {
-				dataString := fmt.Sprintf("[%s], %d,\n",
-					name, int64(timeAction.Sub(theContext.getTime0())/time.Microsecond))
-				log.Println(dataString)
-				//theContext.DataFile.WriteString(dataString)
-				output <- dataString
-
-				// Write the value to the led indicating somewhat is happened
-				if value == 1 {
-					hwio.DigitalWrite(theOshi.actionLed, hwio.HIGH)
-				} else {
-					hwio.DigitalWrite(theOshi.actionLed, hwio.LOW)
-				}
-			}
-			oldValue = value
+func readTracker(ctx context.Context, put func(record.Record), name string, watcher gpio.Watcher) error {
+	// closing the watcher unblocks Wait when the run stops
+	defer watcher.Close()
+	defer acquisition.OnCancel(ctx, func() { watcher.Close() })()
+	for {
+		// wait for the next rising edge of the tracker
+		event, e := watcher.Wait()
+		if e == gpio.ErrClosed {
+			log.Printf("readTracker %s closing", name)
+			return nil
+		}
+		if e != nil {
+			return e
 		}
+		// the time of the edge, not the time it is read
+		put(record.Record{Source: name, Time: event.Time})
+
+		// Write the value to the led indicating somewhat is happened
+		theOshi.actionLed.Write(gpio.HIGH)
 	}
 }
 
-func (cntxt *Context) readFromArduino(output chan<- string, quit <-chan bool) {
-
-	var register, reg []byte
-	// operate with the gobal variables theSensorData and theSensorDataInBytes; more speed?
-
-	// don't use the first readding ??  I'm not sure about that
-	reader := bufio.NewReader(cntxt.SerialPort)
-	// find the begging of an stream of data from the sensors
-	register, err := reader.ReadBytes('\x24')
-	if err != nil {
-		log.Println(err)
+//trackerReader the reader of a tracker for the supervisor
+func (oshi *Oshiwasp) trackerReader(name string, pinName string, pin gpio.Pin) (acquisition.Reader, error) {
+	watcher, e := gpio.Watch(oshi.board, pinName, pin, gpio.Rising)
+	if e != nil {
+		return nil, e
 	}
-	//log.Println(register)
-	//log.Printf(">>>>>>>>>>>>>>")
-
-	// loop
-	for cntxt.State == RUNNING {
-		select {
-		case <-quit:
-			log.Println("readFromArduino closing")
-			return
-		default:
-			// Read the serial and decode
-
-			register = nil
-			reg = nil
-
-			//n, err = s.Read(register)
-			for len(register) < 38 { // in case of \x24 chars repeted the length will be less than the expected 38 bytes
-				reg, err = reader.ReadBytes('\x24')
-				if err != nil {
-					log.Fatal(err)
-				}
-				register = append(register, reg...)
-			}
-
-			receptionTime := time.Now() // time of the action detected
-
-			if register[0] == '\x23' { // if first byte is '#', lets decode the stream of bytes in register
-
-				//decode the register
-
-				theSensorDataInBytes.trackerMicroSecondsInBytes = register[1:5]
-				buf := bytes.NewReader(theSensorDataInBytes.trackerMicroSecondsInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.trackerMicroSeconds)
-
-				theSensorDataInBytes.sensorMicroSecondsInBytes = register[5:9]
-				buf = bytes.NewReader(theSensorDataInBytes.sensorMicroSecondsInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.sensorMicroSeconds)
-
-				theSensorDataInBytes.distanceInBytes = register[9:13]
-				buf = bytes.NewReader(theSensorDataInBytes.distanceInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.distance)
-
-				theSensorDataInBytes.accXInBytes = register[13:17]
-				buf = bytes.NewReader(theSensorDataInBytes.accXInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.accX)
-
-				theSensorDataInBytes.accYInBytes = register[17:21]
-				buf = bytes.NewReader(theSensorDataInBytes.accYInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.accY)
+	if watcher.Polled() {
+		log.Printf("Polling tracker %s, no edge events for pin %s", name, pinName)
+	}
+	return func(ctx context.Context, put func(record.Record)) error {
+		return readTracker(ctx, put, name, watcher)
+	}, nil
+}
 
-				theSensorDataInBytes.accZInBytes = register[21:25]
-				buf = bytes.NewReader(theSensorDataInBytes.accZInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.accZ)
+//startTracker starts the reader of a tracker in the run
+func (cntxt *Context) startTracker(name string, pinName string, pin gpio.Pin) {
+	reader, e := theOshi.trackerReader(name, pinName, pin)
+	if e != nil {
+		log.Printf("Can't watch tracker %s: %s", name, e)
+		return
+	}
+	cntxt.supervisor.Go("Tracker "+name, reader)
+	log.Printf("Started Tracker %s", name)
+}
 
-				theSensorDataInBytes.gyrXInBytes = register[25:29]
-				buf = bytes.NewReader(theSensorDataInBytes.gyrXInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.gyrX)
+//newDataHeader the description of the data of the run
+func (cntxt *Context) newDataHeader() *datafile.Header {
+	header := datafile.NewHeader(cntxt.ConfigurationName, cntxt.Time0)
+	header.Run = cntxt.run.Number
+	header.Sensors["trackerA"] = cntxt.SetTrackerA
+	header.Sensors["trackerB"] = cntxt.SetTrackerB
+	header.Sensors["trackerC"] = cntxt.SetTrackerC
+	header.Sensors["trackerD"] = cntxt.SetTrackerD
+	header.Sensors["trackerM"] = cntxt.SetTrackerM
+	header.Sensors["distance"] = cntxt.SetDistance
+	header.Sensors["accelerometer"] = cntxt.SetAccelerometer
+	header.Sensors["gyroscope"] = cntxt.SetGyroscope
+	header.Transport = fmt.Sprintf("%s %s at %d bauds", transport.BT, CommDevName, Bauds)
+	header.Firmware = datafile.Firmware{Device: "arduino"}
+
+	header.AddSource("Ard", cntxt.arduinoSchema)
+	trackers := &record.Schema{}
+	for name, set := range map[string]bool{"A": cntxt.SetTrackerA, "B": cntxt.SetTrackerB,
+		"C": cntxt.SetTrackerC, "D": cntxt.SetTrackerD} {
+		if set {
+			header.AddSource(name, trackers)
+		}
+	}
+	return header
+}
 
-				theSensorDataInBytes.gyrYInBytes = register[29:33]
-				buf = bytes.NewReader(theSensorDataInBytes.gyrYInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.gyrY)
+//newArduinoSchema the values of the records of the arduino, as configured
+func (cntxt *Context) newArduinoSchema() *record.Schema {
+	schema := &record.Schema{}
+	schema.Add(record.Field{Name: "sensorTime", Unit: "us", Kind: record.Int})
+	if cntxt.SetTrackerM == ON {
+		schema.Add(record.Field{Name: "trackerTime", Unit: "us", Kind: record.Int},
+			record.Field{Name: "sync", Kind: record.Int})
+	}
+	if cntxt.SetDistance == ON {
+		schema.Add(record.Field{Name: "distance", Unit: "mm", Kind: record.Int})
+	}
+	if cntxt.SetAccelerometer == ON {
+		schema.Add(record.Field{Name: "accX", Unit: "g", Kind: record.Float},
+			record.Field{Name: "accY", Unit: "g", Kind: record.Float},
+			record.Field{Name: "accZ", Unit: "g", Kind: record.Float})
+	}
+	if cntxt.SetGyroscope == ON {
+		schema.Add(record.Field{Name: "gyrX", Unit: "gr/s", Kind: record.Float},
+			record.Field{Name: "gyrY", Unit: "gr/s", Kind: record.Float},
+			record.Field{Name: "gyrZ", Unit: "gr/s", Kind: record.Float})
+	}
+	return schema
+}
 
-				theSensorDataInBytes.gyrZInBytes = register[33:37]
-				buf = bytes.NewReader(theSensorDataInBytes.gyrZInBytes)
-				err = binary.Read(buf, binary.LittleEndian, &theSensorData.gyrZ)
+func (cntxt *Context) readFromArduino(ctx context.Context, put func(record.Record)) error {
+	// the Arduino stops sending before the run is stopped, interrupt the read
+	defer acquisition.OnCancel(ctx, cntxt.SerialPort.Interrupt)()
 
-			} // if
+	// the decoder finds the beginning of the frames by itself
+	decoder := frame.NewDecoder(cntxt.SerialPort)
 
-			//compound the dataline and write to the output
-			//receptionTime= time.Now() // Alternative: time at this point
-			dataString := fmt.Sprintf("[%s], %d, %d", "Ard",
-				int64(receptionTime.Sub(cntxt.Time0)/time.Microsecond), theSensorData.sensorMicroSeconds)
-			if cntxt.SetTrackerM == ON {
-				dataString += fmt.Sprintf(", %d", theSensorData.trackerMicroSeconds)
-			}
-			if cntxt.SetDistance == ON {
-				dataString += fmt.Sprintf(", %d", theSensorData.distance)
-			}
-			if cntxt.SetAccelerometer == ON {
-				dataString += fmt.Sprintf(", %f, %f, %f",
-					theSensorData.accX, theSensorData.accY, theSensorData.accZ)
-			}
-			if cntxt.SetGyroscope == ON {
-				dataString += fmt.Sprintf(", %f, %f, %f",
-					theSensorData.gyrX, theSensorData.gyrY, theSensorData.gyrZ)
+	// loop
+	for {
+		// Read the serial and decode
+		sensorData, err := decoder.Decode()
+		if ctx.Err() != nil {
+			log.Println("readFromArduino closing")
+			return nil
+		}
+		if err != nil {
+			if _, badFrame := err.(*frame.Error); badFrame {
+				// discard the frame, the decoder resynchronises by itself
+				log.Println(err)
+				continue
 			}
-			dataString += "\n" //end of line
-
-			log.Println(dataString)
-			//cntxt.DataFile.WriteString(dataString)
-			output <- dataString
-			// Write the value to the led indicating somewhat is happened
-			hwio.DigitalWrite(theOshi.actionLed, hwio.HIGH)
-			hwio.DigitalWrite(theOshi.actionLed, hwio.LOW)
+			return fmt.Errorf("error reading from Arduino: %v", err)
 		}
-	}
-}
 
-func (cntxt *Context) writer(input <-chan string, quit <-chan bool) {
+		receptionTime := time.Now() // time of the action detected
 
-	for {
-		select {
-		case <-quit:
-			log.Println("Closing writer")
-			return
-		case dataString := <-input:
-			cntxt.DataFile.WriteString(dataString)
+		//compound the record and write to the output
+		//receptionTime= time.Now() // Alternative: time at this point
+		values := []float64{float64(sensorData.SensorMicroSeconds)}
+		if cntxt.SetTrackerM == ON {
+			// sync is 1 in the first record after the tracker M fired ('@' frame)
+			sync := 0.0
+			if sensorData.Sync {
+				sync = 1
+			}
+			values = append(values, float64(sensorData.TrackerMicroSeconds), sync)
 		}
+		if cntxt.SetDistance == ON {
+			values = append(values, float64(sensorData.Distance))
+		}
+		if cntxt.SetAccelerometer == ON {
+			values = append(values, float64(sensorData.AccX), float64(sensorData.AccY), float64(sensorData.AccZ))
+		}
+		if cntxt.SetGyroscope == ON {
+			values = append(values, float64(sensorData.GyrX), float64(sensorData.GyrY), float64(sensorData.GyrZ))
+		}
+
+		put(record.Record{Source: "Ard", Schema: cntxt.arduinoSchema, Time: receptionTime, Values: values})
+		// Write the value to the led indicating somewhat is happened
+		theOshi.actionLed.Write(gpio.HIGH)
+		theOshi.actionLed.Write(gpio.LOW)
 	}
 }
 
-func blinkingLed(ledPin hwio.Pin) int {
+func blinkingLed(ledPin gpio.Pin) int {
 	// loop
 	for {
-		hwio.DigitalWrite(ledPin, hwio.HIGH)
-		hwio.Delay(500)
-		hwio.DigitalWrite(ledPin, hwio.LOW)
-		hwio.Delay(500)
+		ledPin.Write(gpio.HIGH)
+		time.Sleep(500 * time.Millisecond)
+		ledPin.Write(gpio.LOW)
+		time.Sleep(500 * time.Millisecond)
 	}
 }
 
-func waitTillButtonPushed(buttonPin hwio.Pin) int {
+func waitTillButtonPushed(buttonPin gpio.Pin) int {
 
 	// loop
 	for {
 		// Read the tracker value
-		value, e := hwio.DigitalRead(buttonPin)
+		value, e := buttonPin.Read()
 		if e != nil {
 			panic(e)
 		}
@@ -585,27 +523,6 @@ func waitTillButtonPushed(buttonPin hwio.Pin) int {
 // Web section
 //////////////
 
-//RemoveContents erase the contents of a directory
-//intended to remove data files en data directory
-func RemoveContents(dir string) error {
-	d, err := os.Open(dir)
-	if err != nil {
-		return err
-	}
-	defer d.Close()
-	names, err := d.Readdirnames(-1)
-	if err != nil {
-		return err
-	}
-	for _, name := range names {
-		err = os.RemoveAll(filepath.Join(dir, name))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 //Home of the website
 func Home(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
@@ -631,11 +548,11 @@ func Init(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		// correct states
 		if req.Method == "GET" {
-			theContext.Message = "Warning! You are erasing the configuration, the datafiles and restoring the platform to it's initial state."
+			theContext.Message = "Warning! You are erasing the configuration and restoring the platform to it's initial state. The datafiles are kept."
 			theContext.AlertLevel = DANGER
 			theContext.Title = titleInit
 			render(w, "init", theContext)
@@ -645,18 +562,15 @@ func Init(w http.ResponseWriter, req *http.Request) {
 			log.Println(req.Form)
 			if req.Form.Get("initializate") == "YES" {
 				//if YES, init the platform
-				theContext.State = INIT
+				if err := theContext.State.To(INIT); err != nil {
+					stateError(w, err)
+					return
+				}
 				theContext.ConfigurationName = ""
 				//set the initial state
-				theContext.initiate()
-				theOshi.initiate()
-				//erase datafiles
-				dataDirectory := filepath.Join(StaticRoot, DataFilePath)
-				log.Println("DELETING ", dataDirectory)
-				err := RemoveContents(dataDirectory)
-				if err != nil {
-					log.Println(err)
-				}
+				//theContext.initiate()
+				//theOshi.initiate(gpio.Hwio{})
+				//the datafiles are kept, they are the runs of the experiments
 
 				//message of initial state
 				theContext.Message = "The system is now in the initial state. Now you must define a new configuration berofe run an experiment."
@@ -670,7 +584,7 @@ func Init(w http.ResponseWriter, req *http.Request) {
 			theContext.Title = titleExperiment
 			render(w, "experiment", theContext)
 		}
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// wrong state
 		theContext.Message = "System is running! It MUST be stopped before erase the configuration and set the initial state."
 		theContext.AlertLevel = DANGER
@@ -680,19 +594,32 @@ func Init(w http.ResponseWriter, req *http.Request) {
 
 }
 
+//stateError shows the experiment page when the transition of a request is
+//refused, as when two requests race for the platform
+func stateError(w http.ResponseWriter, err error) {
+	log.Println(err)
+	theContext.Message = err.Error()
+	if e, ok := err.(*state.Error); ok {
+		theContext.Message = fmt.Sprintf("The platform can't go from %s to %s now. Check the state of the experiment and try again.", e.From, e.To)
+	}
+	theContext.AlertLevel = DANGER
+	theContext.Title = titleExperiment
+	render(w, "experiment", theContext)
+}
+
 //Experiment allows to access to the experiments
 func Experiment(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		//correct cases, shows the experiment page to config,test and run it
 		theContext.Message = "Let's make some experiments"
 		theContext.AlertLevel = INFO
 		theContext.Title = titleExperiment
 		render(w, "experiment", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		//wrong case, it must be STOPPED before
 		theContext.Message = "System is running! It MUST be stopped before a new configuration done."
 		theContext.AlertLevel = DANGER
@@ -706,7 +633,7 @@ func Config(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		//correct states, do the config process
 		if req.Method == "GET" {
@@ -718,9 +645,26 @@ func Config(w http.ResponseWriter, req *http.Request) {
 			log.Println("POST")
 			req.ParseForm()
 			// logic part of login
-			//validation phase will be here
+			//validation phase: the name will be a directory of the data
+			name := experiment.CleanName(req.Form.Get("ConfigurationName"))
+			if err := experiment.ValidateName(name); err != nil {
+				log.Println(err)
+				theContext.Message = "The name of the configuration can only have letters without accents, digits, \"-\" and \"_\", starting by a letter or a digit."
+				theContext.AlertLevel = DANGER
+				theContext.Title = titleConfig
+				render(w, "config", theContext)
+				return
+			}
+			if err := theContext.State.To(CONFIGURED); err != nil {
+				stateError(w, err)
+				return
+			}
+			if name != theContext.ConfigurationName {
+				//never add the runs to other experiment
+				name, _ = theStore.UniqueName(name, time.Now())
+			}
 			//if valid, put the form data into the context struct
-			theContext.ConfigurationName = req.Form.Get("ConfigurationName")
+			theContext.ConfigurationName = name
 			if req.Form.Get("SetTrackerA") == SensorStateOn {
 				theContext.SetTrackerA = ON
 			} else {
@@ -765,7 +709,6 @@ func Config(w http.ResponseWriter, req *http.Request) {
 			theContext.Message = "Configuration done! Now the system can be tested or runned the experiment"
 			theContext.Title = titleExperiment
 			theContext.AlertLevel = SUCCESS
-			theContext.State = CONFIGURED
 			//setArduinoStateON() //initiate Arduino readding sensors and transfer via BT
 
 			//log
@@ -776,7 +719,7 @@ func Config(w http.ResponseWriter, req *http.Request) {
 			//render(w, "experiment", theContext)
 			http.Redirect(w, req, "/experiment/", http.StatusFound)
 		}
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// only put a message, but don't touch the running process
 		theContext.Message = "System is running! It MUST be stopped before a new configuration done."
 		theContext.AlertLevel = DANGER
@@ -790,14 +733,14 @@ func Test(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT:
 		//The system must be configured before
 		theContext.Message = "The system must be configured before you could test it!"
 		theContext.AlertLevel = WARNING
 		theContext.Title = titleConfig
 		render(w, "configure", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		//wrong state, the system must be stopped before
 		theContext.Message = "Warning! You must stop the system before test the system."
 		theContext.AlertLevel = DANGER
@@ -866,7 +809,7 @@ func Run(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT:
 		//wrong state, show experiment page
 		theContext.Message = "Warning! You must configure the system before run the experiment."
@@ -875,56 +818,32 @@ func Run(w http.ResponseWriter, req *http.Request) {
 		render(w, "experiment", theContext)
 	case CONFIGURED, STOPPED:
 		//correct states, do the running process
+		if err := theContext.State.To(STARTING); err != nil {
+			stateError(w, err)
+			return
+		}
 
-		dataFileName := filepath.Join(StaticRoot, DataFilePath, theContext.ConfigurationName+DataFileExtension)
-		//detect if file exists
-		_, err := os.Stat(dataFileName)
-		//create datafile is not exists
-		if os.IsNotExist(err) {
-			//create file to write
-			log.Println("Creating ", dataFileName)
-			theContext.DataFile, err = os.Create(dataFileName)
-			if err != nil {
-				log.Println(err.Error())
-			}
-			statusLine := fmt.Sprintf("### %v Data Acquisition: %s \n\n", time.Now(), theContext.ConfigurationName)
-			theContext.DataFile.WriteString(statusLine)
-			//formatLine := fmt.Sprintf("### [Ard], localTime(us), trackerTime(us), sensorTime(us), distance(mm), accX(g), accY(g), accZ(g), gyrX(gr/s), gyrY(gr/s), gyrZ(gr/s) \n\n")
-			formatLine := fmt.Sprintf("### [Ard], localTime(us), sensorTime(us)")
-			if theContext.SetTrackerM == ON {
-				formatLine += fmt.Sprintf(", trackerTime(us)")
-			}
-			if theContext.SetDistance == ON {
-				formatLine += fmt.Sprintf(", distance(mm)")
-			}
-			if theContext.SetAccelerometer == ON {
-				formatLine += fmt.Sprintf(", accX(g)")
-				formatLine += fmt.Sprintf(", accY(g)")
-				formatLine += fmt.Sprintf(", accZ(g)")
-			}
-			if theContext.SetGyroscope == ON {
-				formatLine += fmt.Sprintf(", gyrX(gr/s)")
-				formatLine += fmt.Sprintf(", gyrY(gr/s)")
-				formatLine += fmt.Sprintf(", gyrZ(gr/s)")
-			}
-			formatLine += fmt.Sprintf("\n\n")
-			theContext.DataFile.WriteString(formatLine)
-			// sets the new time0 only with a new scenery
-			theContext.setTime0()
-		} else {
-			//open fle to append
-			log.Println("Openning ", dataFileName)
-			theContext.DataFile, err = os.OpenFile(dataFileName, os.O_RDWR|os.O_APPEND, 0644)
-			if err != nil {
-				log.Println(err.Error())
-			}
+		//each run has its own data file, numbered in the experiment, and
+		//its own time0
+		theContext.setTime0()
+		var err error
+		theContext.run, theContext.DataFile, err = theStore.NewRun(theContext.ConfigurationName)
+		if err != nil {
+			log.Println(err.Error())
+			theContext.State.To(STOPPED)
+			theContext.Message = "The data file of the run can't be created: " + err.Error()
+			theContext.AlertLevel = DANGER
+			theContext.Title = titleExperiment
+			render(w, "experiment", theContext)
+			return
 		}
+		log.Println("Creating ", theStore.Path(theContext.run))
 
 		// running process instruction here!
 		// running process instruction here!
 
 		//waitTillButtonPushed(buttonA)
-		hwio.DigitalWrite(theOshi.statusLed, hwio.HIGH)
+		theOshi.statusLed.Write(gpio.HIGH)
 		log.Println("Beginning.....")
 
 		//activate arduino
@@ -935,37 +854,41 @@ func Run(w http.ResponseWriter, req *http.Request) {
 		log.Printf("Launching the Gourutines")
 
 		//the writer to the data file
-		go theContext.writer(data, quitW0)
+		theContext.SerialPort.Resume()
+		theContext.arduinoSchema = theContext.newArduinoSchema()
+		//the run begins with its header
+		theContext.dataWriter, err = datafile.NewWriter(theContext.DataFile, theContext.newDataHeader())
+		if err != nil {
+			log.Println(err.Error())
+		}
+		theContext.supervisor = acquisition.New(context.Background(),
+			record.NewPipeline(record.DefaultCapacity, record.DropOldest, theContext.dataWriter))
 
-		//the readers fron sensors
-		go theContext.readFromArduino(data, quitR0)
+		//the readers fron the configured sensors only
+		theContext.supervisor.Go("Arduino", theContext.readFromArduino)
 		log.Println("Started Arduino")
 		if theContext.SetTrackerA == ON {
-			go readTracker("A", theOshi.trackerA, data, quitR1)
-			log.Println("Started Tracker A")
+			theContext.startTracker("A", TrackerAPin, theOshi.trackerA)
 		}
 		if theContext.SetTrackerB == ON {
-			go readTracker("B", theOshi.trackerB, data, quitR2)
-			log.Println("Started Tracker B")
+			theContext.startTracker("B", TrackerBPin, theOshi.trackerB)
 		}
 		if theContext.SetTrackerC == ON {
-			go readTracker("C", theOshi.trackerC, data, quitR3)
-			log.Println("Started Tracker C")
+			theContext.startTracker("C", TrackerCPin, theOshi.trackerC)
 		}
 		if theContext.SetTrackerD == ON {
-			go readTracker("D", theOshi.trackerD, data, quitR4)
-			log.Println("Started Tracker D")
+			theContext.startTracker("D", TrackerDPin, theOshi.trackerD)
 		}
 
 		log.Printf("There are %v goroutines", runtime.NumGoroutine())
 		//defer close the file to STOP
+		theContext.State.To(RUNNING)
 
 		theContext.Message = "System running gathering data from sensors."
 		theContext.AlertLevel = SUCCESS
 		theContext.Title = titleRun
-		theContext.State = RUNNING
 		render(w, "run", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// we already are in this State
 		// only put a message, but don't touch the running process
 		theContext.Message = "System is ALREADY running!"
@@ -980,7 +903,7 @@ func Stop(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED:
 		theContext.Message = "Warning! You must configure the system and run the experiment before stop it."
 		theContext.AlertLevel = DANGER
@@ -988,35 +911,34 @@ func Stop(w http.ResponseWriter, req *http.Request) {
 		render(w, "experiment", theContext)
 	case RUNNING:
 		//correct state, do the stop process
+		if err := theContext.State.To(STOPPING); err != nil {
+			stateError(w, err)
+			return
+		}
 		// stop process instruction here!
 		// stop process instruction here!
 
-		//stop gorutines
+		//stop the arduino from read sensor and sending data via BT
+		setArduinoStateOFF()
+
+		//stop gorutines, the started ones only, and flush their records
 		log.Printf("Stopping goroutines")
-		//readers
-		quitR0 <- true
-		log.Printf("readFromArduino closed")
-		quitR1 <- true
-		log.Printf("readTracker A closed")
-		quitR2 <- true
-		log.Printf("readTracker B closed")
-		quitR3 <- true
-		log.Printf("readTracker C closed")
-		quitR4 <- true
-		log.Printf("readTracker D closed")
-		//writter
-		quitW0 <- true
-		log.Printf("writer closed")
+		report := theContext.supervisor.Stop()
+		log.Printf("All the records flushed: %s", report)
+		footer := datafile.Footer{Stop: time.Now(), Dropped: report.Pipeline.Dropped}
+		for _, e := range report.Errors {
+			footer.Errors = append(footer.Errors, e.Error())
+		}
+		if err := theContext.dataWriter.Close(footer); err != nil {
+			log.Println(err.Error())
+		}
 		log.Printf("There are %v goroutines", runtime.NumGoroutine())
 
 		//swich off the status led in the raspi
-		hwio.DigitalWrite(theOshi.statusLed, hwio.LOW)
+		theOshi.statusLed.Write(gpio.LOW)
 		// close the GPIO pins
 		//hwio.CloseAll()
 
-		//stop the arduino from read sensor and sending data via BT
-		setArduinoStateOFF()
-
 		//close the file
 		err := theContext.DataFile.Sync()
 		if err != nil {
@@ -1026,7 +948,7 @@ func Stop(w http.ResponseWriter, req *http.Request) {
 
 		theContext.Message = "System stopped. Now you can donwload the data to your permanent storage"
 		theContext.Title = titleStop
-		theContext.State = STOPPED
+		theContext.State.To(STOPPED)
 		theContext.AlertLevel = SUCCESS
 		render(w, "stop", theContext)
 
@@ -1037,6 +959,12 @@ func Stop(w http.ResponseWriter, req *http.Request) {
 		theContext.AlertLevel = WARNING
 		theContext.Title = titleStop
 		render(w, "experiment", theContext)
+	case STARTING, STOPPING:
+		// the run is being started or stopped by another request
+		theContext.Message = "The system is starting or stopping a run, wait a moment."
+		theContext.AlertLevel = WARNING
+		theContext.Title = titleRun
+		render(w, "run", theContext)
 	}
 }
 
@@ -1045,14 +973,19 @@ func Collect(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		//read the data directory and offers the files to be downloaded
-		theContext.DataFiles, _ = filepath.Glob(filepath.Join(StaticRoot, DataFilePath, "*"+DataFileExtension))
-		//log.Println(">>>> " + filepath.Join(StaticRoot, DataFilePath, "*"+DataExtension))
-		//let only the file name, eliminate the path
-		for i, f := range theContext.DataFiles {
-			theContext.DataFiles[i] = path.Base(f)
+		//the files of the runs, as experiment/run-001.csv
+		experiments, err := theStore.Experiments()
+		if err != nil {
+			log.Println(err.Error())
+		}
+		theContext.DataFiles = theContext.DataFiles[:0]
+		for _, e := range experiments {
+			for _, run := range e.Runs {
+				theContext.DataFiles = append(theContext.DataFiles, run.File())
+			}
 		}
 
 		log.Println(theContext.DataFiles)
@@ -1066,7 +999,7 @@ func Collect(w http.ResponseWriter, req *http.Request) {
 			theContext.AlertLevel = INFO
 		}
 		render(w, "collect", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		theContext.Message = "You can't download data is while the system is running. You must stop the system before."
 		theContext.AlertLevel = WARNING
 		theContext.Title = titleRun
@@ -1128,7 +1061,7 @@ func StaticHandler(w http.ResponseWriter, req *http.Request) {
 func main() {
 	//set the initial state
 	theContext.initiate()
-	theOshi.initiate()
+	theOshi.initiate(gpio.Hwio{})
 
 	http.HandleFunc("/", Home)
 	http.HandleFunc("/thePlatform/", ThePlatform)
@@ -1150,5 +1083,5 @@ func main() {
 
 	// close the GPIO pins
 	defer theContext.SerialPort.Close()
-	hwio.CloseAll()
+	theOshi.board.Close()
 }
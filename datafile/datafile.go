@@ -0,0 +1,173 @@
+// Package datafile writes and reads the data files of the experiments.
+//
+// A data file is text, one line per record, with ';' between the values.
+// It holds a segment for each run written to it, usually one. A segment is
+//
+//	#OSHIWASP-DATA 1
+//	#header {"version":1,"configuration":"cart","run":2,...}
+//	source;localTime(us);sensorTime(us);...;level
+//	Ard;40849;286078321;...;
+//	A;1354100;;...;1
+//	#footer {"stop":"...","link":{...},...}
+//
+// The first line gives the version of the format. The header is a JSON
+// Header: the configuration, the sensors enabled, the settings, the
+// transport and the firmware, the start time of the local times, and the
+// columns with their units. The line of column labels follows; every row
+// has all the columns: the source, its local time in microseconds since
+// the start, and the values of the columns the source fills, as listed in
+// Header.Sources, the others empty. The footer, a JSON object, has what
+// is known only at the end of the run, as the quality of the link. Other
+// lines starting with '#' are comments.
+package datafile
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// Version of the format written
+const Version = 1
+
+// lines of the format
+const (
+	// Magic first line of a segment, followed by the version
+	Magic = "#OSHIWASP-DATA"
+	// HeaderPrefix line with the JSON header
+	HeaderPrefix = "#header "
+	// FooterPrefix line with the JSON footer
+	FooterPrefix = "#footer "
+	// Comment lines starting with it are not records
+	Comment = "#"
+	// Delimiter between the values
+	Delimiter = ";"
+)
+
+// columns of every row
+const (
+	// SourceColumn the source of the record: "Ard", "A"...
+	SourceColumn = "source"
+	// TimeColumn the local time of the record, in microseconds
+	TimeColumn = "localTime"
+)
+
+// Column of the rows
+type Column struct {
+	Name string `json:"name"`
+	Unit string `json:"unit,omitempty"`
+	// Kind "string", "int" or "float"
+	Kind string `json:"kind"`
+}
+
+// Label the name of the column, with its unit: "distance(mm)"
+func (c Column) Label() string {
+	if c.Unit == "" {
+		return c.Name
+	}
+	return c.Name + "(" + c.Unit + ")"
+}
+
+// kinds of the columns
+const (
+	String = "string"
+	Int    = "int"
+	Float  = "float"
+)
+
+// Firmware what sends the records of the Arduino, and how
+type Firmware struct {
+	// Device "arduino", "esp32" or "simulated"
+	Device string `json:"device"`
+	// Escaped frames with the bytes escaped
+	Escaped bool `json:"escaped"`
+	// Checksum frames with a checksum
+	Checksum bool `json:"checksum"`
+}
+
+// Header the description of a segment
+type Header struct {
+	Version       int    `json:"version"`
+	Configuration string `json:"configuration"`
+	// Run number of the run in the experiment, from 1; 0 if unknown
+	Run int `json:"run,omitempty"`
+	// Start when the run began, origin of the local times
+	Start time.Time `json:"start"`
+	// Sensors enabled or not, by name
+	Sensors map[string]bool `json:"sensors"`
+	// Settings of the acquisition, as the filters of the trackers
+	Settings  map[string]string `json:"settings,omitempty"`
+	Transport string            `json:"transport"`
+	Firmware  Firmware          `json:"firmware"`
+	Delimiter string            `json:"delimiter"`
+	Columns   []Column          `json:"columns"`
+	// Sources the columns filled by each source, after the local time
+	Sources map[string][]string `json:"sources"`
+}
+
+// NewHeader returns a header with the source and time columns
+func NewHeader(configuration string, start time.Time) *Header {
+	return &Header{
+		Version:       Version,
+		Configuration: configuration,
+		Start:         start,
+		Sensors:       make(map[string]bool),
+		Settings:      make(map[string]string),
+		Delimiter:     Delimiter,
+		Columns: []Column{
+			{Name: SourceColumn, Kind: String},
+			{Name: TimeColumn, Unit: "us", Kind: Int},
+		},
+		Sources: make(map[string][]string),
+	}
+}
+
+// AddSource declares the fields of the records of the source; the columns
+// are shared by the sources with fields of the same name
+func (h *Header) AddSource(source string, schema *record.Schema) {
+	names := make([]string, 0, len(schema.Fields))
+	for _, f := range schema.Fields {
+		if h.Column(f.Name) < 0 {
+			kind := Float
+			if f.Kind == record.Int {
+				kind = Int
+			}
+			h.Columns = append(h.Columns, Column{Name: f.Name, Unit: f.Unit, Kind: kind})
+		}
+		names = append(names, f.Name)
+	}
+	h.Sources[source] = names
+}
+
+// Column the index of the column called name, -1 if there isn't
+func (h *Header) Column(name string) int {
+	for i, c := range h.Columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Labels the line of labels of the columns
+func (h *Header) Labels() string {
+	line := ""
+	for i, c := range h.Columns {
+		if i > 0 {
+			line += h.Delimiter
+		}
+		line += c.Label()
+	}
+	return line
+}
+
+// Error a malformed data file
+type Error struct {
+	Line   int
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("datafile: line %d: %s", e.Line, e.Reason)
+}
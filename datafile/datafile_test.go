@@ -0,0 +1,133 @@
+package datafile
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+var start = time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)
+
+// writeRun writes a segment of the run with a record of the arduino and
+// one of the tracker A
+func writeRun(t *testing.T, w io.Writer, run int) []record.Record {
+	arduino := &record.Schema{}
+	arduino.Add(record.Field{Name: "sensorTime", Unit: "us", Kind: record.Int},
+		record.Field{Name: "accX", Unit: "g", Kind: record.Float})
+	tracker := &record.Schema{}
+	tracker.Add(record.Field{Name: "level", Kind: record.Int})
+
+	h := NewHeader("cart", start)
+	h.Run = run
+	h.Sensors["accelerometer"] = true
+	h.Settings["trackerEdges"] = "both"
+	h.AddSource("Ard", arduino)
+	h.AddSource("A", tracker)
+	writer, err := NewWriter(w, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []record.Record{
+		{Source: "Ard", Schema: arduino, Time: start.Add(40849 * time.Microsecond), Values: []float64{286078321, -1.000891}},
+		{Source: "A", Schema: tracker, Time: start.Add(1354699 * time.Microsecond), Values: []float64{1}},
+	}
+	for _, r := range records {
+		if err := writer.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(Footer{Stop: start.Add(2 * time.Second), Dropped: 1}); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestRoundTrip(t *testing.T) {
+	var file bytes.Buffer
+	written := writeRun(t, &file, 1)
+	writeRun(t, &file, 2)
+
+	segments, err := ReadAll(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("%d segments, expected 2", len(segments))
+	}
+	for i, s := range segments {
+		if s.Header.Run != i+1 || s.Header.Configuration != "cart" || !s.Header.Start.Equal(start) ||
+			!s.Header.Sensors["accelerometer"] || s.Header.Settings["trackerEdges"] != "both" {
+			t.Errorf("segment %d: header %+v", i, s.Header)
+		}
+		if s.Footer == nil || s.Footer.Records != 2 || s.Footer.Dropped != 1 {
+			t.Errorf("segment %d: footer %+v", i, s.Footer)
+		}
+	}
+
+	read := segments[0].Records()
+	if len(read) != len(written) {
+		t.Fatalf("%d records read, expected %d", len(read), len(written))
+	}
+	for i, r := range read {
+		w := written[i]
+		if r.Source != w.Source || !r.Time.Equal(w.Time) || !reflect.DeepEqual(r.Values, w.Values) ||
+			!reflect.DeepEqual(r.Schema, w.Schema) {
+			t.Errorf("record %d read %+v, expected %+v", i, r, w)
+		}
+	}
+
+	// the columns the source doesn't fill are empty
+	row := segments[0].Rows[1]
+	if v, ok := segments[0].Header.Value(row, "accX"); ok || !math.IsNaN(v) {
+		t.Errorf("accX of the tracker %v, expected empty", v)
+	}
+	if v, ok := segments[0].Header.Value(row, "level"); !ok || v != 1 {
+		t.Errorf("level of the tracker %v, expected 1", v)
+	}
+}
+
+func TestReadAllTruncated(t *testing.T) {
+	var file bytes.Buffer
+	writeRun(t, &file, 1)
+	text := file.String()
+	// cut in the middle of the footer, as when the power fails
+	cut := text[:len(text)-20]
+
+	segments, err := ReadAll(strings.NewReader(cut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || len(segments[0].Rows) != 2 || segments[0].Footer != nil {
+		t.Errorf("%d segments read from a truncated file, expected 1 with 2 rows and no footer", len(segments))
+	}
+}
+
+func TestReadAllMalformed(t *testing.T) {
+	var file bytes.Buffer
+	writeRun(t, &file, 1)
+	lines := strings.Split(file.String(), "\n")
+	// the first row
+	lines[3] = "Ard;bad"
+
+	segments, err := ReadAll(strings.NewReader(strings.Join(lines, "\n")))
+	e, ok := err.(*Error)
+	if !ok || e.Line != 4 {
+		t.Fatalf("error %v, expected one at line 4", err)
+	}
+	if len(segments) != 1 || len(segments[0].Rows) != 0 {
+		t.Errorf("segments %+v read before the error", segments)
+	}
+}
+
+func TestReadNotDataFile(t *testing.T) {
+	legacy := "### 2016-10-04 13:27:11 Data Acquisition: abe\n[Ard]; 272415; 2526584860\n"
+	if _, err := ReadAll(strings.NewReader(legacy)); err == nil {
+		t.Error("file of an older version read")
+	}
+}
@@ -0,0 +1,229 @@
+package datafile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FirstValue the index of the first column of values, after the source and
+// the local time
+const FirstValue = 2
+
+// maxLine longest line read, the header included
+const maxLine = 1 << 20
+
+// Row a record read from the file
+type Row struct {
+	Source string
+	// Time local time since the start of the header
+	Time time.Duration
+	// Values of the columns from FirstValue on, NaN where empty
+	Values []float64
+}
+
+// Value the value of the column called name, false if the column doesn't
+// exist or the row doesn't fill it
+func (h *Header) Value(row Row, name string) (float64, bool) {
+	column := h.Column(name)
+	if column < FirstValue || column-FirstValue >= len(row.Values) {
+		return math.NaN(), false
+	}
+	v := row.Values[column-FirstValue]
+	return v, !math.IsNaN(v)
+}
+
+// Reader reads the rows of a data file, segment after segment
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+	header  *Header
+	footer  *Footer
+	segment int
+	// onSegment and onFooter are called as they are read
+	onSegment func(*Header)
+	onFooter  func(*Footer)
+}
+
+// NewReader returns a reader of the data file in r
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	return &Reader{scanner: scanner}
+}
+
+// Header of the segment being read, nil before the first row
+func (r *Reader) Header() *Header {
+	return r.header
+}
+
+// Footer of the segment being read, nil until it's read
+func (r *Reader) Footer() *Footer {
+	return r.footer
+}
+
+// Segment the number of the segment being read, from 1
+func (r *Reader) Segment() int {
+	return r.segment
+}
+
+// Next returns the next row; io.EOF at the end of the file
+func (r *Reader) Next() (Row, error) {
+	for {
+		text, err := r.next()
+		if err != nil {
+			return Row{}, err
+		}
+		switch {
+		case strings.HasPrefix(text, Magic):
+			if err := r.beginSegment(text); err != nil {
+				return Row{}, err
+			}
+		case strings.HasPrefix(text, FooterPrefix):
+			if r.header == nil {
+				return Row{}, r.errorf("footer out of a segment")
+			}
+			footer := &Footer{}
+			if err := json.Unmarshal([]byte(text[len(FooterPrefix):]), footer); err != nil {
+				return Row{}, r.errorf("bad footer: %v", err)
+			}
+			r.footer = footer
+			if r.onFooter != nil {
+				r.onFooter(footer)
+			}
+		case strings.HasPrefix(text, Comment), text == "":
+		default:
+			if r.header == nil {
+				return Row{}, r.errorf("not an OSHIWASP data file")
+			}
+			return r.parseRow(text)
+		}
+	}
+}
+
+func (r *Reader) next() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	r.line++
+	return strings.TrimRight(r.scanner.Text(), "\r"), nil
+}
+
+// beginSegment reads the header and the labels after the version line
+func (r *Reader) beginSegment(text string) error {
+	version, err := strconv.Atoi(strings.TrimSpace(text[len(Magic):]))
+	if err != nil {
+		return r.errorf("bad version %q", text[len(Magic):])
+	}
+	if version < 1 || version > Version {
+		return r.errorf("version %d not supported", version)
+	}
+	if text, err = r.next(); err != nil {
+		return r.errorf("header missing")
+	}
+	if !strings.HasPrefix(text, HeaderPrefix) {
+		return r.errorf("header missing")
+	}
+	header := &Header{}
+	if err := json.Unmarshal([]byte(text[len(HeaderPrefix):]), header); err != nil {
+		return r.errorf("bad header: %v", err)
+	}
+	if len(header.Columns) < FirstValue || header.Delimiter == "" {
+		return r.errorf("bad header: no columns or delimiter")
+	}
+	if text, err = r.next(); err != nil || text != header.Labels() {
+		return r.errorf("labels of the columns missing")
+	}
+	r.header = header
+	r.footer = nil
+	r.segment++
+	if r.onSegment != nil {
+		r.onSegment(header)
+	}
+	return nil
+}
+
+func (r *Reader) parseRow(text string) (Row, error) {
+	cells := strings.Split(text, r.header.Delimiter)
+	if len(cells) != len(r.header.Columns) {
+		return Row{}, r.errorf("%d values, %d columns", len(cells), len(r.header.Columns))
+	}
+	us, err := strconv.ParseInt(cells[1], 10, 64)
+	if err != nil {
+		return Row{}, r.errorf("bad local time %q", cells[1])
+	}
+	row := Row{Source: cells[0], Time: time.Duration(us) * time.Microsecond,
+		Values: make([]float64, len(cells)-FirstValue)}
+	for i, cell := range cells[FirstValue:] {
+		if cell == "" {
+			row.Values[i] = math.NaN()
+			continue
+		}
+		if row.Values[i], err = strconv.ParseFloat(cell, 64); err != nil {
+			return Row{}, r.errorf("bad value %q of %s", cell, r.header.Columns[FirstValue+i].Name)
+		}
+	}
+	return row, nil
+}
+
+func (r *Reader) errorf(format string, args ...interface{}) error {
+	return &Error{Line: r.line, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Segment the rows of a run
+type Segment struct {
+	Header *Header
+	Rows   []Row
+	// Footer nil if the run didn't end properly
+	Footer *Footer
+}
+
+// Slice the segment with the rows of local time from from to to, both
+// included; the header and the footer are the ones of the whole run
+func (s Segment) Slice(from, to time.Duration) Segment {
+	slice := Segment{Header: s.Header, Footer: s.Footer}
+	for _, row := range s.Rows {
+		if row.Time >= from && row.Time <= to {
+			slice.Rows = append(slice.Rows, row)
+		}
+	}
+	return slice
+}
+
+// ReadAll reads all the segments of the file. A malformed last line of a
+// segment, as the one cut short when the power fails while writing, is
+// ignored; the rows read before any other error are returned with it.
+func ReadAll(r io.Reader) ([]Segment, error) {
+	var segments []Segment
+	reader := NewReader(r)
+	reader.onSegment = func(h *Header) {
+		segments = append(segments, Segment{Header: h})
+	}
+	reader.onFooter = func(f *Footer) {
+		segments[len(segments)-1].Footer = f
+	}
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return segments, nil
+		}
+		if err != nil {
+			if _, malformed := err.(*Error); malformed && len(segments) > 0 {
+				if _, next := reader.next(); next == io.EOF {
+					return segments, nil
+				}
+			}
+			return segments, err
+		}
+		last := &segments[len(segments)-1]
+		last.Rows = append(last.Rows, row)
+	}
+}
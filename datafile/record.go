@@ -0,0 +1,49 @@
+package datafile
+
+import (
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// Schema the schema of the records of the source, as they were acquired
+func (h *Header) Schema(source string) *record.Schema {
+	schema := &record.Schema{}
+	for _, name := range h.Sources[source] {
+		if i := h.Column(name); i >= 0 {
+			c := h.Columns[i]
+			kind := record.Float
+			if c.Kind == Int {
+				kind = record.Int
+			}
+			schema.Add(record.Field{Name: c.Name, Unit: c.Unit, Kind: kind})
+		}
+	}
+	return schema
+}
+
+// Records the rows of the segment as the records acquired, with the values
+// of the fields of their sources only
+func (s Segment) Records() []record.Record {
+	schemas := make(map[string]*record.Schema)
+	records := make([]record.Record, len(s.Rows))
+	for i, row := range s.Rows {
+		schema, ok := schemas[row.Source]
+		if !ok {
+			schema = s.Header.Schema(row.Source)
+			schemas[row.Source] = schema
+		}
+		values := make([]float64, len(schema.Fields))
+		for j, f := range schema.Fields {
+			values[j], _ = s.Header.Value(row, f.Name)
+		}
+		records[i] = record.Record{Source: row.Source, Schema: schema,
+			Time: s.Header.Start.Add(row.Time), Values: values}
+	}
+	return records
+}
+
+// LocalTime the local time of the record in the segment
+func (h *Header) LocalTime(r record.Record) time.Duration {
+	return r.Time.Sub(h.Start)
+}
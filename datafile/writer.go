@@ -0,0 +1,123 @@
+package datafile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// LinkQuality of the link with the Arduino during the run
+type LinkQuality struct {
+	Good            uint64  `json:"good"`
+	BadChecksum     uint64  `json:"badChecksum"`
+	BadFrames       uint64  `json:"badFrames"`
+	Resyncs         uint64  `json:"resyncs"`
+	DroppedBytes    uint64  `json:"droppedBytes"`
+	FramesPerSecond float64 `json:"framesPerSecond"`
+}
+
+// Footer what is known at the end of a run
+type Footer struct {
+	Stop time.Time `json:"stop"`
+	// Records written in the segment
+	Records uint64 `json:"records"`
+	// Dropped records lost because the buffer was full
+	Dropped uint64       `json:"dropped"`
+	Link    *LinkQuality `json:"link,omitempty"`
+	// Suppressed edges of the trackers discarded by their filters
+	Suppressed map[string]uint64 `json:"suppressed,omitempty"`
+	// Errors of the acquisition
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Writer writes a segment; it's the record.Sink of the data file
+type Writer struct {
+	header *Header
+	w      *bufio.Writer
+	// slots for each source the index of its value in each column, -1 if
+	// the source doesn't fill the column
+	slots   map[string][]int
+	records uint64
+	line    []byte
+}
+
+// NewWriter writes the beginning of the segment described by h: the
+// version, the header and the labels of the columns
+func NewWriter(w io.Writer, h *Header) (*Writer, error) {
+	writer := &Writer{header: h, w: bufio.NewWriter(w), slots: make(map[string][]int)}
+	for source, names := range h.Sources {
+		slots := make([]int, len(h.Columns))
+		for i := range slots {
+			slots[i] = -1
+		}
+		for i, name := range names {
+			column := h.Column(name)
+			if column < 0 {
+				return nil, fmt.Errorf("datafile: column %s of %s not declared", name, source)
+			}
+			slots[column] = i
+		}
+		writer.slots[source] = slots
+	}
+	text, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(writer.w, "%s %d\n", Magic, h.Version)
+	fmt.Fprintf(writer.w, "%s%s\n", HeaderPrefix, text)
+	fmt.Fprintf(writer.w, "%s\n", h.Labels())
+	return writer, writer.w.Flush()
+}
+
+// Header of the segment
+func (w *Writer) Header() *Header {
+	return w.header
+}
+
+// Write a row with the record
+func (w *Writer) Write(r record.Record) error {
+	slots, ok := w.slots[r.Source]
+	if !ok {
+		return fmt.Errorf("datafile: source %s not declared", r.Source)
+	}
+	line := append(w.line[:0], r.Source...)
+	line = append(line, w.header.Delimiter...)
+	line = strconv.AppendInt(line, int64(r.Time.Sub(w.header.Start)/time.Microsecond), 10)
+	for column := FirstValue; column < len(slots); column++ {
+		line = append(line, w.header.Delimiter...)
+		if i := slots[column]; i >= 0 && i < len(r.Values) {
+			kind := record.Float
+			if w.header.Columns[column].Kind == Int {
+				kind = record.Int
+			}
+			line = record.AppendValue(line, kind, r.Values[i])
+		}
+	}
+	line = append(line, '\n')
+	w.line = line
+	w.records++
+	_, err := w.w.Write(line)
+	return err
+}
+
+// Flush the rows to the file
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Close ends the segment with the footer; the records are counted by the
+// writer
+func (w *Writer) Close(f Footer) error {
+	f.Records = w.records
+	text, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w.w, "%s%s\n", FooterPrefix, text)
+	return w.w.Flush()
+}
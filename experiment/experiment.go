@@ -0,0 +1,194 @@
+// Package experiment stores the runs of the experiments in the data
+// directory.
+//
+// Each experiment is a directory named as its configuration, and each run a
+// data file in it, numbered in order from 1:
+//
+//	data/cart/run-001.csv
+//	data/cart/run-002.csv
+//
+// so every run has its own file, start time and header. The runs archived
+// and the ones deleted are kept apart in the same way, in the directories
+// .archive and .trash, until they are restored or purged.
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Extension of the data files of the runs
+const Extension = ".csv"
+
+// runPrefix of the names of the files of the runs
+const runPrefix = "run-"
+
+// ErrNoRun the run doesn't exist
+var ErrNoRun = errors.New("experiment: no such run")
+
+// Run a run of an experiment
+type Run struct {
+	Experiment string
+	// Number of the run in the experiment, from 1
+	Number int
+}
+
+// ID identifies the run in the URLs: "cart/2"
+func (r Run) ID() string {
+	return r.Experiment + "/" + strconv.Itoa(r.Number)
+}
+
+// File path of the data file of the run in the data directory
+func (r Run) File() string {
+	return path.Join(r.Experiment, fmt.Sprintf("%s%03d%s", runPrefix, r.Number, Extension))
+}
+
+func (r Run) String() string {
+	return r.ID()
+}
+
+// ParseID the run identified by id, as "cart/2"
+func ParseID(id string) (Run, error) {
+	i := strings.LastIndexByte(id, '/')
+	if i < 0 {
+		return Run{}, ErrNoRun
+	}
+	number, err := strconv.Atoi(id[i+1:])
+	if err != nil || number < 1 || !validName(id[:i]) {
+		return Run{}, ErrNoRun
+	}
+	return Run{Experiment: id[:i], Number: number}, nil
+}
+
+// validName the name can be a directory of the data directory, and
+// nothing else; the hidden ones are the areas
+func validName(name string) bool {
+	return ValidateName(name) == nil
+}
+
+// Experiment the runs of a configuration
+type Experiment struct {
+	Name string
+	// Runs in order
+	Runs []Run
+}
+
+// Store the experiments in a data directory
+type Store struct {
+	Root string
+}
+
+// NewStore returns the store of the experiments in the directory root
+func NewStore(root string) *Store {
+	return &Store{Root: root}
+}
+
+// Path the path of the data file of the run
+func (s *Store) Path(r Run) string {
+	return s.PathIn(Active, r)
+}
+
+// Open opens the data file of the run to read it
+func (s *Store) Open(r Run) (*os.File, error) {
+	f, err := os.Open(s.Path(r))
+	if os.IsNotExist(err) {
+		return nil, ErrNoRun
+	}
+	return f, err
+}
+
+// NewRun creates the data file of a new run of the experiment, numbered
+// after the last one
+func (s *Store) NewRun(experiment string) (Run, *os.File, error) {
+	if err := ValidateName(experiment); err != nil {
+		return Run{}, nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(s.Root, experiment), 0755); err != nil {
+		return Run{}, nil, err
+	}
+	run, err := s.next(experiment)
+	if err != nil {
+		return Run{}, nil, err
+	}
+	// never overwrite a run
+	f, err := os.OpenFile(s.Path(run), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return Run{}, nil, err
+	}
+	return run, f, nil
+}
+
+// Experiments the experiments with their runs, by name
+func (s *Store) Experiments() ([]Experiment, error) {
+	return s.ExperimentsIn(Active)
+}
+
+// ExperimentsIn the experiments with runs in the area, by name
+func (s *Store) ExperimentsIn(a Area) ([]Experiment, error) {
+	entries, err := os.ReadDir(s.dir(a))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var experiments []Experiment
+	for _, e := range entries {
+		if !e.IsDir() || !validName(e.Name()) {
+			continue
+		}
+		runs, err := s.runsIn(a, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			experiments = append(experiments, Experiment{Name: e.Name(), Runs: runs})
+		}
+	}
+	return experiments, nil
+}
+
+// Experiment the experiment called name, with its runs
+func (s *Store) Experiment(name string) (Experiment, error) {
+	if !validName(name) {
+		return Experiment{}, ErrNoRun
+	}
+	runs, err := s.runs(name)
+	if os.IsNotExist(err) || err == nil && len(runs) == 0 {
+		return Experiment{}, ErrNoRun
+	}
+	return Experiment{Name: name, Runs: runs}, err
+}
+
+// runs the runs of the experiment, in order
+func (s *Store) runs(experiment string) ([]Run, error) {
+	return s.runsIn(Active, experiment)
+}
+
+// runsIn the runs of the experiment in the area, in order
+func (s *Store) runsIn(a Area, experiment string) ([]Run, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir(a), experiment))
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, runPrefix) || !strings.HasSuffix(name, Extension) {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, runPrefix), Extension))
+		if err != nil || number < 1 {
+			continue
+		}
+		runs = append(runs, Run{Experiment: experiment, Number: number})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Number < runs[j].Number })
+	return runs, nil
+}
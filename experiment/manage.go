@@ -0,0 +1,178 @@
+package experiment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Area where the runs are kept
+type Area string
+
+// areas of the data directory
+const (
+	// Active the runs of the experiments, in the collect page
+	Active Area = ""
+	// Archive the runs kept apart, not to be deleted
+	Archive Area = ".archive"
+	// Trash the runs deleted, until they are purged
+	Trash Area = ".trash"
+)
+
+// Areas all the areas
+var Areas = []Area{Active, Archive, Trash}
+
+func (a Area) String() string {
+	switch a {
+	case Active:
+		return "active"
+	case Archive:
+		return "archive"
+	case Trash:
+		return "trash"
+	}
+	return string(a)
+}
+
+// ErrExists there's already a run with the same number where it's moved to
+var ErrExists = errors.New("experiment: the run already exists")
+
+// dir the directory of the area
+func (s *Store) dir(a Area) string {
+	return filepath.Join(s.Root, string(a))
+}
+
+// PathIn the path of the data file of the run in the area
+func (s *Store) PathIn(a Area, r Run) string {
+	return filepath.Join(s.dir(a), filepath.FromSlash(r.File()))
+}
+
+// RunIn checks the run is in the area
+func (s *Store) RunIn(a Area, r Run) error {
+	if !validName(r.Experiment) || r.Number < 1 {
+		return ErrNoRun
+	}
+	if _, err := os.Stat(s.PathIn(a, r)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoRun
+		}
+		return err
+	}
+	return nil
+}
+
+// next the run after the last one of the experiment in any area, so a run
+// restored never takes the number of a newer one
+func (s *Store) next(experiment string) (Run, error) {
+	run := Run{Experiment: experiment, Number: 1}
+	for _, a := range Areas {
+		runs, err := s.runsIn(a, experiment)
+		if err != nil && !os.IsNotExist(err) {
+			return Run{}, err
+		}
+		if len(runs) > 0 && runs[len(runs)-1].Number >= run.Number {
+			run.Number = runs[len(runs)-1].Number + 1
+		}
+	}
+	return run, nil
+}
+
+// Move moves the run from an area to another
+func (s *Store) Move(r Run, from, to Area) error {
+	return s.move(r, from, r, to)
+}
+
+func (s *Store) move(r Run, from Area, dst Run, to Area) error {
+	if err := s.RunIn(from, r); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.PathIn(to, dst)); err == nil {
+		return ErrExists
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir(to), dst.Experiment), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(s.PathIn(from, r), s.PathIn(to, dst)); err != nil {
+		return err
+	}
+	s.removeEmpty(from, r.Experiment)
+	return nil
+}
+
+// Rename moves the run of the area to the experiment called name, as its
+// next run
+func (s *Store) Rename(r Run, a Area, name string) (Run, error) {
+	if err := ValidateName(name); err != nil {
+		return Run{}, err
+	}
+	dst, err := s.next(name)
+	if err != nil {
+		return Run{}, err
+	}
+	return dst, s.move(r, a, dst, a)
+}
+
+// Purge removes the run of the trash for ever
+func (s *Store) Purge(r Run) error {
+	if err := s.RunIn(Trash, r); err != nil {
+		return err
+	}
+	if err := os.Remove(s.PathIn(Trash, r)); err != nil {
+		return err
+	}
+	s.removeEmpty(Trash, r.Experiment)
+	return nil
+}
+
+// removeEmpty removes the directory of the experiment without runs
+func (s *Store) removeEmpty(a Area, experiment string) {
+	// Remove fails if it isn't empty
+	os.Remove(filepath.Join(s.dir(a), experiment))
+}
+
+// Legacy the data files of the versions before the experiments, name.csv
+// in the data directory, by name. They are left as they were, not being
+// in the format of the runs, only to be downloaded.
+func (s *Store) Legacy() ([]string, error) {
+	entries, err := os.ReadDir(s.Root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && isLegacy(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// isLegacy the name is the one of a data file of an older version
+func isLegacy(name string) bool {
+	return strings.HasSuffix(name, Extension) && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
+
+// OpenLegacy opens the data file of an older version called name to read
+// it; ErrNoRun if there isn't one
+func (s *Store) OpenLegacy(name string) (*os.File, error) {
+	if !isLegacy(name) {
+		return nil, ErrNoRun
+	}
+	f, err := os.Open(filepath.Join(s.Root, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNoRun
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, ErrNoRun
+	}
+	return f, nil
+}
@@ -0,0 +1,58 @@
+package experiment
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLegacy(t *testing.T) {
+	root := t.TempDir()
+	s := NewStore(root)
+	for _, name := range []string{"abe.csv", "uno.csv", "catalog.json", ".hidden.csv"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// abe has already a run, which isn't a data file of an older version
+	_, f, err := s.NewRun("abe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	names, err := s.Legacy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"abe.csv", "uno.csv"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("data files %v, expected %v", names, expected)
+	}
+	// they stay where they were
+	for _, name := range names {
+		f, err := s.OpenLegacy(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || string(data) != name {
+			t.Errorf("%s: %q, %v", name, data, err)
+		}
+	}
+	for _, name := range []string{"catalog.json", ".hidden.csv", "abe/run-001.csv", "../abe.csv", "none.csv"} {
+		if f, err := s.OpenLegacy(name); err != ErrNoRun {
+			if f != nil {
+				f.Close()
+			}
+			t.Errorf("%s opened as a data file of an older version: %v", name, err)
+		}
+	}
+	experiments, err := s.Experiments()
+	if err != nil || len(experiments) != 1 || len(experiments[0].Runs) != 1 {
+		t.Errorf("experiments %v, %v; expected abe with its run", experiments, err)
+	}
+}
@@ -0,0 +1,117 @@
+package experiment
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxNameLength of the names of the experiments, in characters
+const MaxNameLength = 64
+
+// uniqueLayout of the time added to a name already in use: cart-20161018-053500
+const uniqueLayout = "20060102-150405"
+
+// Reason why a name can't be the name of an experiment
+type Reason int
+
+const (
+	// Empty there isn't any name
+	Empty Reason = iota
+	// TooLong the name has more than MaxNameLength characters
+	TooLong
+	// BadChar the name has a character other than a letter, a digit, "-" or "_"
+	BadChar
+	// BadStart the name doesn't start by a letter or a digit
+	BadStart
+)
+
+var reasons = [...]string{
+	Empty:    "empty",
+	TooLong:  "longer than " + strconv.Itoa(MaxNameLength) + " characters",
+	BadChar:  "only letters, digits, \"-\" and \"_\" are allowed",
+	BadStart: "it must start by a letter or a digit",
+}
+
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(reasons) {
+		return "Reason(" + strconv.Itoa(int(r)) + ")"
+	}
+	return reasons[r]
+}
+
+// NameError the name isn't valid as the name of an experiment
+type NameError struct {
+	Name   string
+	Reason Reason
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("experiment: bad name %q: %s", e.Name, e.Reason)
+}
+
+// CleanName the name without the surrounding blanks, and with "_" instead
+// of the blanks inside: " cart one " is "cart_one"
+func CleanName(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// ValidateName checks that the name can be the name of an experiment, and so
+// the name of a directory of the data directory: the ASCII letters and
+// digits, "-" and "_", starting by a letter or a digit, and up to
+// MaxNameLength characters. The error is a *NameError.
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return &NameError{name, Empty}
+	case len(name) > MaxNameLength:
+		return &NameError{name, TooLong}
+	}
+	for _, c := range name {
+		if !isAlphanumeric(c) && c != '-' && c != '_' {
+			return &NameError{name, BadChar}
+		}
+	}
+	if !isAlphanumeric(rune(name[0])) {
+		return &NameError{name, BadStart}
+	}
+	return nil
+}
+
+func isAlphanumeric(c rune) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// Exists true if the experiment has any run, in any area
+func (s *Store) Exists(name string) (bool, error) {
+	run, err := s.next(name)
+	if err != nil {
+		return false, err
+	}
+	return run.Number > 1, nil
+}
+
+// UniqueName the name if there isn't any experiment with it, or else the
+// name with the time t as suffix, "cart-20161018-053500", so a new
+// configuration never adds its runs to the ones of another one
+func (s *Store) UniqueName(name string, t time.Time) (string, error) {
+	exists, err := s.Exists(name)
+	if err != nil || !exists {
+		return name, err
+	}
+	for n := 1; ; n++ {
+		suffix := "-" + t.Format(uniqueLayout)
+		if n > 1 {
+			suffix += "-" + strconv.Itoa(n)
+		}
+		base := name
+		if len(base)+len(suffix) > MaxNameLength {
+			base = base[:MaxNameLength-len(suffix)]
+		}
+		unique := base + suffix
+		if exists, err = s.Exists(unique); err != nil || !exists {
+			return unique, err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package experiment
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		reason Reason
+		valid  bool
+	}{
+		{"cart", 0, true},
+		{"Cart_2-b", 0, true},
+		{"9cart", 0, true},
+		{strings.Repeat("a", MaxNameLength), 0, true},
+		{"", Empty, false},
+		{strings.Repeat("a", MaxNameLength+1), TooLong, false},
+		{"cart one", BadChar, false},
+		{"carrito/1", BadChar, false},
+		{"..", BadChar, false},
+		{"cañón", BadChar, false},
+		{"-cart", BadStart, false},
+		{"_cart", BadStart, false},
+	} {
+		err := ValidateName(c.name)
+		if c.valid {
+			if err != nil {
+				t.Errorf("%q: %v", c.name, err)
+			}
+			continue
+		}
+		e, ok := err.(*NameError)
+		if !ok || e.Reason != c.reason || e.Name != c.name {
+			t.Errorf("%q: error %v, expected %s", c.name, err, c.reason)
+		}
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	if name := CleanName("  cart  one \t"); name != "cart_one" {
+		t.Errorf("cleaned %q, expected cart_one", name)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	s := NewStore(t.TempDir())
+	at := time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)
+
+	if name, err := s.UniqueName("cart", at); err != nil || name != "cart" {
+		t.Fatalf("new name %q, %v; expected cart", name, err)
+	}
+	// a run of the experiment, even in the trash, takes the name
+	run, f, err := s.NewRun("cart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := s.Move(run, Active, Trash); err != nil {
+		t.Fatal(err)
+	}
+	name, err := s.UniqueName("cart", at)
+	if err != nil || name != "cart-20161018-053500" {
+		t.Fatalf("name %q, %v; expected cart-20161018-053500", name, err)
+	}
+	if _, f, err = s.NewRun(name); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if name, err = s.UniqueName("cart", at); err != nil || name != "cart-20161018-053500-2" {
+		t.Errorf("name %q, %v; expected cart-20161018-053500-2", name, err)
+	}
+
+	// the long names are cut to fit the time
+	long := strings.Repeat("a", MaxNameLength)
+	if _, f, err = s.NewRun(long); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	name, err = s.UniqueName(long, at)
+	if err != nil || len(name) != MaxNameLength || !strings.HasSuffix(name, "-20161018-053500") {
+		t.Errorf("name %q, %v; expected %d characters with the time", name, err, MaxNameLength)
+	}
+	if err := ValidateName(name); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+)
+
+// Metadata the description of a run in the metadata of the export
+type Metadata struct {
+	Run    int              `json:"run"`
+	Header *datafile.Header `json:"header"`
+	// Footer nil if the run didn't end properly
+	Footer *datafile.Footer `json:"footer"`
+}
+
+// WriteMetadata writes the headers and the footers of the runs, in JSON
+func WriteMetadata(w io.Writer, runs []datafile.Segment) error {
+	metadata := make([]Metadata, len(runs))
+	for i, run := range runs {
+		metadata[i] = Metadata{Run: number(i, run), Header: run.Header, Footer: run.Footer}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(metadata)
+}
+
+// WriteBundle writes a zip file with the tables of the runs and their
+// metadata, as name-imu.csv... and name-metadata.json
+func WriteBundle(w io.Writer, name string, runs []datafile.Segment) error {
+	bundle := zip.NewWriter(w)
+	modified := time.Now()
+	if len(runs) > 0 {
+		modified = runs[len(runs)-1].Header.Start
+	}
+	for _, table := range Tables(runs) {
+		f, err := bundle.CreateHeader(&zip.FileHeader{Name: name + "-" + table + ".csv",
+			Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if err := WriteTable(f, runs, table); err != nil {
+			return err
+		}
+	}
+	f, err := bundle.CreateHeader(&zip.FileHeader{Name: name + "-metadata.json",
+		Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if err := WriteMetadata(f, runs); err != nil {
+		return err
+	}
+	return bundle.Close()
+}
@@ -0,0 +1,246 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// The columnar file has the records of each source of each run in a table,
+// with the values of each field together in a typed column:
+//
+//	"OSHC"            magic, 4 bytes
+//	version           uint32, ColumnarVersion
+//	length            uint32, of the directory
+//	directory         JSON: the tables with their columns
+//	columns           the values of the columns, each one at its offset
+//	                  from the end of the directory, 8 bytes aligned
+//
+// All the numbers are little endian. The type of a column of integers, as
+// the times in microseconds, is uint32, or int32 or int64 if they don't fit
+// in it, and float32 the one of reals, as the axes of the IMU. The integers
+// have no null, so a column of them with empty values, NaN, is float64.
+const (
+	ColumnarMagic   = "OSHC"
+	ColumnarVersion = 1
+)
+
+// types of the columns
+const (
+	Uint32  = "uint32"
+	Int32   = "int32"
+	Int64   = "int64"
+	Float32 = "float32"
+	Float64 = "float64"
+)
+
+// ColumnarTable the records of a source in a run
+type ColumnarTable struct {
+	Run     int              `json:"run"`
+	Source  string           `json:"source"`
+	Rows    int              `json:"rows"`
+	Columns []ColumnarColumn `json:"columns"`
+}
+
+// ColumnarColumn the values of a field
+type ColumnarColumn struct {
+	Name   string `json:"name"`
+	Unit   string `json:"unit,omitempty"`
+	Type   string `json:"type"`
+	Offset int64  `json:"offset"`
+	// Values read from the file, converted; not in the directory
+	Values []float64 `json:"-"`
+}
+
+// size in bytes of a value of the type
+func size(t string) int {
+	if t == Int64 || t == Float64 {
+		return 8
+	}
+	return 4
+}
+
+// typeOf the smallest type for the values
+func typeOf(kind record.Kind, values []float64) string {
+	if kind == record.Float {
+		return Float32
+	}
+	min, max := 0.0, 0.0
+	for _, v := range values {
+		if math.IsNaN(v) {
+			return Float64
+		}
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	switch {
+	case min >= 0 && max <= math.MaxUint32:
+		return Uint32
+	case min >= math.MinInt32 && max <= math.MaxInt32:
+		return Int32
+	}
+	return Int64
+}
+
+// columnarTables the tables of the runs, with the values of their columns
+func columnarTables(runs []datafile.Segment) []ColumnarTable {
+	var tables []ColumnarTable
+	for n, run := range runs {
+		bySource := make(map[string]int)
+		for _, r := range run.Records() {
+			i, ok := bySource[r.Source]
+			if !ok {
+				i = len(tables)
+				bySource[r.Source] = i
+				table := ColumnarTable{Run: number(n, run), Source: r.Source}
+				table.Columns = append(table.Columns, ColumnarColumn{Name: datafile.TimeColumn, Unit: "us"})
+				for _, f := range r.Schema.Fields {
+					table.Columns = append(table.Columns, ColumnarColumn{Name: f.Name, Unit: f.Unit})
+				}
+				tables = append(tables, table)
+			}
+			table := &tables[i]
+			table.Rows++
+			table.Columns[0].Values = append(table.Columns[0].Values,
+				float64(run.Header.LocalTime(r).Microseconds()))
+			for j := range r.Schema.Fields {
+				table.Columns[j+1].Values = append(table.Columns[j+1].Values, r.Values[j])
+			}
+		}
+		// the types of the columns of the run
+		for _, i := range bySource {
+			table := &tables[i]
+			schema := run.Header.Schema(table.Source)
+			table.Columns[0].Type = typeOf(record.Int, table.Columns[0].Values)
+			for j, f := range schema.Fields {
+				table.Columns[j+1].Type = typeOf(f.Kind, table.Columns[j+1].Values)
+			}
+		}
+	}
+	return tables
+}
+
+// WriteColumnar writes the records of the runs in the columnar file
+func WriteColumnar(w io.Writer, runs []datafile.Segment) error {
+	tables := columnarTables(runs)
+	var offset int64
+	for i := range tables {
+		for j := range tables[i].Columns {
+			c := &tables[i].Columns[j]
+			c.Offset = offset
+			offset += int64(tables[i].Rows * size(c.Type))
+			offset = (offset + 7) &^ 7
+		}
+	}
+	directory, err := json.Marshal(tables)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	out.WriteString(ColumnarMagic)
+	binary.Write(out, binary.LittleEndian, uint32(ColumnarVersion))
+	binary.Write(out, binary.LittleEndian, uint32(len(directory)))
+	out.Write(directory)
+	var written int64
+	buf := make([]byte, 8)
+	for _, table := range tables {
+		for _, c := range table.Columns {
+			for ; written < c.Offset; written++ {
+				out.WriteByte(0)
+			}
+			for _, v := range c.Values {
+				n := size(c.Type)
+				putValue(buf, c.Type, v)
+				if _, err := out.Write(buf[:n]); err != nil {
+					return err
+				}
+				written += int64(n)
+			}
+		}
+	}
+	return out.Flush()
+}
+
+func putValue(b []byte, t string, v float64) {
+	switch t {
+	case Uint32:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	case Int32:
+		binary.LittleEndian.PutUint32(b, uint32(int32(v)))
+	case Int64:
+		binary.LittleEndian.PutUint64(b, uint64(int64(v)))
+	case Float32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+	case Float64:
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	}
+}
+
+func value(b []byte, t string) float64 {
+	switch t {
+	case Uint32:
+		return float64(binary.LittleEndian.Uint32(b))
+	case Int32:
+		return float64(int32(binary.LittleEndian.Uint32(b)))
+	case Int64:
+		return float64(int64(binary.LittleEndian.Uint64(b)))
+	case Float64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+}
+
+// ErrNotColumnar the file isn't a columnar file
+var ErrNotColumnar = errors.New("export: not a columnar file")
+
+// ReadColumnar reads the tables of a columnar file, with their values
+func ReadColumnar(r io.Reader) ([]ColumnarTable, error) {
+	var head struct {
+		Magic   [4]byte
+		Version uint32
+		Length  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &head); err != nil {
+		return nil, err
+	}
+	if string(head.Magic[:]) != ColumnarMagic {
+		return nil, ErrNotColumnar
+	}
+	if head.Version != ColumnarVersion {
+		return nil, fmt.Errorf("export: columnar version %d not supported", head.Version)
+	}
+	directory := make([]byte, head.Length)
+	if _, err := io.ReadFull(r, directory); err != nil {
+		return nil, err
+	}
+	var tables []ColumnarTable
+	if err := json.Unmarshal(directory, &tables); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tables {
+		for j := range tables[i].Columns {
+			c := &tables[i].Columns[j]
+			n := size(c.Type)
+			if c.Offset < 0 || c.Offset+int64(tables[i].Rows*n) > int64(len(data)) {
+				return nil, fmt.Errorf("export: column %s of %s out of the file", c.Name, tables[i].Source)
+			}
+			c.Values = make([]float64, tables[i].Rows)
+			for k := range c.Values {
+				at := c.Offset + int64(k*n)
+				c.Values[k] = value(data[at:at+int64(n)], c.Type)
+			}
+		}
+	}
+	return tables, nil
+}
@@ -0,0 +1,103 @@
+package export
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// columnarRun a run of the arduino, without the distance in a record, and
+// of the tracker A
+func columnarRun() datafile.Segment {
+	arduino := &record.Schema{}
+	arduino.Add(record.Field{Name: "sensorTime", Unit: "us", Kind: record.Int},
+		record.Field{Name: "accX", Unit: "g", Kind: record.Float},
+		record.Field{Name: "distance", Unit: "mm", Kind: record.Int},
+		record.Field{Name: "offset", Kind: record.Int})
+	tracker := &record.Schema{}
+	tracker.Add(record.Field{Name: "level", Kind: record.Int})
+
+	h := datafile.NewHeader("cart", time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC))
+	h.Run = 2
+	h.AddSource("Ard", arduino)
+	h.AddSource("A", tracker)
+	nan := math.NaN()
+	us := func(n int64) time.Duration { return time.Duration(n) * time.Microsecond }
+	return datafile.Segment{Header: h, Rows: []datafile.Row{
+		{Source: "Ard", Time: us(40849), Values: []float64{5000000000, -1.5, 95, -3, nan}},
+		{Source: "A", Time: us(1354699), Values: []float64{nan, nan, nan, nan, 1}},
+		{Source: "Ard", Time: us(80849), Values: []float64{5000040000, 0.25, nan, 7, nan}},
+	}}
+}
+
+func TestColumnarRoundTrip(t *testing.T) {
+	var file bytes.Buffer
+	if err := WriteColumnar(&file, []datafile.Segment{columnarRun()}); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := ReadColumnar(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("%d tables, expected 2", len(tables))
+	}
+
+	nan := math.NaN()
+	for _, expected := range []struct {
+		source  string
+		columns []ColumnarColumn
+	}{
+		{"Ard", []ColumnarColumn{
+			{Name: "localTime", Unit: "us", Type: Uint32, Values: []float64{40849, 80849}},
+			{Name: "sensorTime", Unit: "us", Type: Int64, Values: []float64{5000000000, 5000040000}},
+			{Name: "accX", Unit: "g", Type: Float32, Values: []float64{-1.5, 0.25}},
+			// the integers with an empty value
+			{Name: "distance", Unit: "mm", Type: Float64, Values: []float64{95, nan}},
+			{Name: "offset", Type: Int32, Values: []float64{-3, 7}},
+		}},
+		{"A", []ColumnarColumn{
+			{Name: "localTime", Unit: "us", Type: Uint32, Values: []float64{1354699}},
+			{Name: "level", Type: Uint32, Values: []float64{1}},
+		}},
+	} {
+		var table *ColumnarTable
+		for i := range tables {
+			if tables[i].Source == expected.source {
+				table = &tables[i]
+			}
+		}
+		if table == nil {
+			t.Errorf("no table of %s", expected.source)
+			continue
+		}
+		if table.Run != 2 || table.Rows != len(expected.columns[0].Values) || len(table.Columns) != len(expected.columns) {
+			t.Errorf("table of %s: run %d, %d rows and %d columns", expected.source, table.Run, table.Rows, len(table.Columns))
+			continue
+		}
+		for j, c := range table.Columns {
+			e := expected.columns[j]
+			if c.Name != e.Name || c.Unit != e.Unit || c.Type != e.Type {
+				t.Errorf("%s: column %s(%s) %s, expected %s(%s) %s", expected.source, c.Name, c.Unit, c.Type, e.Name, e.Unit, e.Type)
+			}
+			if c.Offset%8 != 0 {
+				t.Errorf("%s: column %s at %d, not aligned", expected.source, c.Name, c.Offset)
+			}
+			for k, v := range c.Values {
+				if v != e.Values[k] && !(math.IsNaN(v) && math.IsNaN(e.Values[k])) {
+					t.Errorf("%s: %s[%d] %v, expected %v", expected.source, c.Name, k, v, e.Values[k])
+				}
+			}
+		}
+	}
+}
+
+func TestReadColumnarNotColumnar(t *testing.T) {
+	if _, err := ReadColumnar(bytes.NewReader([]byte("OSHIWASP-DATA 1\n"))); err != ErrNotColumnar {
+		t.Errorf("error %v, expected %v", err, ErrNotColumnar)
+	}
+}
@@ -0,0 +1,301 @@
+// Package export writes the runs of a data file as tidy tables, one for
+// each kind of sensor, ready for a spreadsheet.
+//
+// Every table has a header line with the labels of its columns and one row
+// for each reading, beginning with the number of the run and the local
+// time in microseconds:
+//
+//	imu       the accelerometer, the gyroscope and the temperature
+//	distance  the distance sensor
+//	analog    the analog channels of the ESP32
+//	events    the edges of the trackers A to D and the firings of the
+//	          tracker M, in order of time
+//
+// and the kinematics of the runs with the setup of the photogates, the
+// transit times, velocities and accelerations of the cart through the
+// trackers A to D with their uncertainties, a row for each one:
+//
+//	run;quantity;gates;localTime(us);value;uncertainty;unit
+//	1;interval;AB;1739675;0.767748;0.00014;s
+//
+// The metadata are the headers and the footers of the runs, in JSON, and
+// the bundle is a zip file with all of them.
+//
+// For the notebooks, the records of the runs are exported as well as JSON
+// Lines, and in a columnar binary file with typed columns.
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// Delimiter between the values of the tables, as in the data file
+const Delimiter = ';'
+
+// names of the tables
+const (
+	IMU      = "imu"
+	Distance = "distance"
+	Analog   = "analog"
+	Events   = "events"
+	// Kinematics the analysis of the photogates
+	Kinematics = "kinematics"
+)
+
+// columns of the tables
+const (
+	RunColumn     = "run"
+	TrackerColumn = "tracker"
+)
+
+// names of the columns of the data file used by the tables
+const (
+	sensorTime  = "sensorTime"
+	trackerTime = "trackerTime"
+	sync        = "sync"
+	level       = "level"
+)
+
+// trackerM name of the tracker of the cart in the events table
+const trackerM = "M"
+
+// table the columns of the data file a table of values has
+type table struct {
+	name    string
+	matches func(column string) bool
+}
+
+var valueTables = []table{
+	{IMU, func(c string) bool {
+		switch c {
+		case "accX", "accY", "accZ", "gyrX", "gyrY", "gyrZ", "temperature":
+			return true
+		}
+		return false
+	}},
+	{Distance, func(c string) bool { return c == "distance" }},
+	{Analog, func(c string) bool { return strings.HasPrefix(c, "analog") }},
+}
+
+// Tables the names of the tables with data in the runs
+func Tables(runs []datafile.Segment) []string {
+	var names []string
+	for _, t := range valueTables {
+		if len(t.columns(runs)) > 0 {
+			names = append(names, t.name)
+		}
+	}
+	for _, run := range runs {
+		if hasEvents(run.Header) {
+			names = append(names, Events)
+			break
+		}
+	}
+	for _, run := range runs {
+		if hasKinematics(run) {
+			return append(names, Kinematics)
+		}
+	}
+	return names
+}
+
+// WriteTable writes the table called name
+func WriteTable(w io.Writer, runs []datafile.Segment, name string) error {
+	switch name {
+	case Events:
+		return writeEvents(w, runs)
+	case Kinematics:
+		return writeKinematics(w, runs)
+	}
+	for _, t := range valueTables {
+		if t.name == name {
+			return t.write(w, runs)
+		}
+	}
+	return fmt.Errorf("export: no table %s", name)
+}
+
+// columns of the table in the runs, in order of appearance, with the time
+// of the sensor first if any
+func (t table) columns(runs []datafile.Segment) []datafile.Column {
+	var columns []datafile.Column
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		for _, c := range run.Header.Columns {
+			if t.matches(c.Name) && !seen[c.Name] {
+				seen[c.Name] = true
+				columns = append(columns, c)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	for _, run := range runs {
+		if i := run.Header.Column(sensorTime); i >= 0 {
+			return append([]datafile.Column{run.Header.Columns[i]}, columns...)
+		}
+	}
+	return columns
+}
+
+func (t table) write(w io.Writer, runs []datafile.Segment) error {
+	columns := t.columns(runs)
+	out := newWriter(w)
+	labels := []string{RunColumn, timeLabel()}
+	for _, c := range columns {
+		labels = append(labels, c.Label())
+	}
+	out.Write(labels)
+	for n, run := range runs {
+		// the sources with values of the table in the run
+		sources := make(map[string]bool)
+		for source, names := range run.Header.Sources {
+			for _, name := range names {
+				if t.matches(name) {
+					sources[source] = true
+				}
+			}
+		}
+		for _, row := range run.Rows {
+			if !sources[row.Source] {
+				continue
+			}
+			cells := []string{strconv.Itoa(number(n, run)), micros(row)}
+			for _, c := range columns {
+				v, _ := run.Header.Value(row, c.Name)
+				cells = append(cells, format(c, v))
+			}
+			out.Write(cells)
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Event an edge of a tracker, or a firing of the tracker M
+type Event struct {
+	Run     int
+	Tracker string
+	// Time local time of the event
+	Time time.Duration
+	// TrackerTime time of the arduino when the tracker M fired, and Level
+	// after the edge of a tracker; NaN if unknown
+	TrackerTime float64
+	Level       float64
+	// Interval since the previous event of the run, of any tracker, and
+	// since the previous one of the same tracker; 0 for the first ones
+	Interval time.Duration
+	Period   time.Duration
+}
+
+// hasEvents the run has trackers or the tracker M
+func hasEvents(h *datafile.Header) bool {
+	for source := range h.Sources {
+		if isTracker(source) {
+			return true
+		}
+	}
+	return h.Column(sync) >= 0
+}
+
+// isTracker the source is a tracker of the base: "A" to "D"
+func isTracker(source string) bool {
+	return len(source) == 1 && source >= "A" && source <= "D"
+}
+
+// TrackerEvents the events of the trackers in the runs, in order of time,
+// with the intervals between them
+func TrackerEvents(runs []datafile.Segment) []Event {
+	var events []Event
+	for n, run := range runs {
+		first := len(events)
+		for _, row := range run.Rows {
+			if isTracker(row.Source) {
+				l, _ := run.Header.Value(row, level)
+				events = append(events, Event{Run: number(n, run), Tracker: row.Source, Time: row.Time,
+					TrackerTime: math.NaN(), Level: l})
+				continue
+			}
+			// the first record after the tracker M fired has the sync set
+			if s, ok := run.Header.Value(row, sync); ok && s == 1 {
+				t, _ := run.Header.Value(row, trackerTime)
+				events = append(events, Event{Run: number(n, run), Tracker: trackerM, Time: row.Time,
+					TrackerTime: t, Level: math.NaN()})
+			}
+		}
+		// the readers of the trackers write concurrently
+		runEvents := events[first:]
+		sort.SliceStable(runEvents, func(i, j int) bool {
+			return runEvents[i].Time < runEvents[j].Time
+		})
+		last := make(map[string]time.Duration)
+		for i := range runEvents {
+			e := &runEvents[i]
+			if i > 0 {
+				e.Interval = e.Time - runEvents[i-1].Time
+			}
+			if t, ok := last[e.Tracker]; ok {
+				e.Period = e.Time - t
+			}
+			last[e.Tracker] = e.Time
+		}
+	}
+	return events
+}
+
+func writeEvents(w io.Writer, runs []datafile.Segment) error {
+	out := newWriter(w)
+	out.Write([]string{RunColumn, TrackerColumn, timeLabel(), trackerTime + "(us)", level})
+	for _, e := range TrackerEvents(runs) {
+		out.Write([]string{strconv.Itoa(e.Run), e.Tracker, strconv.FormatInt(e.Time.Microseconds(), 10),
+			format(datafile.Column{Kind: datafile.Int}, e.TrackerTime),
+			format(datafile.Column{Kind: datafile.Int}, e.Level)})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// number the number of the run n of the runs exported
+func number(n int, run datafile.Segment) int {
+	if run.Header.Run > 0 {
+		return run.Header.Run
+	}
+	return n + 1
+}
+
+func newWriter(w io.Writer) *csv.Writer {
+	out := csv.NewWriter(w)
+	out.Comma = Delimiter
+	return out
+}
+
+func timeLabel() string {
+	return datafile.Column{Name: datafile.TimeColumn, Unit: "us"}.Label()
+}
+
+func micros(row datafile.Row) string {
+	return strconv.FormatInt(row.Time.Microseconds(), 10)
+}
+
+// format the value as in the data file, empty if unknown
+func format(c datafile.Column, v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	kind := record.Float
+	if c.Kind == datafile.Int {
+		kind = record.Int
+	}
+	return string(record.AppendValue(nil, kind, v))
+}
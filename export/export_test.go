@@ -0,0 +1,181 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// cartRun a run of the arduino with the tracker M, and of the tracker A
+// with the levels of its edges
+func cartRun() datafile.Segment {
+	arduino := &record.Schema{}
+	arduino.Add(record.Field{Name: "sensorTime", Unit: "us", Kind: record.Int},
+		record.Field{Name: "trackerTime", Unit: "us", Kind: record.Int},
+		record.Field{Name: "sync", Kind: record.Int},
+		record.Field{Name: "distance", Unit: "mm", Kind: record.Int},
+		record.Field{Name: "accX", Unit: "g", Kind: record.Float})
+	tracker := &record.Schema{}
+	tracker.Add(record.Field{Name: "level", Kind: record.Int})
+
+	h := datafile.NewHeader("cart", time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC))
+	h.Run = 3
+	h.AddSource("Ard", arduino)
+	h.AddSource("A", tracker)
+	nan := math.NaN()
+	us := func(n int64) time.Duration { return time.Duration(n) * time.Microsecond }
+	return datafile.Segment{Header: h, Rows: []datafile.Row{
+		{Source: "Ard", Time: us(40849), Values: []float64{286078321, 0, 0, 95, -1.000891, nan}},
+		{Source: "A", Time: us(1354699), Values: []float64{nan, nan, nan, nan, nan, 1}},
+		{Source: "Ard", Time: us(1380849), Values: []float64{287418321, 287390000, 1, nan, 0.25, nan}},
+		{Source: "A", Time: us(1404699), Values: []float64{nan, nan, nan, nan, nan, 0}},
+	}}
+}
+
+// readTable reads a table written with the delimiter of the exports
+func readTable(t *testing.T, r io.Reader) [][]string {
+	in := csv.NewReader(r)
+	in.Comma = Delimiter
+	rows, err := in.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestTables(t *testing.T) {
+	runs := []datafile.Segment{cartRun()}
+	if tables := Tables(runs); !reflect.DeepEqual(tables, []string{IMU, Distance, Events}) {
+		t.Errorf("tables %v, expected imu, distance and events", tables)
+	}
+	for _, c := range []struct {
+		table string
+		rows  [][]string
+	}{
+		{IMU, [][]string{
+			{"run", "localTime(us)", "sensorTime(us)", "accX(g)"},
+			{"3", "40849", "286078321", "-1.000891"},
+			{"3", "1380849", "287418321", "0.250000"},
+		}},
+		// the records without distance are in the table, empty
+		{Distance, [][]string{
+			{"run", "localTime(us)", "sensorTime(us)", "distance(mm)"},
+			{"3", "40849", "286078321", "95"},
+			{"3", "1380849", "287418321", ""},
+		}},
+		{Events, [][]string{
+			{"run", "tracker", "localTime(us)", "trackerTime(us)", "level"},
+			{"3", "A", "1354699", "", "1"},
+			{"3", "M", "1380849", "287390000", ""},
+			{"3", "A", "1404699", "", "0"},
+		}},
+	} {
+		var table bytes.Buffer
+		if err := WriteTable(&table, runs, c.table); err != nil {
+			t.Fatal(err)
+		}
+		if rows := readTable(t, &table); !reflect.DeepEqual(rows, c.rows) {
+			t.Errorf("table %s:\n%q\nexpected\n%q", c.table, rows, c.rows)
+		}
+	}
+	if err := WriteTable(io.Discard, runs, Analog); err != nil {
+		t.Errorf("analog table of a run without it: %v", err)
+	}
+	if err := WriteTable(io.Discard, runs, "gps"); err == nil {
+		t.Error("unknown table written")
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	runs := []datafile.Segment{cartRun()}
+	var bundle bytes.Buffer
+	if err := WriteBundle(&bundle, "cart-3", runs); err != nil {
+		t.Fatal(err)
+	}
+	files, err := zip.NewReader(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var metadataFile []byte
+	for _, f := range files.File {
+		names = append(names, f.Name)
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the same as exported alone
+		var expected bytes.Buffer
+		if strings.HasSuffix(f.Name, ".csv") {
+			err = WriteTable(&expected, runs, strings.TrimSuffix(strings.TrimPrefix(f.Name, "cart-3-"), ".csv"))
+		} else {
+			metadataFile = content
+			err = WriteMetadata(&expected, runs)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, expected.Bytes()) {
+			t.Errorf("%s:\n%s\nexpected\n%s", f.Name, content, expected.Bytes())
+		}
+	}
+	expected := []string{"cart-3-imu.csv", "cart-3-distance.csv", "cart-3-events.csv", "cart-3-metadata.json"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("files %v, expected %v", names, expected)
+	}
+
+	var metadata []Metadata
+	if err := json.Unmarshal(metadataFile, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 || metadata[0].Run != 3 || metadata[0].Header.Configuration != "cart" || metadata[0].Footer != nil {
+		t.Errorf("metadata %+v, expected the header of the run 3 of cart without footer", metadata)
+	}
+}
+
+func TestWriteJSONLines(t *testing.T) {
+	var lines bytes.Buffer
+	if err := WriteJSONLines(&lines, []datafile.Segment{cartRun()}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]interface{}{
+		{"run": 3.0, "source": "Ard", "localTime": 40849.0, "sensorTime": 286078321.0,
+			"trackerTime": 0.0, "sync": 0.0, "distance": 95.0, "accX": -1.000891},
+		{"run": 3.0, "source": "A", "localTime": 1354699.0, "level": 1.0},
+		{"run": 3.0, "source": "Ard", "localTime": 1380849.0, "sensorTime": 287418321.0,
+			"trackerTime": 287390000.0, "sync": 1.0, "distance": nil, "accX": 0.25},
+		{"run": 3.0, "source": "A", "localTime": 1404699.0, "level": 0.0},
+	}
+	decoder := json.NewDecoder(&lines)
+	for i := 0; ; i++ {
+		var object map[string]interface{}
+		err := decoder.Decode(&object)
+		if err == io.EOF {
+			if i != len(expected) {
+				t.Errorf("%d records, expected %d", i, len(expected))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(expected) && !reflect.DeepEqual(object, expected[i]) {
+			t.Errorf("record %d: %v, expected %v", i, object, expected[i])
+		}
+	}
+}
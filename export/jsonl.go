@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// WriteJSONLines writes the records of the runs as JSON Lines, an object
+// for each record with its run, source, local time in microseconds and the
+// fields of its source, in order:
+//
+//	{"run":1,"source":"Ard","localTime":40849,"sensorTime":286078321,"distance":95,...}
+//	{"run":1,"source":"A","localTime":1354699}
+func WriteJSONLines(w io.Writer, runs []datafile.Segment) error {
+	out := bufio.NewWriter(w)
+	var line []byte
+	for n, run := range runs {
+		for _, r := range run.Records() {
+			line = append(line[:0], `{"run":`...)
+			line = strconv.AppendInt(line, int64(number(n, run)), 10)
+			line = append(line, `,"source":`...)
+			line = strconv.AppendQuote(line, r.Source)
+			line = append(line, `,"`+datafile.TimeColumn+`":`...)
+			line = strconv.AppendInt(line, run.Header.LocalTime(r).Microseconds(), 10)
+			for i, f := range r.Schema.Fields {
+				line = append(line, ',')
+				line = strconv.AppendQuote(line, f.Name)
+				line = append(line, ':')
+				if math.IsNaN(r.Values[i]) {
+					line = append(line, "null"...)
+				} else {
+					line = record.AppendValue(line, f.Kind, r.Values[i])
+				}
+			}
+			line = append(line, "}\n"...)
+			if _, err := out.Write(line); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Flush()
+}
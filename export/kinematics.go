@@ -0,0 +1,65 @@
+package export
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/kinematics"
+)
+
+// columns of the kinematics table
+const (
+	QuantityColumn    = "quantity"
+	GatesColumn       = "gates"
+	ValueColumn       = "value"
+	UncertaintyColumn = "uncertainty"
+	UnitColumn        = "unit"
+)
+
+// quantities of the kinematics table
+const (
+	transitQuantity      = "transit"
+	velocityQuantity     = "velocity"
+	intervalQuantity     = "interval"
+	accelerationQuantity = "acceleration"
+)
+
+// hasKinematics the run has the setup of the photogates and crosses any
+func hasKinematics(run datafile.Segment) bool {
+	result, ok := kinematics.Analyze(run)
+	return ok && len(result.Crossings) > 0
+}
+
+// writeKinematics writes the kinematics of the runs with the setup of the
+// photogates, a row for each quantity with the local time it refers to
+func writeKinematics(w io.Writer, runs []datafile.Segment) error {
+	out := newWriter(w)
+	out.Write([]string{RunColumn, QuantityColumn, GatesColumn, timeLabel(), ValueColumn, UncertaintyColumn, UnitColumn})
+	for n, run := range runs {
+		result, ok := kinematics.Analyze(run)
+		if !ok {
+			continue
+		}
+		row := func(quantity, gates string, t time.Duration, m kinematics.Measure, unit string) {
+			out.Write([]string{strconv.Itoa(number(n, run)), quantity, gates, strconv.FormatInt(t.Microseconds(), 10),
+				strconv.FormatFloat(m.Value, 'g', 6, 64), strconv.FormatFloat(m.Error, 'g', 2, 64), unit})
+		}
+		for _, c := range result.Crossings {
+			if c.Transit.Value > 0 {
+				row(transitQuantity, c.Gate, c.Time, c.Transit, "s")
+				row(velocityQuantity, c.Gate, c.Middle(), c.Velocity, "m/s")
+			}
+		}
+		for _, i := range result.Intervals {
+			row(intervalQuantity, i.Gates, i.Time, i.Duration, "s")
+			row(velocityQuantity, i.Gates, i.Time, i.Velocity, "m/s")
+		}
+		for _, a := range result.Accelerations {
+			row(accelerationQuantity, a.Gates, a.Time, a.Acceleration, "m/s2")
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,22 @@
+package frame
+
+// ChecksumSize bytes of the checksum trailer
+const ChecksumSize = 2
+
+// Checksum CRC-16/CCITT (polynomial 0x1021, initial value 0xffff) of
+// payload, as computed by the firmware. It travels little endian between
+// the payload and the end mark, escaped as the payload when escaping is on.
+func Checksum(payload []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range payload {
+		crc ^= uint16(b) << 8
+		for k := 0; k < 8; k++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
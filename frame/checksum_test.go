@@ -0,0 +1,57 @@
+package frame
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	// check values of CRC-16/CCITT-FALSE, the crc16 of the firmware
+	for _, c := range []struct {
+		data string
+		sum  uint16
+	}{
+		{"", 0xffff},
+		{"123456789", 0x29b1},
+		{"A", 0xb915},
+	} {
+		if sum := Checksum([]byte(c.data)); sum != c.sum {
+			t.Errorf("checksum of %q 0x%04x, expected 0x%04x", c.data, sum, c.sum)
+		}
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+	for _, escaped := range []bool{false, true} {
+		good := Encode(&sample, escaped, true)
+		corrupted := Encode(&sample, escaped, true)
+		// a bit of the sensor time, never escaped
+		corrupted[6] ^= 0x01
+		stream := append(corrupted, good...)
+
+		d := NewDecoder(bytes.NewReader(stream))
+		d.Escaped, d.Checksum = escaped, true
+		var decoded []SensorData
+		for {
+			data, err := d.Decode()
+			if err == io.EOF {
+				break
+			}
+			if _, bad := err.(*Error); bad {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("escaped %v: %v", escaped, err)
+			}
+			decoded = append(decoded, data)
+		}
+		if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], sample) {
+			t.Errorf("escaped %v: decoded %+v, expected only %+v", escaped, decoded, sample)
+		}
+		if stats := d.Stats(); stats.Good != 1 || stats.BadChecksum != 1 {
+			t.Errorf("escaped %v: stats %s, expected 1 good frame and 1 bad checksum", escaped, stats)
+		}
+	}
+}
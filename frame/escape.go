@@ -0,0 +1,56 @@
+package frame
+
+import "fmt"
+
+// escaped bytes and the code which follows the escape mark in their place
+var escapeCodes = map[byte]byte{
+	0x7d: 0x00,
+	0x24: 0x03,
+	0x11: 0x04,
+	0x13: 0x05,
+}
+
+// Escape returns payload with the bytes equal to the end mark, the escape
+// mark, XON and XOFF replaced by an escape mark and a code
+func Escape(payload []byte) []byte {
+	escaped := make([]byte, 0, 2*len(payload))
+	for _, b := range payload {
+		if code, ok := escapeCodes[b]; ok {
+			escaped = append(escaped, EscapeMark, code)
+		} else {
+			escaped = append(escaped, b)
+		}
+	}
+	return escaped
+}
+
+// Unescape undoes Escape. An unknown code after an escape mark gives an
+// *Error.
+func Unescape(escaped []byte) ([]byte, error) {
+	payload := make([]byte, 0, len(escaped))
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != EscapeMark {
+			payload = append(payload, escaped[i])
+			continue
+		}
+		i++
+		if i == len(escaped) {
+			return nil, &Error{"escape mark at the end of the frame"}
+		}
+		b, ok := unescapeCode(escaped[i])
+		if !ok {
+			return nil, &Error{fmt.Sprintf("unknown escape code 0x%02x", escaped[i])}
+		}
+		payload = append(payload, b)
+	}
+	return payload, nil
+}
+
+func unescapeCode(code byte) (byte, bool) {
+	for b, c := range escapeCodes {
+		if c == code {
+			return b, true
+		}
+	}
+	return 0, false
+}
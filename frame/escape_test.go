@@ -0,0 +1,82 @@
+package frame
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	payload := []byte{0x01, 0x7d, 0x24, 0x11, 0x13, 0x23, 0x40}
+	expected := []byte{0x01, 0x7d, 0x00, 0x7d, 0x03, 0x7d, 0x04, 0x7d, 0x05, 0x23, 0x40}
+
+	escaped := Escape(payload)
+	if !bytes.Equal(escaped, expected) {
+		t.Errorf("escaped % x, expected % x", escaped, expected)
+	}
+	if bytes.IndexByte(escaped, EndMark) >= 0 {
+		t.Errorf("end mark in % x", escaped)
+	}
+	unescaped, err := Unescape(escaped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unescaped, payload) {
+		t.Errorf("unescaped % x, expected % x", unescaped, payload)
+	}
+}
+
+func TestUnescapeErrors(t *testing.T) {
+	for _, escaped := range [][]byte{
+		{0x01, 0x7d},
+		{0x7d, 0x7d},
+		{0x7d, 0x06, 0x01},
+	} {
+		if _, err := Unescape(escaped); err == nil {
+			t.Errorf("% x unescaped without error", escaped)
+		} else if _, ok := err.(*Error); !ok {
+			t.Errorf("% x: error %v isn't an *Error", escaped, err)
+		}
+	}
+}
+
+func TestDecodeEscaped(t *testing.T) {
+	// the end mark in the payload of the sample is escaped, so a frame cut
+	// short runs up to the end mark of the next one, and both are discarded
+	// as a bad frame
+	cut := Encode(&sample, true, false)
+	cut = cut[:len(cut)/2]
+	stream := append(Encode(&sample, true, false), cut...)
+	for i := 0; i < 2; i++ {
+		stream = append(stream, Encode(&sample, true, false)...)
+	}
+
+	d := NewDecoder(bytes.NewReader(stream))
+	d.Escaped = true
+	var decoded []SensorData
+	for {
+		data, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if _, bad := err.(*Error); bad {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, data)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("%d frames decoded, expected 2", len(decoded))
+	}
+	for _, data := range decoded {
+		if !reflect.DeepEqual(data, sample) {
+			t.Errorf("decoded %+v, expected %+v", data, sample)
+		}
+	}
+	if stats := d.Stats(); stats.BadFrames != 1 {
+		t.Errorf("stats %s, expected 1 bad frame", stats)
+	}
+}
@@ -0,0 +1,300 @@
+// Package frame decodes the binary records sent by the Arduino of the
+// mobile sensor platform.
+//
+// Every record travels as a fixed size frame:
+//
+//	offset  size  content
+//	     0     1  start mark '#', or '@' (sync mark)
+//	     1     4  tracker time (us), uint32 little endian
+//	     5     4  sensor time (us), uint32 little endian
+//	     9     4  distance (mm), uint32 little endian
+//	    13    12  accX, accY, accZ (g), float32 little endian
+//	    25    12  gyrX, gyrY, gyrZ (gr/s), float32 little endian
+//	    37     1  end mark '$'
+//
+// Optionally the firmware adds a checksum trailer of ChecksumSize bytes
+// between the payload and the end mark (see Checksum); the end mark is then
+// at offset 39.
+//
+// The first frame sent after the tracker of the mobile platform fires starts
+// with the sync mark instead of the start mark; it is decoded the same way
+// and flagged in SensorData.Sync.
+//
+// The payload is binary, so any of its bytes may be equal to the start or
+// end marks. The Decoder therefore never splits on the marks: it looks for
+// a start mark, takes a whole frame and checks that the end mark is where
+// it must be. When it is not, the frame is reported as bad and the search
+// starts again on the byte following the false start mark.
+//
+// The firmware can also escape the bytes between the marks (see Escape), so
+// that the end mark only appears at the end of a frame. An escaped stream is
+// split on the end marks and unescaped; a frame of the wrong length is
+// reported as bad and the next one starts after its end mark.
+package frame
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// StartMark first byte of a frame
+	StartMark = '\x23' // '#'
+	// SyncMark first byte of the first frame after the tracker fired
+	SyncMark = '\x40' // '@'
+	// EndMark last byte of a frame
+	EndMark = '\x24' // '$'
+
+	// PayloadSize bytes between the start and the end marks
+	PayloadSize = 36
+	// Size bytes of a whole frame, marks included
+	Size = PayloadSize + 2
+
+	// EscapeMark first byte of an escaped pair
+	EscapeMark = '\x7d'
+)
+
+// SensorData data for sensors in Arduino in numerical data types
+type SensorData struct {
+	TrackerMicroSeconds uint32
+	SensorMicroSeconds  uint32
+	Distance            uint32
+	AccX                float32
+	AccY                float32
+	AccZ                float32
+	GyrX                float32
+	GyrY                float32
+	GyrZ                float32
+	// Sync the frame started with SyncMark
+	Sync bool
+	// Temperature (C) and Analog channels (mV), only sent by the ESP32
+	Temperature float32
+	Analog      []int
+}
+
+// Error a bad frame found in the stream. The stream is still usable, the
+// next call to Decode resynchronises on the following start mark.
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "frame: " + e.Reason
+}
+
+// Source gives the records of the sensors, one after another. Decode returns
+// an *Error for a bad record, after which the source is still usable.
+type Source interface {
+	Decode() (SensorData, error)
+	Stats() Stats
+}
+
+// Decoder reads frames from an input stream
+type Decoder struct {
+	r *bufio.Reader
+
+	// Escaped the payload of the frames is escaped. It must match the
+	// framing requested to the firmware.
+	Escaped bool
+	// Checksum the frames carry a checksum trailer. It must match the
+	// framing requested to the firmware.
+	Checksum bool
+
+	// link quality, read by other goroutines through Stats
+	counter
+}
+
+// NewDecoder returns a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReaderSize(r, 4*Size)}
+}
+
+// Decode returns the next record of the stream. Bytes found before a start
+// or sync mark are skipped. A frame without its end mark, with a bad
+// escaping or a wrong checksum gives an *Error; any other error comes from
+// the underlying reader.
+func (d *Decoder) Decode() (SensorData, error) {
+	var data SensorData
+
+	// find the beginning of a frame
+	mark, err := d.findStart()
+	if err != nil {
+		return data, err
+	}
+	data.Sync = mark == SyncMark
+
+	if d.Escaped {
+		err = d.decodeEscaped(&data)
+	} else {
+		err = d.decodeRaw(&data)
+	}
+	if err == nil {
+		d.good()
+	}
+	return data, err
+}
+
+// findStart consumes the stream up to the next start or sync mark, and
+// returns it
+func (d *Decoder) findStart() (byte, error) {
+	skipped := 0
+	defer func() {
+		if skipped > 0 {
+			d.count(func(s *Stats) {
+				s.Resyncs++
+				s.DroppedBytes += uint64(skipped)
+			})
+		}
+	}()
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b == StartMark || b == SyncMark {
+			return b, nil
+		}
+		skipped++
+	}
+}
+
+// decodeRaw reads a frame of fixed size after its start mark
+func (d *Decoder) decodeRaw(data *SensorData) error {
+	size := PayloadSize
+	if d.Checksum {
+		size += ChecksumSize
+	}
+
+	// look at the rest of the frame without consuming it, so a false start
+	// mark costs only one byte
+	rest, err := d.r.Peek(size + 1)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if rest[size] != EndMark {
+		return d.badFrame(1, &Error{fmt.Sprintf("end mark not found, got 0x%02x", rest[size])})
+	}
+	if err := d.check(rest[:size], 1); err != nil {
+		return err
+	}
+
+	Unmarshal(rest[:PayloadSize], data)
+	d.r.Discard(size + 1)
+	return nil
+}
+
+// decodeEscaped reads an escaped frame up to its end mark
+func (d *Decoder) decodeEscaped(data *SensorData) error {
+	escaped, err := d.r.ReadBytes(EndMark)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	// the marks are lost along with a bad frame
+	lost := len(escaped) + 1
+
+	payload, err := Unescape(escaped[:len(escaped)-1])
+	if err != nil {
+		return d.badFrame(lost, err)
+	}
+	size := PayloadSize
+	if d.Checksum {
+		size += ChecksumSize
+	}
+	if len(payload) != size {
+		return d.badFrame(lost, &Error{fmt.Sprintf("payload of %d bytes, expected %d", len(payload), size)})
+	}
+	if err := d.check(payload, lost); err != nil {
+		return err
+	}
+
+	Unmarshal(payload, data)
+	return nil
+}
+
+// check verifies the checksum trailer of payload, if any
+func (d *Decoder) check(payload []byte, lost int) error {
+	if !d.Checksum {
+		return nil
+	}
+	sum := binary.LittleEndian.Uint16(payload[PayloadSize:])
+	if computed := Checksum(payload[:PayloadSize]); computed != sum {
+		d.count(func(s *Stats) {
+			s.BadChecksum++
+			s.DroppedBytes += uint64(lost)
+		})
+		return &Error{fmt.Sprintf("checksum 0x%04x, expected 0x%04x", sum, computed)}
+	}
+	return nil
+}
+
+// badFrame counts a frame discarded for a reason other than its checksum
+func (d *Decoder) badFrame(lost int, err error) error {
+	d.count(func(s *Stats) {
+		s.BadFrames++
+		s.DroppedBytes += uint64(lost)
+	})
+	return err
+}
+
+// Unmarshal decodes a payload, the frame without its marks, into data.
+// data.Sync is left untouched.
+// payload must be at least PayloadSize bytes long.
+func Unmarshal(payload []byte, data *SensorData) {
+	le := binary.LittleEndian
+	data.TrackerMicroSeconds = le.Uint32(payload[0:4])
+	data.SensorMicroSeconds = le.Uint32(payload[4:8])
+	data.Distance = le.Uint32(payload[8:12])
+	data.AccX = math.Float32frombits(le.Uint32(payload[12:16]))
+	data.AccY = math.Float32frombits(le.Uint32(payload[16:20]))
+	data.AccZ = math.Float32frombits(le.Uint32(payload[20:24]))
+	data.GyrX = math.Float32frombits(le.Uint32(payload[24:28]))
+	data.GyrY = math.Float32frombits(le.Uint32(payload[28:32]))
+	data.GyrZ = math.Float32frombits(le.Uint32(payload[32:36]))
+}
+
+// Marshal encodes data into a payload, the frame without its marks.
+// payload must be at least PayloadSize bytes long.
+func Marshal(data *SensorData, payload []byte) {
+	le := binary.LittleEndian
+	le.PutUint32(payload[0:4], data.TrackerMicroSeconds)
+	le.PutUint32(payload[4:8], data.SensorMicroSeconds)
+	le.PutUint32(payload[8:12], data.Distance)
+	le.PutUint32(payload[12:16], math.Float32bits(data.AccX))
+	le.PutUint32(payload[16:20], math.Float32bits(data.AccY))
+	le.PutUint32(payload[20:24], math.Float32bits(data.AccZ))
+	le.PutUint32(payload[24:28], math.Float32bits(data.GyrX))
+	le.PutUint32(payload[28:32], math.Float32bits(data.GyrY))
+	le.PutUint32(payload[32:36], math.Float32bits(data.GyrZ))
+}
+
+// Encode returns the whole frame of data, as the firmware sends it with the
+// given escaping and checksum settings
+func Encode(data *SensorData, escaped, checksum bool) []byte {
+	payload := make([]byte, PayloadSize, PayloadSize+ChecksumSize)
+	Marshal(data, payload)
+	if checksum {
+		payload = payload[:PayloadSize+ChecksumSize]
+		binary.LittleEndian.PutUint16(payload[PayloadSize:], Checksum(payload[:PayloadSize]))
+	}
+	if escaped {
+		payload = Escape(payload)
+	}
+
+	mark := byte(StartMark)
+	if data.Sync {
+		mark = SyncMark
+	}
+	encoded := make([]byte, 0, len(payload)+2)
+	encoded = append(encoded, mark)
+	encoded = append(encoded, payload...)
+	return append(encoded, EndMark)
+}
@@ -0,0 +1,166 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// sample a record whose payload has bytes equal to the marks: the tracker
+// time 0x24 is an end mark and the distance 0x23 a start mark
+var sample = SensorData{
+	TrackerMicroSeconds: 0x24,
+	SensorMicroSeconds:  123456789,
+	Distance:            0x23,
+	AccX:                -0.982910,
+	AccY:                0.044678,
+	AccZ:                -0.043457,
+	GyrX:                1.259542,
+	GyrY:                1.572519,
+	GyrZ:                0.152672,
+}
+
+func TestEncodeDecode(t *testing.T) {
+	sync := sample
+	sync.Sync = true
+	encoded := append(Encode(&sample, false, false), Encode(&sync, false, false)...)
+	if len(encoded) != 2*Size {
+		t.Fatalf("%d bytes encoded, expected %d", len(encoded), 2*Size)
+	}
+
+	d := NewDecoder(bytes.NewReader(encoded))
+	for _, expected := range []SensorData{sample, sync} {
+		data, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("decoded %+v, expected %+v", data, expected)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("error %v at the end, expected EOF", err)
+	}
+	if stats := d.Stats(); stats.Good != 2 || stats.BadFrames != 0 || stats.Resyncs != 0 {
+		t.Errorf("stats %s", stats)
+	}
+}
+
+func TestDecodeSkipsNoise(t *testing.T) {
+	stream := append([]byte("noise"), Encode(&sample, false, false)...)
+
+	d := NewDecoder(bytes.NewReader(stream))
+	data, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, sample) {
+		t.Errorf("decoded %+v, expected %+v", data, sample)
+	}
+	if stats := d.Stats(); stats.Resyncs != 1 || stats.DroppedBytes != 5 {
+		t.Errorf("stats %s, expected 1 resync and 5 bytes dropped", stats)
+	}
+}
+
+func TestDecodeResyncsAfterBadFrame(t *testing.T) {
+	// a frame cut short: its end mark is missing, and the start mark in
+	// its payload is a false one
+	cut := Encode(&sample, false, false)
+	cut = cut[:len(cut)-1]
+	stream := append(cut, Encode(&sample, false, false)...)
+
+	d := NewDecoder(bytes.NewReader(stream))
+	var decoded []SensorData
+	for {
+		data, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if _, bad := err.(*Error); bad {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, data)
+	}
+	if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], sample) {
+		t.Errorf("decoded %+v, expected only %+v", decoded, sample)
+	}
+	if stats := d.Stats(); stats.Good != 1 || stats.BadFrames == 0 {
+		t.Errorf("stats %s, expected 1 good frame and some bad", stats)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	frame := Encode(&sample, false, false)
+
+	d := NewDecoder(bytes.NewReader(frame[:Size/2]))
+	if _, err := d.Decode(); err != io.ErrUnexpectedEOF {
+		t.Errorf("error %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// outputLine the OutputLine of arduino/oshiwasp.ino, as the AVR packs it
+type outputLine struct {
+	FirstChar   byte
+	TrackerTime uint32
+	TheTime     uint32
+	Distance    uint32
+	AccX        float32
+	AccY        float32
+	AccZ        float32
+	GyrX        float32
+	GyrY        float32
+	GyrZ        float32
+	LastChar    byte
+}
+
+func TestDecodeFirmwareLayout(t *testing.T) {
+	if size := binary.Size(outputLine{}); size != Size {
+		t.Fatalf("the OutputLine of the firmware has %d bytes, frames of %d expected", size, Size)
+	}
+	line := outputLine{SyncMark, 1354699, 286078321, 95, -1.000891, 0.25, 0.5, 1.5, -2, 3, EndMark}
+	var raw bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, line)
+	b := raw.Bytes()
+	// as scapeAndBytes, without escaping: the crc of the bytes between the
+	// marks before the end mark
+	payload := b[1 : len(b)-1]
+	sum := Checksum(payload)
+	checked := append([]byte{b[0]}, payload...)
+	checked = append(checked, byte(sum), byte(sum>>8), b[len(b)-1])
+
+	expected := SensorData{
+		TrackerMicroSeconds: 1354699,
+		SensorMicroSeconds:  286078321,
+		Distance:            95,
+		AccX:                -1.000891,
+		AccY:                0.25,
+		AccZ:                0.5,
+		GyrX:                1.5,
+		GyrY:                -2,
+		GyrZ:                3,
+		Sync:                true,
+	}
+	for _, c := range []struct {
+		frame    []byte
+		checksum bool
+	}{
+		{b, false},
+		{checked, true},
+	} {
+		d := NewDecoder(bytes.NewReader(c.frame))
+		d.Checksum = c.checksum
+		data, err := d.Decode()
+		if err != nil {
+			t.Errorf("checksum %v: %v", c.checksum, err)
+			continue
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("checksum %v: decoded %+v, expected %+v", c.checksum, data, expected)
+		}
+	}
+}
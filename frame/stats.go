@@ -0,0 +1,70 @@
+package frame
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Stats counters about the quality of the link with the Arduino
+type Stats struct {
+	// Good frames decoded
+	Good uint64
+	// BadChecksum frames discarded because of a wrong checksum
+	BadChecksum uint64
+	// BadFrames frames discarded for any other reason: end mark not found,
+	// bad escaping or wrong length
+	BadFrames uint64
+	// Resyncs times bytes were skipped looking for the start of a frame
+	Resyncs uint64
+	// DroppedBytes bytes skipped or belonging to discarded frames
+	DroppedBytes uint64
+	// First and Last reception time of the first and last good frames
+	First time.Time
+	Last  time.Time
+}
+
+// FramesPerSecond rate of good frames between the first and the last ones
+func (s Stats) FramesPerSecond() float64 {
+	elapsed := s.Last.Sub(s.First).Seconds()
+	if s.Good < 2 || elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Good-1) / elapsed
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("good=%d badChecksum=%d badFrames=%d resyncs=%d droppedBytes=%d framesPerSecond=%.2f",
+		s.Good, s.BadChecksum, s.BadFrames, s.Resyncs, s.DroppedBytes, s.FramesPerSecond())
+}
+
+// counter keeps the Stats of a decoder, safe for concurrent use
+type counter struct {
+	mutex sync.Mutex
+	stats Stats
+}
+
+// Stats returns a copy of the counters of the decoder
+func (c *counter) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stats
+}
+
+func (c *counter) count(update func(s *Stats)) {
+	c.mutex.Lock()
+	update(&c.stats)
+	c.mutex.Unlock()
+}
+
+// good counts a record decoded now
+func (c *counter) good() {
+	c.count(func(s *Stats) {
+		now := time.Now()
+		if s.Good == 0 {
+			s.First = now
+		}
+		s.Last = now
+		s.Good++
+	})
+}
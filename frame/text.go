@@ -0,0 +1,130 @@
+package frame
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// scales of the raw MPU6050 values sent by the ESP32, at the default
+// ranges of +-2 g and +-250 gr/s
+const (
+	// ESP32AccScale raw units per g
+	ESP32AccScale = 16384.0
+	// ESP32GyroScale raw units per gr/s
+	ESP32GyroScale = 131.0
+	// ESP32AnalogChannels analog channels read by the ESP32
+	ESP32AnalogChannels = 5
+)
+
+// TextDecoder reads the records broadcast as text by the ESP32, one per
+// line:
+//
+//	aX=  4588|aY=  -120|aZ= 15020|gX=   -35|gY=    12|gZ=     3|Temperature=29.87|123456ms since last boot|1650 mV|...|0 mV
+//
+// The accelerations and angular velocities are raw MPU6050 values; they
+// are scaled to g and gr/s so the records are comparable with the ones of
+// the Arduino. The time since boot is given in SensorMicroSeconds, wrapped
+// to 32 bits as the micros() of the Arduino, every 71.6 minutes, and the
+// analog channels, in mV, in Analog.
+type TextDecoder struct {
+	scanner *bufio.Scanner
+
+	// link quality, read by other goroutines through Stats
+	counter
+}
+
+// NewTextDecoder returns a decoder reading lines from r
+func NewTextDecoder(r io.Reader) *TextDecoder {
+	return &TextDecoder{scanner: bufio.NewScanner(r)}
+}
+
+// Decode returns the record of the next line. A line which can't be parsed
+// gives an *Error; any other error comes from the underlying reader.
+func (d *TextDecoder) Decode() (SensorData, error) {
+	if !d.scanner.Scan() {
+		err := d.scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		return SensorData{}, err
+	}
+	line := d.scanner.Text()
+	data, err := ParseText(line)
+	if err != nil {
+		d.count(func(s *Stats) {
+			s.BadFrames++
+			s.DroppedBytes += uint64(len(line) + 1)
+		})
+		return data, err
+	}
+	d.good()
+	return data, nil
+}
+
+// ParseText parses a line sent by the ESP32. The fields are separated by
+// '|' and may be padded with spaces, as in the older "aX = 4588 | aY = ..."
+// records.
+func ParseText(line string) (SensorData, error) {
+	var data SensorData
+	var found int
+
+	line = strings.TrimSpace(line)
+	for _, field := range strings.Split(line, "|") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case strings.HasSuffix(field, "ms since last boot"):
+			ms, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(field, "ms since last boot")), 10, 32)
+			if err != nil {
+				return data, &Error{fmt.Sprintf("bad time in %q", field)}
+			}
+			// wrapped as the micros() of the Arduino in the binary frames
+			data.SensorMicroSeconds = uint32((ms * 1000) % (1 << 32))
+			found++
+		case strings.HasSuffix(field, "mV"):
+			mV, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(field, "mV")))
+			if err != nil {
+				return data, &Error{fmt.Sprintf("bad analog value in %q", field)}
+			}
+			data.Analog = append(data.Analog, mV)
+		default:
+			equal := strings.Index(field, "=")
+			if equal < 0 {
+				return data, &Error{fmt.Sprintf("unknown field %q", field)}
+			}
+			key := strings.TrimSpace(field[:equal])
+			value, err := strconv.ParseFloat(strings.TrimSpace(field[equal+1:]), 32)
+			if err != nil {
+				return data, &Error{fmt.Sprintf("bad value in %q", field)}
+			}
+			switch key {
+			case "aX":
+				data.AccX = float32(value / ESP32AccScale)
+			case "aY":
+				data.AccY = float32(value / ESP32AccScale)
+			case "aZ":
+				data.AccZ = float32(value / ESP32AccScale)
+			case "gX":
+				data.GyrX = float32(value / ESP32GyroScale)
+			case "gY":
+				data.GyrY = float32(value / ESP32GyroScale)
+			case "gZ":
+				data.GyrZ = float32(value / ESP32GyroScale)
+			case "Temperature", "Sensor Temperature":
+				data.Temperature = float32(value)
+			default:
+				return data, &Error{fmt.Sprintf("unknown field %q", field)}
+			}
+			found++
+		}
+	}
+	// the six axes, the temperature and the time
+	if found != 8 {
+		return data, &Error{fmt.Sprintf("incomplete record %q", line)}
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package frame
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTextDecoder(t *testing.T) {
+	lines := "aX=  4096|aY=  -8192|aZ= 16384|gX=   -131|gY=    262|gZ=     0|Temperature=29.75|123456ms since last boot|1650 mV|0 mV|3300 mV|12 mV|-5 mV\n" +
+		"noise\n" +
+		"aX = 0 | aY = 0 | aZ = 0 | gX = 0 | gY = 0 | gZ = 0 | Sensor Temperature = 30 | 4294968ms since last boot\n"
+	expected := []SensorData{{
+		SensorMicroSeconds: 123456000,
+		AccX:               0.25,
+		AccY:               -0.5,
+		AccZ:               1,
+		GyrX:               -1,
+		GyrY:               2,
+		Temperature:        29.75,
+		Analog:             []int{1650, 0, 3300, 12, -5},
+	}, {
+		// 4294968000 us wrapped to 32 bits, as micros()
+		SensorMicroSeconds: 704,
+		Temperature:        30,
+	}}
+
+	d := NewTextDecoder(strings.NewReader(lines))
+	var decoded []SensorData
+	for {
+		data, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if _, bad := err.(*Error); bad {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, data)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("decoded %+v, expected %+v", decoded, expected)
+	}
+	if stats := d.Stats(); stats.Good != 2 || stats.BadFrames != 1 || stats.DroppedBytes != 6 {
+		t.Errorf("stats %s, expected 2 good frames and the 6 bytes of 1 bad", stats)
+	}
+}
+
+func TestParseTextIncomplete(t *testing.T) {
+	if _, err := ParseText("aX=1|aY=2|aZ=3|123ms since last boot"); err == nil {
+		t.Error("a record without the gyroscope and the temperature parsed")
+	}
+}
@@ -0,0 +1,139 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Edges edges of an input to watch
+type Edges int
+
+// edges
+const (
+	// Rising from LOW to HIGH
+	Rising Edges = 1 << iota
+	// Falling from HIGH to LOW
+	Falling
+	// Both rising and falling
+	Both = Rising | Falling
+)
+
+// ParseEdges parses "rising", "falling" or "both"
+func ParseEdges(s string) (Edges, error) {
+	switch s {
+	case "rising":
+		return Rising, nil
+	case "falling":
+		return Falling, nil
+	case "both":
+		return Both, nil
+	}
+	return 0, fmt.Errorf("gpio: unknown edges %q", s)
+}
+
+func (e Edges) String() string {
+	switch e {
+	case Rising:
+		return "rising"
+	case Falling:
+		return "falling"
+	case Both:
+		return "both"
+	}
+	return fmt.Sprintf("Edges(%d)", int(e))
+}
+
+// PollInterval time between reads of a polled input
+var PollInterval = 100 * time.Microsecond
+
+// ErrClosed returned by Wait once the watcher is closed
+var ErrClosed = errors.New("gpio: watcher closed")
+
+// ErrNoEvents the board can't give edge events for the pin
+var ErrNoEvents = errors.New("gpio: edge events not available")
+
+// Event an edge of an input
+type Event struct {
+	// Value level after the edge
+	Value int
+	// Time of the edge; given by the kernel when the events come from it
+	Time time.Time
+}
+
+// Watcher gives the edges of an input, one after another
+type Watcher interface {
+	// Wait blocks until the next edge, or until the watcher is closed
+	Wait() (Event, error)
+	// Close ends the watch, unblocking Wait
+	Close() error
+	// Polled the edges are found polling the input, without kernel events
+	Polled() bool
+}
+
+// EdgeBoard a board able to give the edges of its inputs as events
+type EdgeBoard interface {
+	Board
+	// Watch returns ErrNoEvents, or another error, if the events of the
+	// pin are not available
+	Watch(name string, edges Edges) (Watcher, error)
+}
+
+// Watch watches the edges of the input pin, called name on board: with
+// the events of the board if it gives them, polling pin otherwise
+func Watch(board Board, name string, pin Pin, edges Edges) (Watcher, error) {
+	if edgeBoard, ok := board.(EdgeBoard); ok {
+		watcher, err := edgeBoard.Watch(name, edges)
+		if err == nil {
+			return watcher, nil
+		}
+		if err != ErrNoEvents {
+			return nil, err
+		}
+	}
+	return newPollWatcher(pin, edges)
+}
+
+// pollWatcher reads the input each PollInterval
+type pollWatcher struct {
+	pin    Pin
+	edges  Edges
+	value  int
+	closed int32
+}
+
+func newPollWatcher(pin Pin, edges Edges) (*pollWatcher, error) {
+	value, err := pin.Read()
+	if err != nil {
+		return nil, err
+	}
+	return &pollWatcher{pin: pin, edges: edges, value: value}, nil
+}
+
+func (w *pollWatcher) Wait() (Event, error) {
+	for atomic.LoadInt32(&w.closed) == 0 {
+		value, err := w.pin.Read()
+		if err != nil {
+			return Event{}, err
+		}
+		now := time.Now()
+		if value != w.value {
+			w.value = value
+			if (value == HIGH && w.edges&Rising != 0) || (value == LOW && w.edges&Falling != 0) {
+				return Event{value, now}, nil
+			}
+		}
+		time.Sleep(PollInterval)
+	}
+	return Event{}, ErrClosed
+}
+
+func (w *pollWatcher) Close() error {
+	atomic.StoreInt32(&w.closed, 1)
+	return nil
+}
+
+func (w *pollWatcher) Polled() bool {
+	return true
+}
@@ -0,0 +1,274 @@
+//go:build linux
+// +build linux
+
+package gpio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// GPIOChip the character device of the GPIO of the Raspberry Pi; the
+// offsets of its lines are the numbers of the pins
+var GPIOChip = "/dev/gpiochip0"
+
+// SysfsGPIO the sysfs directory of the GPIO
+var SysfsGPIO = "/sys/class/gpio"
+
+// linux/gpio.h, v1 of the ABI
+const (
+	gpioGetLineEventIoctl = 0xc030b404 // _IOWR(0xB4, 0x04, struct gpioevent_request)
+	gpioHandleInput       = 1 << 0
+	gpioEventRisingEdge   = 1 << 0
+	gpioEventFallingEdge  = 1 << 1
+	gpioEventRequestSize  = 48
+	gpioEventDataSize     = 16
+	consumerLabel         = "oshiwasp"
+)
+
+// Watch the edges of the pin with the line events of the GPIO character
+// device, time stamped by the kernel. If the line is busy, as it happens
+// when it is exported to sysfs, the edges are watched with poll on its
+// value file.
+func (Hwio) Watch(name string, edges Edges) (Watcher, error) {
+	if !strings.HasPrefix(name, "gpio") {
+		return nil, ErrNoEvents
+	}
+	line, err := strconv.Atoi(strings.TrimPrefix(name, "gpio"))
+	if err != nil {
+		return nil, ErrNoEvents
+	}
+	if watcher, err := watchLine(line, edges); err == nil {
+		return watcher, nil
+	}
+	if watcher, err := watchSysfs(line, edges); err == nil {
+		return watcher, nil
+	}
+	// nothing but polling left
+	return nil, ErrNoEvents
+}
+
+// lineWatcher line events of the character device
+type lineWatcher struct {
+	file *os.File
+	buf  [gpioEventDataSize]byte
+}
+
+func watchLine(line int, edges Edges) (*lineWatcher, error) {
+	chip, err := os.Open(GPIOChip)
+	if err != nil {
+		return nil, err
+	}
+	defer chip.Close()
+
+	// struct gpioevent_request
+	var request [gpioEventRequestSize]byte
+	binary.LittleEndian.PutUint32(request[0:], uint32(line))
+	binary.LittleEndian.PutUint32(request[4:], gpioHandleInput)
+	var flags uint32
+	if edges&Rising != 0 {
+		flags |= gpioEventRisingEdge
+	}
+	if edges&Falling != 0 {
+		flags |= gpioEventFallingEdge
+	}
+	binary.LittleEndian.PutUint32(request[8:], flags)
+	copy(request[12:44], consumerLabel)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, chip.Fd(),
+		gpioGetLineEventIoctl, uintptr(unsafe.Pointer(&request[0])))
+	if errno != 0 {
+		return nil, errno
+	}
+	fd := int(int32(binary.LittleEndian.Uint32(request[44:])))
+	// non blocking, so that Close unblocks a pending Read
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &lineWatcher{file: os.NewFile(uintptr(fd), fmt.Sprintf("gpio%d events", line))}, nil
+}
+
+func (w *lineWatcher) Wait() (Event, error) {
+	// struct gpioevent_data
+	if _, err := io.ReadFull(w.file, w.buf[:]); err != nil {
+		if isClosed(err) {
+			return Event{}, ErrClosed
+		}
+		return Event{}, err
+	}
+	event := Event{Value: LOW, Time: kernelTime(binary.LittleEndian.Uint64(w.buf[0:]))}
+	if binary.LittleEndian.Uint32(w.buf[8:]) == gpioEventRisingEdge {
+		event.Value = HIGH
+	}
+	return event, nil
+}
+
+func (w *lineWatcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *lineWatcher) Polled() bool {
+	return false
+}
+
+// kernelTime converts the time stamp of an event to a time. The kernels
+// before 5.7 stamp the events with the real time clock, later ones with
+// the monotonic clock.
+func kernelTime(stamp uint64) time.Time {
+	now := time.Now()
+	realtime := time.Unix(0, int64(stamp))
+	if d := now.Sub(realtime); d > -time.Hour && d < time.Hour {
+		return realtime
+	}
+	var ts syscall.Timespec
+	const clockMonotonic = 1
+	syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0)
+	return now.Add(-time.Duration(ts.Nano() - int64(stamp)))
+}
+
+// sysfsWatcher poll on the value file of a pin exported to sysfs; the
+// events are stamped when poll returns
+type sysfsWatcher struct {
+	value *os.File
+	epoll int
+	// wake up the epoll on Close
+	wakeR, wakeW int
+	closed       int32
+}
+
+func watchSysfs(line int, edges Edges) (*sysfsWatcher, error) {
+	dir := fmt.Sprintf("%s/gpio%d", SysfsGPIO, line)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := writeFile(SysfsGPIO+"/export", strconv.Itoa(line)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFile(dir+"/edge", edges.String()); err != nil {
+		return nil, err
+	}
+	value, err := os.Open(dir + "/value")
+	if err != nil {
+		return nil, err
+	}
+	w := &sysfsWatcher{value: value, epoll: -1, wakeR: -1, wakeW: -1}
+	if err := w.setup(); err != nil {
+		w.release()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *sysfsWatcher) setup() error {
+	var err error
+	if w.epoll, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC); err != nil {
+		return err
+	}
+	var pipe [2]int
+	if err = syscall.Pipe2(pipe[:], syscall.O_CLOEXEC); err != nil {
+		return err
+	}
+	w.wakeR, w.wakeW = pipe[0], pipe[1]
+	fd := int(w.value.Fd())
+	err = syscall.EpollCtl(w.epoll, syscall.EPOLL_CTL_ADD, fd,
+		&syscall.EpollEvent{Events: syscall.EPOLLPRI | syscall.EPOLLERR, Fd: int32(fd)})
+	if err != nil {
+		return err
+	}
+	err = syscall.EpollCtl(w.epoll, syscall.EPOLL_CTL_ADD, w.wakeR,
+		&syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(w.wakeR)})
+	if err != nil {
+		return err
+	}
+	// the first poll returns at once, with the current level
+	_, err = w.read()
+	return err
+}
+
+func (w *sysfsWatcher) read() (int, error) {
+	var buf [2]byte
+	if _, err := w.value.ReadAt(buf[:], 0); err != nil && err != io.EOF {
+		return LOW, err
+	}
+	if buf[0] == '1' {
+		return HIGH, nil
+	}
+	return LOW, nil
+}
+
+func (w *sysfsWatcher) Wait() (Event, error) {
+	events := make([]syscall.EpollEvent, 2)
+	for {
+		n, err := syscall.EpollWait(w.epoll, events, -1)
+		now := time.Now()
+		if atomic.LoadInt32(&w.closed) != 0 {
+			return Event{}, ErrClosed
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return Event{}, err
+		}
+		for _, e := range events[:n] {
+			if int(e.Fd) == w.wakeR {
+				return Event{}, ErrClosed
+			}
+		}
+		if n > 0 {
+			value, err := w.read()
+			if err != nil && atomic.LoadInt32(&w.closed) != 0 {
+				return Event{}, ErrClosed
+			}
+			return Event{value, now}, err
+		}
+	}
+}
+
+func (w *sysfsWatcher) Close() error {
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return nil
+	}
+	_, err := syscall.Write(w.wakeW, []byte{0})
+	w.release()
+	return err
+}
+
+func (w *sysfsWatcher) Polled() bool {
+	return false
+}
+
+func (w *sysfsWatcher) release() {
+	w.value.Close()
+	for _, fd := range []int{w.epoll, w.wakeR, w.wakeW} {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+	}
+}
+
+func writeFile(name, s string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(s)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func isClosed(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == os.ErrClosed
+}
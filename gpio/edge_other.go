@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package gpio
+
+// Watch there are no edge events out of Linux, the pins are polled
+func (Hwio) Watch(name string, edges Edges) (Watcher, error) {
+	return nil, ErrNoEvents
+}
@@ -0,0 +1,76 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEdges(t *testing.T) {
+	for _, e := range []Edges{Rising, Falling, Both} {
+		if parsed, err := ParseEdges(e.String()); err != nil || parsed != e {
+			t.Errorf("%s parsed as %v, %v", e, parsed, err)
+		}
+	}
+	if _, err := ParseEdges("up"); err == nil {
+		t.Error("unknown edges parsed")
+	}
+}
+
+// watchTracker the edges of a pulse of the tracker of the fake board, as
+// the readers of the trackers watch them, and the time of the pulse
+func watchTracker(t *testing.T, edges Edges) ([]Event, time.Time) {
+	f := NewFake()
+	f.Pulse("gpio22", 10*time.Millisecond, 50*time.Millisecond)
+	pin, err := f.Input("gpio22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := Watch(f, "gpio22", pin, edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !watcher.Polled() {
+		t.Error("the fake board isn't polled")
+	}
+	time.AfterFunc(100*time.Millisecond, func() { watcher.Close() })
+
+	var events []Event
+	for {
+		event, err := watcher.Wait()
+		if err == ErrClosed {
+			return events, f.start.Add(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestWatchFake(t *testing.T) {
+	for _, c := range []struct {
+		edges  Edges
+		values []int
+		// after the start of the pulse
+		after []time.Duration
+	}{
+		{Both, []int{HIGH, LOW}, []time.Duration{0, 50 * time.Millisecond}},
+		{Rising, []int{HIGH}, []time.Duration{0}},
+		{Falling, []int{LOW}, []time.Duration{50 * time.Millisecond}},
+	} {
+		events, pulse := watchTracker(t, c.edges)
+		if len(events) != len(c.values) {
+			t.Errorf("%s: %d edges, expected %d", c.edges, len(events), len(c.values))
+			continue
+		}
+		for i, e := range events {
+			if e.Value != c.values[i] {
+				t.Errorf("%s: edge %d to %d, expected %d", c.edges, i, e.Value, c.values[i])
+			}
+			// polled, an edge is seen when it is read, never before
+			if e.Time.Before(pulse.Add(c.after[i])) {
+				t.Errorf("%s: edge %d %v after the pulse, before it happened", c.edges, i, e.Time.Sub(pulse))
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package gpio
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake a board in memory. The level of its inputs follows a script of
+// edges, or a function of time; the levels written to its outputs are
+// recorded. Times are offsets from Start, read from the Now clock.
+type Fake struct {
+	// Now the clock of the board, time.Now if nil
+	Now func() time.Time
+
+	mutex sync.Mutex
+	start time.Time
+	pins  map[string]*fakePin
+}
+
+// MaxWrites writes kept for each output, the older ones are forgotten
+const MaxWrites = 1024
+
+// Edge change of level of a pin at a time after Start
+type Edge struct {
+	At    time.Duration
+	Value int
+}
+
+type fakePin struct {
+	board  *Fake
+	name   string
+	output bool
+	// inputs: script of edges, sorted by time, or a function of time
+	edges []Edge
+	drive func(t time.Time) int
+	// outputs: levels written
+	writes []Edge
+	level  int
+}
+
+// NewFake returns an empty board, started now
+func NewFake() *Fake {
+	f := &Fake{pins: make(map[string]*fakePin)}
+	f.Start()
+	return f
+}
+
+// Start sets the origin of the times of the scripts and the writes
+func (f *Fake) Start() {
+	f.mutex.Lock()
+	f.start = f.now()
+	f.mutex.Unlock()
+}
+
+func (f *Fake) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+func (f *Fake) pin(name string) *fakePin {
+	p, ok := f.pins[name]
+	if !ok {
+		p = &fakePin{board: f, name: name}
+		f.pins[name] = p
+	}
+	return p
+}
+
+// Input sets up the pin as an input
+func (f *Fake) Input(name string) (Pin, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	p := f.pin(name)
+	if p.output {
+		return nil, fmt.Errorf("gpio: pin %s is an output", name)
+	}
+	return p, nil
+}
+
+// Output sets up the pin as an output
+func (f *Fake) Output(name string) (Pin, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	p := f.pin(name)
+	if len(p.edges) > 0 || p.drive != nil {
+		return nil, fmt.Errorf("gpio: pin %s is a scripted input", name)
+	}
+	p.output = true
+	return p, nil
+}
+
+// Close releases all the pins
+func (f *Fake) Close() error {
+	return nil
+}
+
+// Edge scripts a change of the input to value at the time at
+func (f *Fake) Edge(name string, at time.Duration, value int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	p := f.pin(name)
+	p.edges = append(p.edges, Edge{at, value})
+	sort.SliceStable(p.edges, func(i, j int) bool { return p.edges[i].At < p.edges[j].At })
+}
+
+// Pulse scripts the input HIGH at the time at, for width
+func (f *Fake) Pulse(name string, at, width time.Duration) {
+	f.Edge(name, at, HIGH)
+	f.Edge(name, at+width, LOW)
+}
+
+// Drive makes the level of the input a function of the time, instead of a
+// script
+func (f *Fake) Drive(name string, level func(t time.Time) int) {
+	f.mutex.Lock()
+	f.pin(name).drive = level
+	f.mutex.Unlock()
+}
+
+// Writes the last levels written to the output, with their times
+func (f *Fake) Writes(name string) []Edge {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Edge(nil), f.pin(name).writes...)
+}
+
+// Level the current level of the pin
+func (f *Fake) Level(name string) int {
+	f.mutex.Lock()
+	p := f.pin(name)
+	f.mutex.Unlock()
+	value, _ := p.Read()
+	return value
+}
+
+func (p *fakePin) Read() (int, error) {
+	f := p.board
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	now := f.now()
+	if p.output {
+		return p.level, nil
+	}
+	if p.drive != nil {
+		return p.drive(now), nil
+	}
+	level := LOW
+	elapsed := now.Sub(f.start)
+	for _, e := range p.edges {
+		if e.At > elapsed {
+			break
+		}
+		level = e.Value
+	}
+	return level, nil
+}
+
+func (p *fakePin) Write(value int) error {
+	f := p.board
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !p.output {
+		return fmt.Errorf("gpio: pin %s is an input", p.name)
+	}
+	p.level = value
+	if len(p.writes) == MaxWrites {
+		p.writes = append(p.writes[:0], p.writes[1:]...)
+	}
+	p.writes = append(p.writes, Edge{f.now().Sub(f.start), value})
+	return nil
+}
@@ -0,0 +1,94 @@
+package gpio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clock a time moved by hand, for the Now of a Fake
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newClockedFake() (*Fake, *clock) {
+	c := &clock{t: time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)}
+	f := &Fake{Now: c.now, pins: make(map[string]*fakePin)}
+	f.Start()
+	return f, c
+}
+
+func TestFakeInputScript(t *testing.T) {
+	f, c := newClockedFake()
+	f.Pulse("gpio22", 10*time.Millisecond, 5*time.Millisecond)
+	pin, err := f.Input("gpio22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		at    time.Duration
+		level int
+	}{
+		{0, LOW},
+		{10 * time.Millisecond, HIGH},
+		{14 * time.Millisecond, HIGH},
+		{15 * time.Millisecond, LOW},
+		{time.Second, LOW},
+	} {
+		c.t = f.start.Add(step.at)
+		if level, err := pin.Read(); err != nil || level != step.level {
+			t.Errorf("at %v level %d, %v; expected %d", step.at, level, err, step.level)
+		}
+	}
+}
+
+func TestFakeLedWrites(t *testing.T) {
+	f, c := newClockedFake()
+	led, err := f.Output("gpio8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range []int{HIGH, LOW, HIGH} {
+		c.t = f.start.Add(time.Duration(i) * time.Second)
+		if err := led.Write(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []Edge{{0, HIGH}, {time.Second, LOW}, {2 * time.Second, HIGH}}
+	if writes := f.Writes("gpio8"); !reflect.DeepEqual(writes, expected) {
+		t.Errorf("writes %v, expected %v", writes, expected)
+	}
+	if level := f.Level("gpio8"); level != HIGH {
+		t.Errorf("level %d, expected %d", level, HIGH)
+	}
+
+	for i := 0; i < MaxWrites+10; i++ {
+		led.Write(i % 2)
+	}
+	if writes := f.Writes("gpio8"); len(writes) != MaxWrites {
+		t.Errorf("%d writes kept, expected %d", len(writes), MaxWrites)
+	}
+}
+
+func TestFakePinDirections(t *testing.T) {
+	f, _ := newClockedFake()
+	f.Edge("gpio4", time.Second, HIGH)
+	if _, err := f.Output("gpio4"); err == nil {
+		t.Error("scripted input set up as an output")
+	}
+	led, _ := f.Output("gpio7")
+	if _, err := f.Input("gpio7"); err == nil {
+		t.Error("output set up as an input")
+	}
+	if err := led.Write(HIGH); err != nil {
+		t.Error(err)
+	}
+	tracker, _ := f.Input("gpio4")
+	if err := tracker.Write(HIGH); err == nil {
+		t.Error("input written")
+	}
+}
@@ -0,0 +1,69 @@
+package gpio
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Filter drops the bounces and the re-triggers of the edges of an input:
+//
+//   - any edge closer than Debounce to the last accepted edge is a bounce
+//   - an edge closer than MinInterval to the last accepted edge of the same
+//     direction is a re-trigger, as when a flag passes slowly through a
+//     gate; the falling edges after a dropped rising one are dropped too
+//
+// Accept is called from the goroutine reading the input, Suppressed from
+// any goroutine.
+type Filter struct {
+	// first field, to be aligned for the atomic access on 32 bits
+	suppressed uint64
+
+	Debounce    time.Duration
+	MinInterval time.Duration
+
+	last     time.Time
+	lastOf   [2]time.Time // by the level after the edge
+	skipFall bool
+}
+
+// NewFilter returns a filter; zero durations let every edge pass
+func NewFilter(debounce, minInterval time.Duration) *Filter {
+	return &Filter{Debounce: debounce, MinInterval: minInterval}
+}
+
+// Accept tells if the edge is good, counting it as suppressed otherwise
+func (f *Filter) Accept(e Event) bool {
+	ok := true
+	switch {
+	case !f.last.IsZero() && e.Time.Sub(f.last) < f.Debounce:
+		ok = false
+	case e.Value == LOW && f.skipFall:
+		ok = false
+	case !f.lastOf[e.Value].IsZero() && e.Time.Sub(f.lastOf[e.Value]) < f.MinInterval:
+		ok = false
+		if e.Value == HIGH {
+			f.skipFall = true
+		}
+	}
+	if !ok {
+		atomic.AddUint64(&f.suppressed, 1)
+		return false
+	}
+	if e.Value == HIGH {
+		f.skipFall = false
+	}
+	f.last = e.Time
+	f.lastOf[e.Value] = e.Time
+	return true
+}
+
+// Suppressed edges dropped by the filter
+func (f *Filter) Suppressed() uint64 {
+	return atomic.LoadUint64(&f.suppressed)
+}
+
+func (f *Filter) String() string {
+	return fmt.Sprintf("debounce=%v minInterval=%v suppressed=%d",
+		f.Debounce, f.MinInterval, f.Suppressed())
+}
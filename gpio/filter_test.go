@@ -0,0 +1,47 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	t0 := time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+
+	f := NewFilter(2*time.Millisecond, 50*time.Millisecond)
+	for _, step := range []struct {
+		edge     Event
+		accepted bool
+	}{
+		{Event{HIGH, ms(0)}, true},
+		// bounces of the rising edge
+		{Event{LOW, ms(1)}, false},
+		{Event{HIGH, ms(1)}, false},
+		{Event{LOW, ms(10)}, true},
+		// re-trigger of the gate: its falling edge goes too
+		{Event{HIGH, ms(30)}, false},
+		{Event{LOW, ms(40)}, false},
+		{Event{HIGH, ms(100)}, true},
+		{Event{LOW, ms(110)}, true},
+	} {
+		if accepted := f.Accept(step.edge); accepted != step.accepted {
+			t.Errorf("edge to %d at %v accepted %v, expected %v",
+				step.edge.Value, step.edge.Time.Sub(t0), accepted, step.accepted)
+		}
+	}
+	if suppressed := f.Suppressed(); suppressed != 4 {
+		t.Errorf("%d edges suppressed, expected 4", suppressed)
+	}
+}
+
+func TestFilterZero(t *testing.T) {
+	t0 := time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)
+
+	f := NewFilter(0, 0)
+	for i := 0; i < 10; i++ {
+		if !f.Accept(Event{i % 2, t0}) {
+			t.Errorf("edge %d suppressed without filtering", i)
+		}
+	}
+}
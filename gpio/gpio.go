@@ -0,0 +1,32 @@
+// Package gpio gives access to the pins of the Raspberry Pi where the
+// trackers, the buttons and the leds of the platform are connected.
+//
+// The Board interface has two implementations: Hwio, the real GPIO through
+// the hwio package, and Fake, a board in memory whose inputs follow a
+// script and whose outputs are recorded, for the simulated platform and
+// for testing without a Raspberry Pi.
+package gpio
+
+// levels of the pins
+const (
+	LOW  = 0
+	HIGH = 1
+)
+
+// Pin input or output of the board
+type Pin interface {
+	// Read the level of the pin
+	Read() (int, error)
+	// Write the level of an output pin
+	Write(value int) error
+}
+
+// Board the pins of the GPIO, by their name ("gpio22")
+type Board interface {
+	// Input sets up the pin as an input
+	Input(name string) (Pin, error)
+	// Output sets up the pin as an output
+	Output(name string) (Pin, error)
+	// Close releases all the pins
+	Close() error
+}
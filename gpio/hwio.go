@@ -0,0 +1,34 @@
+package gpio
+
+import "github.com/mrmorphic/hwio"
+
+// Hwio the GPIO of the Raspberry Pi, through the hwio package
+type Hwio struct{}
+
+// Input sets up the pin as an input
+func (Hwio) Input(name string) (Pin, error) {
+	pin, err := hwio.GetPinWithMode(name, hwio.INPUT)
+	return hwioPin(pin), err
+}
+
+// Output sets up the pin as an output
+func (Hwio) Output(name string) (Pin, error) {
+	pin, err := hwio.GetPinWithMode(name, hwio.OUTPUT)
+	return hwioPin(pin), err
+}
+
+// Close releases all the pins
+func (Hwio) Close() error {
+	hwio.CloseAll()
+	return nil
+}
+
+type hwioPin hwio.Pin
+
+func (p hwioPin) Read() (int, error) {
+	return hwio.DigitalRead(hwio.Pin(p))
+}
+
+func (p hwioPin) Write(value int) error {
+	return hwio.DigitalWrite(hwio.Pin(p), value)
+}
@@ -0,0 +1,231 @@
+// Package kinematics analyses the passing of the cart through the
+// photogates of the track, the base trackers A to D.
+//
+// With the spacings of the gates and the length of the flag of the cart, the
+// Setup, the first crossing of each gate in a run gives:
+//
+//	transit       the time the flag blocks the gate, from its rising edge to
+//	              the falling one, when both edges are recorded
+//	velocity      at a gate, the length of the flag over its transit time
+//	interval      the time between the crossings of two gates in a row
+//	velocity      between two gates, their spacing over the interval
+//	acceleration  between the velocities of two intervals in a row, each one
+//	              at the middle of its interval, which is exact with a
+//	              constant acceleration
+//
+// The crossing of a gate is its rising edge, or the falling one if only the
+// falling edges are recorded; the level 1 is the flag in front of the gate.
+// A cart going from D to A has negative velocities.
+//
+// Every value has its uncertainty, from the uncertainties of the lengths and
+// of the time of each edge, propagated as if they were independent.
+package kinematics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+)
+
+// Gates the names of the base trackers, in order along the track
+const Gates = "ABCD"
+
+// level column of the level of the trackers after the edge
+const level = "level"
+
+// edgesKey setting of the edges of the trackers recorded, and
+// fallingEdges its value when only the falling ones are
+const (
+	edgesKey     = "trackerEdges"
+	fallingEdges = "falling"
+)
+
+// Measure a value with its uncertainty
+type Measure struct {
+	Value float64 `json:"value"`
+	Error float64 `json:"error"`
+}
+
+// String the value rounded to the two significant digits of its
+// uncertainty: "0.432 ± 0.011"
+func (m Measure) String() string {
+	digits := 3
+	if m.Error > 0 {
+		digits = 1 - int(math.Floor(math.Log10(m.Error)))
+	}
+	if digits < 0 {
+		digits = 0
+	}
+	return strconv.FormatFloat(m.Value, 'f', digits, 64) + " ± " + strconv.FormatFloat(m.Error, 'f', digits, 64)
+}
+
+// Crossing the first pass of the flag through a gate
+type Crossing struct {
+	Gate string `json:"gate"`
+	// Position of the gate from the gate A, m
+	Position float64 `json:"position"`
+	// Time of the crossing, local time of the run
+	Time time.Duration `json:"time"`
+	// Transit time the flag blocks the gate, s; 0 if unknown
+	Transit Measure `json:"transit"`
+	// Velocity at the gate, m/s, at the middle of the transit; 0 if the
+	// transit is unknown
+	Velocity Measure `json:"velocity"`
+}
+
+// Middle of the transit, local time of the run, when the flag is centred
+// on the gate; the time of the crossing if the transit is unknown
+func (c Crossing) Middle() time.Duration {
+	return c.Time + time.Duration(c.Transit.Value/2*float64(time.Second))
+}
+
+// Interval the motion between the crossings of two gates in a row
+type Interval struct {
+	// Gates the two gates: "AB"
+	Gates string `json:"gates"`
+	// Time the middle of the interval, local time of the run
+	Time time.Duration `json:"time"`
+	// Duration between the crossings, s
+	Duration Measure `json:"duration"`
+	// Velocity mean velocity between the gates, m/s
+	Velocity Measure `json:"velocity"`
+}
+
+// Acceleration between two intervals in a row
+type Acceleration struct {
+	// Gates the three gates: "ABC"
+	Gates string `json:"gates"`
+	// Time between the middles of the intervals, local time of the run
+	Time time.Duration `json:"time"`
+	// Acceleration m/s2
+	Acceleration Measure `json:"acceleration"`
+}
+
+// Result the kinematics of a run
+type Result struct {
+	Setup         Setup          `json:"setup"`
+	Crossings     []Crossing     `json:"crossings"`
+	Intervals     []Interval     `json:"intervals"`
+	Accelerations []Acceleration `json:"accelerations"`
+}
+
+// Transits true if the transit times are known
+func (r *Result) Transits() bool {
+	for _, c := range r.Crossings {
+		if c.Transit.Value > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyze the crossings of the gates in the run, with the setup in its
+// header; false if the run has no setup
+func Analyze(run datafile.Segment) (*Result, bool) {
+	setup, ok := ReadSetup(run.Header.Settings)
+	if !ok {
+		return nil, false
+	}
+	return AnalyzeWith(run, setup), true
+}
+
+// AnalyzeWith analyses the crossings of the gates in the run with the setup
+func AnalyzeWith(run datafile.Segment, setup Setup) *Result {
+	result := &Result{Setup: setup}
+	for gate := range Gates {
+		if c, ok := crossing(run, setup, gate); ok {
+			result.Crossings = append(result.Crossings, c)
+		}
+	}
+	// the error of a difference of times of two edges
+	dtError := math.Sqrt2 * setup.TimeError
+	for i := 1; i < len(result.Crossings); i++ {
+		a, b := result.Crossings[i-1], result.Crossings[i]
+		dt := (b.Time - a.Time).Seconds()
+		if dt == 0 {
+			continue
+		}
+		dx := b.Position - a.Position
+		// the spacings between the gates are measured one by one
+		dxError := math.Sqrt(float64(gateIndex(b.Gate)-gateIndex(a.Gate))) * setup.LengthError
+		v := dx / dt
+		result.Intervals = append(result.Intervals, Interval{
+			Gates:    a.Gate + b.Gate,
+			Time:     (a.Time + b.Time) / 2,
+			Duration: Measure{dt, dtError},
+			Velocity: Measure{v, math.Abs(v) * math.Hypot(dxError/dx, dtError/dt)},
+		})
+	}
+	for i := 1; i < len(result.Intervals); i++ {
+		a, b := result.Intervals[i-1], result.Intervals[i]
+		if a.Gates[1] != b.Gates[0] {
+			// not in a row: a crossing is missing between them
+			continue
+		}
+		dt := (b.Time - a.Time).Seconds()
+		if dt == 0 {
+			continue
+		}
+		acc := (b.Velocity.Value - a.Velocity.Value) / dt
+		// the middles are half the sum of two times
+		dtError := setup.TimeError / math.Sqrt2
+		result.Accelerations = append(result.Accelerations, Acceleration{
+			Gates: a.Gates + b.Gates[1:],
+			Time:  (a.Time + b.Time) / 2,
+			Acceleration: Measure{acc, math.Sqrt(a.Velocity.Error*a.Velocity.Error+
+				b.Velocity.Error*b.Velocity.Error+acc*acc*dtError*dtError) / math.Abs(dt)},
+		})
+	}
+	return result
+}
+
+func gateIndex(gate string) int {
+	for i := range Gates {
+		if Gates[i:i+1] == gate {
+			return i
+		}
+	}
+	return -1
+}
+
+// crossing the first crossing of the gate in the run, false if none
+func crossing(run datafile.Segment, setup Setup, gate int) (Crossing, bool) {
+	name := Gates[gate : gate+1]
+	// the readers of the trackers write concurrently
+	var rows []datafile.Row
+	for _, row := range run.Rows {
+		if row.Source == name {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time < rows[j].Time })
+
+	c := Crossing{Gate: name, Position: setup.Position(gate)}
+	if run.Header.Settings[edgesKey] == fallingEdges {
+		if len(rows) == 0 {
+			return c, false
+		}
+		c.Time = rows[0].Time
+		return c, true
+	}
+	entered := false
+	for _, row := range rows {
+		// without the level, only the rising edges are recorded
+		l, known := run.Header.Value(row, level)
+		switch {
+		case !entered && (!known || l != 0):
+			c.Time = row.Time
+			entered = true
+		case entered && known && l == 0 && row.Time > c.Time:
+			t := (row.Time - c.Time).Seconds()
+			c.Transit = Measure{t, math.Sqrt2 * setup.TimeError}
+			v := setup.FlagLength / t
+			c.Velocity = Measure{v, v * math.Hypot(setup.LengthError/setup.FlagLength, math.Sqrt2*setup.TimeError/t)}
+			return c, true
+		}
+	}
+	return c, entered
+}
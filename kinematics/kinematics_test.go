@@ -0,0 +1,216 @@
+package kinematics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// pass the flag of the cart through a gate: it enters at time and leaves it
+// transit later, in s
+type pass struct {
+	gate    string
+	time    float64
+	transit float64
+}
+
+// seconds the duration of s seconds
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+// track a run of the trackers A to D with the default setup, recording the
+// edges of the passes as set by -tracker-edges
+func track(edges string, passes ...pass) datafile.Segment {
+	tracker := &record.Schema{}
+	if edges != "rising" {
+		tracker.Add(record.Field{Name: level, Kind: record.Int})
+	}
+	h := datafile.NewHeader("cart", time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC))
+	for i := range Gates {
+		h.AddSource(Gates[i:i+1], tracker)
+	}
+	h.Settings[edgesKey] = edges
+	DefaultSetup().Write(h.Settings)
+
+	run := datafile.Segment{Header: h}
+	for _, p := range passes {
+		enter := datafile.Row{Source: p.gate, Time: seconds(p.time)}
+		leave := datafile.Row{Source: p.gate, Time: seconds(p.time + p.transit)}
+		switch edges {
+		case "rising":
+			run.Rows = append(run.Rows, enter)
+		case "falling":
+			leave.Values = []float64{0}
+			run.Rows = append(run.Rows, leave)
+		default:
+			enter.Values = []float64{1}
+			leave.Values = []float64{0}
+			// the readers of the trackers write concurrently
+			run.Rows = append([]datafile.Row{leave}, append(run.Rows, enter)...)
+		}
+	}
+	return run
+}
+
+// motion the passes through the gates of a cart at x0 with velocity v0 and
+// acceleration a at the time 1 s, in m, m/s and m/s2
+func motion(x0, v0, a float64, gates string) []pass {
+	setup := DefaultSetup()
+	// time to go from x0 to x
+	at := func(x float64) float64 {
+		dx := x - x0
+		if a == 0 {
+			return 1 + dx/v0
+		}
+		v := math.Copysign(math.Sqrt(v0*v0+2*a*dx), v0)
+		return 1 + (v-v0)/a
+	}
+	var passes []pass
+	for _, g := range gates {
+		x := setup.Position(gateIndex(string(g)))
+		// the front of the flag enters the gate, and its back leaves it
+		flag := math.Copysign(setup.FlagLength, v0)
+		passes = append(passes, pass{string(g), at(x), at(x+flag) - at(x)})
+	}
+	return passes
+}
+
+func near(got, expected, tolerance float64) bool {
+	return math.Abs(got-expected) <= tolerance
+}
+
+func TestConstantVelocity(t *testing.T) {
+	r, ok := Analyze(track("both", motion(-0.1, 0.5, 0, Gates)...))
+	if !ok {
+		t.Fatal("no setup in the run")
+	}
+	if len(r.Crossings) != 4 || len(r.Intervals) != 3 || len(r.Accelerations) != 2 || !r.Transits() {
+		t.Fatalf("result %+v, expected 4 crossings with their transits, 3 intervals and 2 accelerations", r)
+	}
+	for i, c := range r.Crossings {
+		if c.Gate != Gates[i:i+1] || !near(c.Transit.Value, 0.1, 1e-9) || !near(c.Velocity.Value, 0.5, 1e-9) {
+			t.Errorf("crossing %+v, expected a transit of 0.1 s at 0.5 m/s", c)
+		}
+		if expected := seconds(1.2 + 0.8*float64(i)); c.Time != expected {
+			t.Errorf("crossing of %s at %v, expected at %v", c.Gate, c.Time, expected)
+		}
+	}
+	for _, in := range r.Intervals {
+		if !near(in.Duration.Value, 0.8, 1e-9) || !near(in.Velocity.Value, 0.5, 1e-9) {
+			t.Errorf("interval %+v, expected 0.8 s at 0.5 m/s", in)
+		}
+	}
+	// the uncertainties of the spacing, 1 mm, and of two edges, 100 us each
+	if s := r.Intervals[0].Velocity.String(); s != "0.5000 ± 0.0013" {
+		t.Errorf("velocity %s between A and B", s)
+	}
+	for _, acc := range r.Accelerations {
+		if !near(acc.Acceleration.Value, 0, 1e-9) {
+			t.Errorf("acceleration %+v, expected 0", acc)
+		}
+	}
+}
+
+func TestConstantAcceleration(t *testing.T) {
+	r := AnalyzeWith(track("both", motion(-0.1, 0.3, 0.5, Gates)...), DefaultSetup())
+	if len(r.Accelerations) != 2 {
+		t.Fatalf("accelerations %+v, expected ABC and BCD", r.Accelerations)
+	}
+	// the mean velocity of an interval is the one at its middle
+	for _, acc := range r.Accelerations {
+		if !near(acc.Acceleration.Value, 0.5, 1e-6) {
+			t.Errorf("acceleration %s of %s, expected 0.500", acc.Acceleration, acc.Gates)
+		}
+	}
+	for i := 1; i < len(r.Crossings); i++ {
+		if r.Crossings[i].Velocity.Value <= r.Crossings[i-1].Velocity.Value {
+			t.Errorf("velocity %v at %s, not greater than at the gate before", r.Crossings[i].Velocity, r.Crossings[i].Gate)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	// from D to A
+	r := AnalyzeWith(track("both", motion(1.3, -0.5, 0, "DCBA")...), DefaultSetup())
+	if len(r.Crossings) != 4 || len(r.Intervals) != 3 {
+		t.Fatalf("result %+v, expected 4 crossings and 3 intervals", r)
+	}
+	for _, c := range r.Crossings {
+		if !near(c.Transit.Value, 0.1, 1e-9) {
+			t.Errorf("crossing %+v, expected a transit of 0.1 s", c)
+		}
+	}
+	for _, in := range r.Intervals {
+		if !near(in.Velocity.Value, -0.5, 1e-9) || in.Velocity.Error <= 0 || !near(in.Duration.Value, -0.8, 1e-9) {
+			t.Errorf("interval %+v, expected -0.8 s at -0.5 m/s", in)
+		}
+	}
+	for _, acc := range r.Accelerations {
+		if !near(acc.Acceleration.Value, 0, 1e-9) {
+			t.Errorf("acceleration %+v, expected 0", acc)
+		}
+	}
+}
+
+func TestMissingGates(t *testing.T) {
+	// the gate C doesn't see the cart
+	r := AnalyzeWith(track("both", motion(-0.1, 0.5, 0, "ABD")...), DefaultSetup())
+	if len(r.Crossings) != 3 || len(r.Intervals) != 2 {
+		t.Fatalf("result %+v, expected 3 crossings and 2 intervals", r)
+	}
+	bd := r.Intervals[1]
+	if bd.Gates != "BD" || !near(bd.Duration.Value, 1.6, 1e-9) || !near(bd.Velocity.Value, 0.5, 1e-9) {
+		t.Errorf("interval %+v, expected BD 1.6 s at 0.5 m/s", bd)
+	}
+	// two spacings measured
+	if expected := 0.5 * math.Hypot(math.Sqrt2*0.001/0.8, math.Sqrt2*0.0001/1.6); !near(bd.Velocity.Error, expected, 1e-12) {
+		t.Errorf("error %v of the velocity between B and D, expected %v", bd.Velocity.Error, expected)
+	}
+
+	// only the gate A
+	r = AnalyzeWith(track("both", motion(-0.1, 0.5, 0, "A")...), DefaultSetup())
+	if len(r.Crossings) != 1 || len(r.Intervals) != 0 || len(r.Accelerations) != 0 {
+		t.Errorf("result %+v, expected only the crossing of A", r)
+	}
+	// none, as a run without the cart
+	if r = AnalyzeWith(track("both"), DefaultSetup()); len(r.Crossings) != 0 {
+		t.Errorf("crossings %+v without passes", r.Crossings)
+	}
+}
+
+func TestRisingOnly(t *testing.T) {
+	r, ok := Analyze(track("rising", motion(-0.1, 0.5, 0, Gates)...))
+	if !ok {
+		t.Fatal("no setup in the run")
+	}
+	if len(r.Crossings) != 4 || r.Transits() {
+		t.Fatalf("crossings %+v, expected 4 without transits", r.Crossings)
+	}
+	for _, c := range r.Crossings {
+		if c.Velocity.Value != 0 || c.Middle() != c.Time {
+			t.Errorf("crossing %+v, expected no velocity at the gate", c)
+		}
+	}
+	// the intervals and the accelerations only need the crossings
+	if len(r.Intervals) != 3 || !near(r.Intervals[0].Velocity.Value, 0.5, 1e-9) || len(r.Accelerations) != 2 {
+		t.Errorf("result %+v, expected 3 intervals at 0.5 m/s and 2 accelerations", r)
+	}
+
+	// only the falling edges: the crossings are when the flag leaves
+	r = AnalyzeWith(track("falling", motion(-0.1, 0.5, 0, Gates)...), DefaultSetup())
+	if len(r.Crossings) != 4 || r.Transits() || r.Crossings[0].Time != seconds(1.3) {
+		t.Errorf("crossings %+v, expected 4 when the flag leaves the gates", r.Crossings)
+	}
+}
+
+func TestNoSetup(t *testing.T) {
+	run := track("both", motion(-0.1, 0.5, 0, Gates)...)
+	run.Header.Settings = map[string]string{edgesKey: "both"}
+	if r, ok := Analyze(run); ok || r != nil {
+		t.Errorf("result %+v of a run without setup", r)
+	}
+}
@@ -0,0 +1,103 @@
+package kinematics
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// keys of the setup in the settings of the header of a run, the lengths in
+// m and the time in s
+const (
+	spacingKey     = "gateSpacing"
+	flagLengthKey  = "flagLength"
+	lengthErrorKey = "lengthError"
+	timeErrorKey   = "timeError"
+)
+
+// Setup the photogates of the track: where they are and what crosses them.
+// Lengths in m, times in s.
+type Setup struct {
+	// Spacings between the gates A and B, B and C, and C and D
+	Spacings [3]float64 `json:"gateSpacings"`
+	// FlagLength length of the flag of the cart
+	FlagLength float64 `json:"flagLength"`
+	// LengthError uncertainty of the lengths measured, as the resolution
+	// of the rule
+	LengthError float64 `json:"lengthError"`
+	// TimeError uncertainty of the time of an edge of a tracker
+	TimeError float64 `json:"timeError"`
+}
+
+// DefaultSetup gates every 40 cm, a flag of 5 cm measured to the mm, and
+// edges timed to 100 us
+func DefaultSetup() Setup {
+	return Setup{
+		Spacings:    [3]float64{0.4, 0.4, 0.4},
+		FlagLength:  0.05,
+		LengthError: 0.001,
+		TimeError:   0.0001,
+	}
+}
+
+// Valid the lengths are positive and the uncertainties not negative
+func (s Setup) Valid() bool {
+	for _, d := range s.Spacings {
+		if !positive(d) {
+			return false
+		}
+	}
+	return positive(s.FlagLength) && (s.LengthError == 0 || positive(s.LengthError)) &&
+		(s.TimeError == 0 || positive(s.TimeError))
+}
+
+func positive(v float64) bool {
+	return v > 0 && !math.IsInf(v, 1)
+}
+
+// Position of the gate, 0 for A ... 3 for D, from the gate A
+func (s Setup) Position(gate int) float64 {
+	position := 0.0
+	for _, d := range s.Spacings[:gate] {
+		position += d
+	}
+	return position
+}
+
+// Write the setup to the settings of a header: gateSpacingAB, ...,
+// flagLength, lengthError and timeError
+func (s Setup) Write(settings map[string]string) {
+	for i, d := range s.Spacings {
+		settings[spacingKey+Gates[i:i+2]] = formatUnit(d, "m")
+	}
+	settings[flagLengthKey] = formatUnit(s.FlagLength, "m")
+	settings[lengthErrorKey] = formatUnit(s.LengthError, "m")
+	settings[timeErrorKey] = formatUnit(s.TimeError, "s")
+}
+
+// ReadSetup reads the setup from the settings of a header; false if they
+// haven't a valid one, as the runs before the analysis
+func ReadSetup(settings map[string]string) (Setup, bool) {
+	var s Setup
+	ok := true
+	for i := range s.Spacings {
+		s.Spacings[i], ok = parseUnit(settings[spacingKey+Gates[i:i+2]], "m", ok)
+	}
+	s.FlagLength, ok = parseUnit(settings[flagLengthKey], "m", ok)
+	s.LengthError, ok = parseUnit(settings[lengthErrorKey], "m", ok)
+	s.TimeError, ok = parseUnit(settings[timeErrorKey], "s", ok)
+	return s, ok && s.Valid()
+}
+
+func formatUnit(v float64, unit string) string {
+	return strconv.FormatFloat(v, 'g', -1, 64) + unit
+}
+
+// parseUnit the value, with the unit, if ok so far
+func parseUnit(text, unit string, ok bool) (float64, bool) {
+	if !ok || !strings.HasSuffix(text, unit) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(text, unit), 64)
+	return v, err == nil
+}
@@ -0,0 +1,309 @@
+// Package live streams the records of a run to the browsers while it is
+// acquired.
+//
+// A Hub is one more sink of the pipeline of the run. It never blocks the
+// pipeline, and so the readers of the sensors: each client has a small queue
+// of messages, and what doesn't fit in it is dropped for that client and
+// counted. The records of the sensors are decimated for each client to its
+// rate, per source, while the events, as the edges of the trackers, are
+// always sent.
+//
+// The clients get the messages as Server-Sent Events:
+//
+//	event: run
+//	data: {"run":"cart/2","start":"...","sources":{"Ard":[{"name":"accX","unit":"g"},...],"A":[]}}
+//
+//	event: record
+//	data: {"source":"Ard","time":40849,"values":{"accX":-1.0,...}}
+//
+//	event: record
+//	data: {"source":"A","time":1250000,"values":{},"event":true}
+//
+//	event: stop
+//	data: {"run":"cart/2"}
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+// DefaultRate records per second and source sent to a client
+const DefaultRate = 10
+
+// MaxRate records per second and source a client can ask for
+const MaxRate = 50
+
+// DefaultQueue messages waiting to be sent to a client
+const DefaultQueue = 256
+
+// names of the events of the messages
+const (
+	// RunEvent a run begins, with its fields
+	RunEvent = "run"
+	// RecordEvent a record of the run
+	RecordEvent = "record"
+	// StopEvent the run has stopped
+	StopEvent = "stop"
+	// StatsEvent what has been sent to the client and dropped
+	StatsEvent = "stats"
+)
+
+// Message sent to the clients, a JSON object
+type Message struct {
+	Event string
+	Data  []byte
+}
+
+// Field a value of the records of a source
+type Field struct {
+	Name string `json:"name"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// Run the beginning of a run
+type Run struct {
+	Run   string    `json:"run"`
+	Start time.Time `json:"start"`
+	// Sources the fields of the records of each source
+	Sources map[string][]Field `json:"sources"`
+}
+
+// Stop the end of a run
+type Stop struct {
+	Run string `json:"run"`
+}
+
+// Record a record of the run
+type Record struct {
+	Source string `json:"source"`
+	// Time local time since the start of the run, in us
+	Time   int64              `json:"time"`
+	Values map[string]float64 `json:"values"`
+	// Event the record is an event, never decimated
+	Event bool `json:"event,omitempty"`
+}
+
+// Stats what has been sent to a client, and dropped because it was slow
+type Stats struct {
+	Sent    uint64 `json:"sent"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// Hub sends the records of the runs to its clients; the zero Hub has no
+// clients and is ready to use
+type Hub struct {
+	// Event tells the records to send always, without decimating them;
+	// nil if none
+	Event func(r record.Record) bool
+
+	mutex   sync.RWMutex
+	clients map[*Client]bool
+	start   time.Time
+	// last run begun, for the clients arriving later
+	run *Message
+}
+
+// Client a receiver of the messages of a hub
+type Client struct {
+	messages chan Message
+	// minimum time between the records of a source, of the run
+	interval time.Duration
+	last     map[string]time.Time
+
+	mutex sync.Mutex
+	stats Stats
+}
+
+// Subscribe a new client receiving up to rate records per second of each
+// source, between 0 and MaxRate; the events are always received. If a run is
+// being streamed, its beginning is the first message.
+func (h *Hub) Subscribe(rate float64, queue int) *Client {
+	if rate <= 0 || math.IsNaN(rate) {
+		rate = DefaultRate
+	}
+	if rate > MaxRate {
+		rate = MaxRate
+	}
+	if queue <= 0 {
+		queue = DefaultQueue
+	}
+	c := &Client{
+		messages: make(chan Message, queue),
+		interval: time.Duration(float64(time.Second) / rate),
+		last:     make(map[string]time.Time),
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.run != nil {
+		c.send(*h.run)
+	}
+	if h.clients == nil {
+		h.clients = make(map[*Client]bool)
+	}
+	h.clients[c] = true
+	return c
+}
+
+// Unsubscribe the client, its messages are closed
+func (h *Hub) Unsubscribe(c *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.messages)
+	}
+}
+
+// Clients connected
+func (h *Hub) Clients() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
+
+// Begin streams a new run, identified by run, whose sources have the schemas
+func (h *Hub) Begin(run string, start time.Time, schemas map[string]*record.Schema) {
+	begin := Run{Run: run, Start: start, Sources: make(map[string][]Field)}
+	for source, schema := range schemas {
+		fields := []Field{}
+		for _, f := range schema.Fields {
+			fields = append(fields, Field{Name: f.Name, Unit: f.Unit})
+		}
+		begin.Sources[source] = fields
+	}
+	message, err := newMessage(RunEvent, begin)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.start = start
+	h.run = &message
+	for c := range h.clients {
+		c.mutex.Lock()
+		c.last = make(map[string]time.Time)
+		c.mutex.Unlock()
+		c.send(message)
+	}
+}
+
+// End the run streamed, identified by run
+func (h *Hub) End(run string) {
+	message, err := newMessage(StopEvent, Stop{Run: run})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.run = nil
+	for c := range h.clients {
+		c.send(message)
+	}
+}
+
+// Write sends the record to the clients wanting it, without waiting for
+// them; a record that can't be sent is logged, the pipeline goes on
+func (h *Hub) Write(r record.Record) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if len(h.clients) == 0 {
+		return nil
+	}
+	event := h.Event != nil && h.Event(r)
+	var message *Message
+	for c := range h.clients {
+		if !event && !c.due(r) {
+			continue
+		}
+		if message == nil {
+			m, err := newMessage(RecordEvent, h.newRecord(r, event))
+			if err != nil {
+				log.Println(err)
+				return nil
+			}
+			message = &m
+		}
+		c.send(*message)
+	}
+	return nil
+}
+
+// Flush does nothing, the messages are sent as they are written
+func (h *Hub) Flush() error {
+	return nil
+}
+
+func (h *Hub) newRecord(r record.Record, event bool) Record {
+	rec := Record{Source: r.Source, Time: int64(r.Time.Sub(h.start) / time.Microsecond),
+		Values: make(map[string]float64), Event: event}
+	if r.Schema != nil {
+		for i, f := range r.Schema.Fields {
+			// JSON has no NaN nor infinities
+			if i < len(r.Values) && !math.IsNaN(r.Values[i]) && !math.IsInf(r.Values[i], 0) {
+				rec.Values[f.Name] = r.Values[i]
+			}
+		}
+	}
+	return rec
+}
+
+// newMessage the message of the event with v in JSON
+func newMessage(event string, v interface{}) (Message, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Message{}, fmt.Errorf("live: %s event: %v", event, err)
+	}
+	return Message{Event: event, Data: data}, nil
+}
+
+// Messages to send to the client, closed when it is unsubscribed
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Stats of the client so far
+func (c *Client) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stats
+}
+
+// due true if the record of the source is the next one of the client, as
+// the time since the last one reaches its interval
+func (c *Client) due(r record.Record) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	last, ok := c.last[r.Source]
+	if ok && r.Time.Sub(last) < c.interval {
+		return false
+	}
+	c.last[r.Source] = r.Time
+	return true
+}
+
+// send the message if it fits in the queue, dropping it if not; the hub
+// must be locked, so the queue isn't closed
+func (c *Client) send(m Message) {
+	select {
+	case c.messages <- m:
+		c.count(1, 0)
+	default:
+		c.count(0, 1)
+	}
+}
+
+func (c *Client) count(sent, dropped uint64) {
+	c.mutex.Lock()
+	c.stats.Sent += sent
+	c.stats.Dropped += dropped
+	c.mutex.Unlock()
+}
@@ -0,0 +1,160 @@
+package live
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/record"
+)
+
+var (
+	start    = time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC)
+	imu      = &record.Schema{Fields: []record.Field{{Name: "accX", Unit: "g"}}}
+	tracker  = &record.Schema{}
+	trackerA = func(r record.Record) bool { return r.Source == "A" }
+)
+
+// at a record of the source ms after the start
+func at(source string, ms int, values ...float64) record.Record {
+	schema := tracker
+	if source == "Ard" {
+		schema = imu
+	}
+	return record.Record{Source: source, Schema: schema, Time: start.Add(time.Duration(ms) * time.Millisecond), Values: values}
+}
+
+// received the messages waiting for the client
+func received(c *Client) []Message {
+	var messages []Message
+	for n := len(c.Messages()); n > 0; n-- {
+		messages = append(messages, <-c.Messages())
+	}
+	return messages
+}
+
+func TestDecimation(t *testing.T) {
+	h := &Hub{Event: trackerA}
+	// a record of Ard each 50 ms is sent each 100 ms, and the tracker always
+	c := h.Subscribe(10, 0)
+	h.Begin("cart/2", start, map[string]*record.Schema{"Ard": imu, "A": tracker})
+	for ms := 0; ms <= 200; ms += 50 {
+		h.Write(at("Ard", ms, float64(ms)))
+	}
+	h.Write(at("A", 60))
+	h.Write(at("A", 70))
+	h.End("cart/2")
+
+	var events, times []string
+	for _, m := range received(c) {
+		events = append(events, m.Event)
+		if m.Event != RecordEvent {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(m.Data, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Event != (r.Source == "A") {
+			t.Errorf("record %+v, only the tracker is an event", r)
+		}
+		times = append(times, r.Source+":"+time.Duration(r.Time*int64(time.Microsecond)).String())
+	}
+	if e := strings.Join(events, " "); e != "run record record record record record stop" {
+		t.Errorf("events %s", e)
+	}
+	if s := strings.Join(times, " "); s != "Ard:0s Ard:100ms Ard:200ms A:60ms A:70ms" {
+		t.Errorf("records %s", s)
+	}
+}
+
+func TestRunOfLateClients(t *testing.T) {
+	h := &Hub{}
+	h.Begin("cart/2", start, map[string]*record.Schema{"Ard": imu})
+	c := h.Subscribe(MaxRate+1, 0)
+	h.Write(at("Ard", 0, math.NaN()))
+	messages := received(c)
+	if len(messages) != 2 || messages[0].Event != RunEvent {
+		t.Fatalf("messages %+v, expected the run and the record", messages)
+	}
+	var run Run
+	if err := json.Unmarshal(messages[0].Data, &run); err != nil {
+		t.Fatal(err)
+	}
+	if run.Run != "cart/2" || len(run.Sources["Ard"]) != 1 || run.Sources["Ard"][0] != (Field{"accX", "g"}) {
+		t.Errorf("run %+v", run)
+	}
+	// JSON has no NaN
+	if string(messages[1].Data) != `{"source":"Ard","time":0,"values":{}}` {
+		t.Errorf("record %s", messages[1].Data)
+	}
+	h.Unsubscribe(c)
+	if _, open := <-c.Messages(); open || h.Clients() != 0 {
+		t.Errorf("messages open or %d clients after unsubscribing", h.Clients())
+	}
+}
+
+func TestSlowClient(t *testing.T) {
+	h := &Hub{Event: trackerA}
+	slow, fast := h.Subscribe(0, 2), h.Subscribe(0, 10)
+	for ms := 0; ms < 5; ms++ {
+		// the writer never waits for the slow client
+		h.Write(at("A", ms))
+	}
+	if n := len(received(fast)); n != 5 {
+		t.Errorf("%d records received by the fast client, expected 5", n)
+	}
+	if stats := fast.Stats(); stats != (Stats{Sent: 5}) {
+		t.Errorf("stats %+v of the fast client", stats)
+	}
+	if n := len(received(slow)); n != 2 {
+		t.Errorf("%d records received by the slow client, expected the 2 of its queue", n)
+	}
+	if stats := slow.Stats(); stats != (Stats{Sent: 2, Dropped: 3}) {
+		t.Errorf("stats %+v of the slow client, expected 2 sent and 3 dropped", stats)
+	}
+}
+
+func TestNewMessageError(t *testing.T) {
+	if _, err := newMessage(StatsEvent, math.Inf(1)); err == nil {
+		t.Error("no error with a value JSON can't encode")
+	}
+	m, err := newMessage(StopEvent, Stop{Run: "cart/2"})
+	if err != nil || string(m.Data) != `{"run":"cart/2"}` {
+		t.Errorf("message %s, %v", m.Data, err)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	h := &Hub{}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "?rate=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type %q", ct)
+	}
+	for h.Clients() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	h.End("cart/2")
+
+	lines := bufio.NewScanner(resp.Body)
+	var stream []string
+	for len(stream) < 3 && lines.Scan() {
+		if lines.Text() != "" {
+			stream = append(stream, lines.Text())
+		}
+	}
+	if s := strings.Join(stream, "|"); s != `retry: 2000|event: stop|data: {"run":"cart/2"}` {
+		t.Errorf("stream %q", s)
+	}
+}
@@ -0,0 +1,71 @@
+package live
+
+import (
+	"bufio"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatsInterval time between the stats events sent to each client, which
+// also keep the connection alive between runs
+const StatsInterval = 5 * time.Second
+
+// ServeHTTP streams the messages of the hub to the client as Server-Sent
+// Events, with ?rate= records per second of each source at most
+func (h *Hub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "live: streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	rate, _ := strconv.ParseFloat(req.FormValue("rate"), 64)
+	c := h.Subscribe(rate, DefaultQueue)
+	defer h.Unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	out := bufio.NewWriter(w)
+	// reconnect soon if the connection is lost
+	out.WriteString("retry: 2000\n\n")
+
+	ticker := time.NewTicker(StatsInterval)
+	defer ticker.Stop()
+	for {
+		if out.Flush() != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-req.Context().Done():
+			return
+		case m, ok := <-c.Messages():
+			if !ok {
+				return
+			}
+			writeEvent(out, m)
+			// and the ones already waiting, in the same flush
+			for n := len(c.Messages()); n > 0; n-- {
+				if m, ok = <-c.Messages(); ok {
+					writeEvent(out, m)
+				}
+			}
+		case <-ticker.C:
+			m, err := newMessage(StatsEvent, c.Stats())
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			writeEvent(out, m)
+		}
+	}
+}
+
+func writeEvent(out *bufio.Writer, m Message) {
+	out.WriteString("event: ")
+	out.WriteString(m.Event)
+	out.WriteString("\ndata: ")
+	out.Write(m.Data)
+	out.WriteString("\n\n")
+}
@@ -0,0 +1,136 @@
+package record
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DefaultCapacity records buffered by a pipeline
+const DefaultCapacity = 4096
+
+// Sink destination of the records
+type Sink interface {
+	// Write a record; it may be buffered till Flush
+	Write(r Record) error
+	// Flush what was buffered
+	Flush() error
+}
+
+// Stats accounting of a pipeline
+type Stats struct {
+	// Capacity of the buffer
+	Capacity int
+	// Policy when the buffer is full
+	Policy Policy
+	// Put records accepted by the buffer
+	Put uint64
+	// Dropped records lost because the buffer was full
+	Dropped uint64
+	// HighWater most records ever waiting in the buffer
+	HighWater int
+	// Written records handed to the sinks
+	Written uint64
+	// Errors of the sinks
+	Errors uint64
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("capacity=%d policy=%s put=%d dropped=%d highWater=%d written=%d errors=%d",
+		s.Capacity, s.Policy, s.Put, s.Dropped, s.HighWater, s.Written, s.Errors)
+}
+
+// Pipeline buffers the records put by the readers and writes them to the
+// sinks from a single goroutine
+type Pipeline struct {
+	ring  *Ring
+	sinks []Sink
+	done  chan struct{}
+	close sync.Once
+
+	mutex   sync.Mutex
+	written uint64
+	errors  uint64
+	err     error
+}
+
+// NewPipeline starts the writer of the records to the sinks
+func NewPipeline(capacity int, policy Policy, sinks ...Sink) *Pipeline {
+	p := &Pipeline{
+		ring:  NewRing(capacity, policy),
+		sinks: sinks,
+		done:  make(chan struct{}),
+	}
+	go p.write()
+	return p
+}
+
+// Put the record in the buffer; false if a record was dropped
+func (p *Pipeline) Put(r Record) bool {
+	return p.ring.Put(r)
+}
+
+func (p *Pipeline) write() {
+	defer close(p.done)
+	var batch []Record
+	for {
+		batch = p.ring.Take(batch)
+		if len(batch) == 0 {
+			// closed and drained
+			return
+		}
+		for _, r := range batch {
+			for _, sink := range p.sinks {
+				p.check(sink.Write(r))
+			}
+		}
+		// the buffer is empty, let the records reach the storage
+		for _, sink := range p.sinks {
+			p.check(sink.Flush())
+		}
+		p.mutex.Lock()
+		p.written += uint64(len(batch))
+		p.mutex.Unlock()
+	}
+}
+
+func (p *Pipeline) check(err error) {
+	if err == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.errors++
+	if p.err == nil {
+		p.err = err
+	}
+	p.mutex.Unlock()
+}
+
+// Stats of the pipeline so far
+func (p *Pipeline) Stats() Stats {
+	r := p.ring
+	r.mutex.Lock()
+	s := Stats{
+		Capacity:  len(r.records),
+		Policy:    r.policy,
+		Put:       r.put,
+		Dropped:   r.dropped,
+		HighWater: r.highWater,
+	}
+	r.mutex.Unlock()
+	p.mutex.Lock()
+	s.Written = p.written
+	s.Errors = p.errors
+	p.mutex.Unlock()
+	return s
+}
+
+// Close waits till every buffered record is written and flushed; it
+// returns the first error of the sinks
+func (p *Pipeline) Close() (Stats, error) {
+	p.close.Do(p.ring.Close)
+	<-p.done
+	p.mutex.Lock()
+	err := p.err
+	p.mutex.Unlock()
+	return p.Stats(), err
+}
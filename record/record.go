@@ -0,0 +1,71 @@
+// Package record is the pipeline of the records acquired in a run.
+//
+// The readers of the sensors build typed records, the values of a source
+// described by its Schema, and put them in a Pipeline. The pipeline keeps
+// them in a bounded ring buffer, so a slow storage doesn't stall the
+// readers, and a single goroutine hands them to the sinks, as the writer
+// of the data file. What doesn't fit in the buffer is accounted for.
+package record
+
+import (
+	"strings"
+	"time"
+)
+
+// kinds of the values
+const (
+	// Int integer value, as the times in microseconds
+	Int Kind = iota
+	// Float real value
+	Float
+)
+
+// Kind how a value is written
+type Kind int
+
+// Field a value of the records of a source
+type Field struct {
+	Name string
+	// Unit may be empty
+	Unit string
+	Kind Kind
+}
+
+// Label the name of the field, with its unit: "distance(mm)"
+func (f Field) Label() string {
+	if f.Unit == "" {
+		return f.Name
+	}
+	return f.Name + "(" + f.Unit + ")"
+}
+
+// Schema the fields of the records of a source, after their local time
+type Schema struct {
+	Fields []Field
+}
+
+// Add appends fields to the schema
+func (s *Schema) Add(fields ...Field) {
+	s.Fields = append(s.Fields, fields...)
+}
+
+// Labels the labels of the fields joined by sep
+func (s *Schema) Labels(sep string) string {
+	labels := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		labels[i] = f.Label()
+	}
+	return strings.Join(labels, sep)
+}
+
+// Record the values read from a source at a time
+type Record struct {
+	// Source name of the source: "Ard", "A"...
+	Source string
+	// Schema of the values
+	Schema *Schema
+	// Time local time of the reading
+	Time time.Time
+	// Values one for each field of the schema
+	Values []float64
+}
@@ -0,0 +1,136 @@
+package record
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Policy what Put does when the buffer is full
+type Policy int
+
+// policies
+const (
+	// Block waits for room: back-pressure on the readers
+	Block Policy = iota
+	// DropNewest drops the record being put
+	DropNewest
+	// DropOldest drops the oldest record of the buffer to make room
+	DropOldest
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy parses "block", "drop-newest" or "drop-oldest"
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range []Policy{Block, DropNewest, DropOldest} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("record: unknown policy %q", s)
+}
+
+// Ring bounded FIFO of records, safe for several goroutines
+type Ring struct {
+	mutex    sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	records  []Record
+	head     int
+	count    int
+	policy   Policy
+	closed   bool
+
+	// accounting
+	put       uint64
+	dropped   uint64
+	highWater int
+}
+
+// NewRing returns an empty ring of the capacity
+func NewRing(capacity int, policy Policy) *Ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	r := &Ring{records: make([]Record, capacity), policy: policy}
+	r.notEmpty = sync.NewCond(&r.mutex)
+	r.notFull = sync.NewCond(&r.mutex)
+	return r
+}
+
+// Put adds the record; false if it, or an older one, was dropped, or the
+// ring is closed
+func (r *Ring) Put(record Record) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for r.policy == Block && r.count == len(r.records) && !r.closed {
+		r.notFull.Wait()
+	}
+	if r.closed {
+		r.dropped++
+		return false
+	}
+	ok := true
+	if r.count == len(r.records) {
+		r.dropped++
+		if r.policy == DropNewest {
+			return false
+		}
+		// DropOldest
+		r.head = (r.head + 1) % len(r.records)
+		r.count--
+		ok = false
+	}
+	r.records[(r.head+r.count)%len(r.records)] = record
+	r.count++
+	r.put++
+	if r.count > r.highWater {
+		r.highWater = r.count
+	}
+	r.notEmpty.Signal()
+	return ok
+}
+
+// Take moves the buffered records to batch, waiting for them; it returns
+// an empty batch once the ring is closed and empty
+func (r *Ring) Take(batch []Record) []Record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for r.count == 0 && !r.closed {
+		r.notEmpty.Wait()
+	}
+	batch = batch[:0]
+	for ; r.count > 0; r.count-- {
+		batch = append(batch, r.records[r.head])
+		r.records[r.head] = Record{}
+		r.head = (r.head + 1) % len(r.records)
+	}
+	r.notFull.Broadcast()
+	return batch
+}
+
+// Close lets Take return what is left, and makes Put drop the records
+func (r *Ring) Close() {
+	r.mutex.Lock()
+	r.closed = true
+	r.notEmpty.Broadcast()
+	r.notFull.Broadcast()
+	r.mutex.Unlock()
+}
+
+// Len records buffered
+func (r *Ring) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.count
+}
@@ -0,0 +1,119 @@
+package record
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// numbered records 0 to n-1, by their first value
+func numbered(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{Source: "Ard", Values: []float64{float64(i)}}
+	}
+	return records
+}
+
+func numbers(records []Record) []int {
+	n := make([]int, len(records))
+	for i, r := range records {
+		n[i] = int(r.Values[0])
+	}
+	return n
+}
+
+func TestRingDropPolicies(t *testing.T) {
+	for _, c := range []struct {
+		policy Policy
+		kept   []int
+		ok     []bool
+		// records accepted by the ring
+		put uint64
+	}{
+		{DropNewest, []int{0, 1, 2}, []bool{true, true, true, false, false}, 3},
+		{DropOldest, []int{2, 3, 4}, []bool{true, true, true, false, false}, 5},
+	} {
+		r := NewRing(3, c.policy)
+		for i, record := range numbered(5) {
+			if ok := r.Put(record); ok != c.ok[i] {
+				t.Errorf("%s: put %d %v, expected %v", c.policy, i, ok, c.ok[i])
+			}
+		}
+		if kept := numbers(r.Take(nil)); !reflect.DeepEqual(kept, c.kept) {
+			t.Errorf("%s: kept %v, expected %v", c.policy, kept, c.kept)
+		}
+		if r.put != c.put || r.dropped != 2 {
+			t.Errorf("%s: put %d and dropped %d, expected %d and 2", c.policy, r.put, r.dropped, c.put)
+		}
+		if r.highWater != 3 {
+			t.Errorf("%s: high water %d, expected 3", c.policy, r.highWater)
+		}
+	}
+}
+
+func TestRingBlock(t *testing.T) {
+	r := NewRing(2, Block)
+	records := numbered(3)
+	r.Put(records[0])
+	r.Put(records[1])
+
+	put := make(chan bool)
+	go func() { put <- r.Put(records[2]) }()
+	select {
+	case <-put:
+		t.Fatal("put into a full ring without blocking")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if taken := numbers(r.Take(nil)); !reflect.DeepEqual(taken, []int{0, 1}) {
+		t.Errorf("taken %v, expected [0 1]", taken)
+	}
+	select {
+	case ok := <-put:
+		if !ok {
+			t.Error("blocked record dropped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("put still blocked with room")
+	}
+	if taken := numbers(r.Take(nil)); !reflect.DeepEqual(taken, []int{2}) {
+		t.Errorf("taken %v, expected [2]", taken)
+	}
+	if r.dropped != 0 {
+		t.Errorf("%d dropped blocking", r.dropped)
+	}
+}
+
+func TestRingClose(t *testing.T) {
+	r := NewRing(2, Block)
+	r.Put(numbered(1)[0])
+
+	// a put blocked on a full ring is released by Close, dropping
+	r.Put(numbered(2)[1])
+	put := make(chan bool)
+	go func() { put <- r.Put(Record{Source: "A", Values: []float64{9}}) }()
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+	if ok := <-put; ok {
+		t.Error("record put into a closed ring")
+	}
+
+	if taken := numbers(r.Take(nil)); !reflect.DeepEqual(taken, []int{0, 1}) {
+		t.Errorf("taken %v after closing, expected [0 1]", taken)
+	}
+	if taken := r.Take(nil); len(taken) != 0 {
+		t.Errorf("taken %v from a closed and empty ring", numbers(taken))
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []Policy{Block, DropNewest, DropOldest} {
+		if parsed, err := ParsePolicy(p.String()); err != nil || parsed != p {
+			t.Errorf("%s parsed as %v, %v", p, parsed, err)
+		}
+	}
+	if _, err := ParsePolicy("drop"); err == nil {
+		t.Error("unknown policy parsed")
+	}
+}
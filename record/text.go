@@ -0,0 +1,60 @@
+package record
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"time"
+)
+
+// TextSink writes the records as lines of text: the source in brackets,
+// the local time in microseconds since Time0, and the values, separated
+// by Sep
+//
+//	[Ard]; 40849; 286078321; 95; -1.000891
+type TextSink struct {
+	Sep   string
+	Time0 time.Time
+	w     *bufio.Writer
+	line  []byte
+}
+
+// NewTextSink returns a sink writing to w
+func NewTextSink(w io.Writer, sep string, time0 time.Time) *TextSink {
+	return &TextSink{Sep: sep, Time0: time0, w: bufio.NewWriter(w)}
+}
+
+// Write a line
+func (s *TextSink) Write(r Record) error {
+	line := append(s.line[:0], '[')
+	line = append(line, r.Source...)
+	line = append(line, ']')
+	line = append(line, s.Sep...)
+	line = strconv.AppendInt(line, int64(r.Time.Sub(s.Time0)/time.Microsecond), 10)
+	for i, v := range r.Values {
+		line = append(line, s.Sep...)
+		kind := Float
+		if r.Schema != nil && i < len(r.Schema.Fields) {
+			kind = r.Schema.Fields[i].Kind
+		}
+		line = AppendValue(line, kind, v)
+	}
+	line = append(line, '\n')
+	s.line = line
+	_, err := s.w.Write(line)
+	return err
+}
+
+// Flush the lines to the writer
+func (s *TextSink) Flush() error {
+	return s.w.Flush()
+}
+
+// AppendValue appends the text of the value: integers without decimals,
+// reals with six
+func AppendValue(b []byte, kind Kind, v float64) []byte {
+	if kind == Int {
+		return strconv.AppendInt(b, int64(v), 10)
+	}
+	return strconv.AppendFloat(b, v, 'f', 6, 64)
+}
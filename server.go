@@ -1,34 +1,57 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"bufio"
 	"bytes"
-	"encoding/binary"
 	"runtime"
 
-	"github.com/mrmorphic/hwio"
-	"github.com/tarm/serial"
+	"github.com/ecalman/OSHIWASP/acquisition"
+	"github.com/ecalman/OSHIWASP/api"
+	"github.com/ecalman/OSHIWASP/catalog"
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/experiment"
+	"github.com/ecalman/OSHIWASP/export"
+	"github.com/ecalman/OSHIWASP/frame"
+	"github.com/ecalman/OSHIWASP/gpio"
+	"github.com/ecalman/OSHIWASP/kinematics"
+	"github.com/ecalman/OSHIWASP/live"
+	"github.com/ecalman/OSHIWASP/record"
+	"github.com/ecalman/OSHIWASP/sim"
+	"github.com/ecalman/OSHIWASP/state"
+	"github.com/ecalman/OSHIWASP/transport"
+	"github.com/ecalman/OSHIWASP/view"
 )
 
 //sensors configuration
 
 const (
 
-	// CommDevName arduino serial comm related
-	CommDevName = "/dev/rfcomm1" //name of the BT device
-	//Bauds Bauds
-	Bauds = 9600 // bauds of the BT serial channel
+	//DefaultTrackerDebounce edges of a tracker closer than this (ms) to the
+	//last one are bounces
+	DefaultTrackerDebounce = 2.0
+	//DefaultTrackerMinInterval edges of a tracker closer than this (ms) to
+	//the last one of the same direction are re-triggers; 0 lets them pass
+	DefaultTrackerMinInterval = 0.0
 
 	//StatusLedPin pin which shows the status
 	StatusLedPin = "gpio7" // green
@@ -48,6 +71,9 @@ const (
 	TrackerCPin = "gpio17"
 	//TrackerDPin pin
 	TrackerDPin = "gpio4"
+
+	//nTrackers trackers of the base: A, B, C and D
+	nTrackers = 4
 	// ON sensor activated
 	ON = true
 	// OFF sensor deactivated
@@ -72,15 +98,24 @@ const (
 // StaticURL URL of the static content
 const StaticURL string = "/static/"
 
+// ExportURL URL of the exports of the data files
+const ExportURL string = "/export/"
+
+// LegacyURL URL of the data files of the versions before the experiments
+const LegacyURL string = "/legacy/"
+
+// APIURL root of the JSON API, with its version
+const APIURL string = api.Prefix
+
+// CatalogFile name of the file of the catalog in the data directory
+const CatalogFile string = "catalog.json"
+
 // StaticRoot path of the static content
 const StaticRoot string = "static/"
 
 // DataFilePath path of the data files on StaticRoot
 const DataFilePath string = "data/"
 
-// DataFileExtension extension of the data files
-const DataFileExtension string = ".csv"
-
 //level of attention of the messages
 const (
 	HIDE    = 0
@@ -90,13 +125,15 @@ const (
 	DANGER  = 4
 )
 
-//state of system
+//state of system, the transitions between them are in state.Experiment
 const (
-	INIT       = 0
-	CONFIGURED = 1
-	RUNNING    = 2
-	STOPPED    = 3
-	POWEROFF   = -1
+	INIT       = state.Init
+	CONFIGURED = state.Configured
+	RUNNING    = state.Running
+	STOPPED    = state.Stopped
+	STARTING   = state.Starting
+	STOPPING   = state.Stopping
+	POWEROFF   = state.Poweroff
 )
 
 //language
@@ -117,9 +154,12 @@ var (
 	titleRun         [nLangs]string
 	titleStop        [nLangs]string
 	titleCollect     [nLangs]string
+	titleManage      [nLangs]string
 	titlePoweroff    [nLangs]string
 	titleAbout       [nLangs]string
 	titleHelp        [nLangs]string
+	titlePlot        [nLangs]string
+	titleView        [nLangs]string
 	titleTheEnd      [nLangs]string
 )
 
@@ -135,22 +175,45 @@ var (
 	messageConfigICSGet       [nLangs]string
 	messageConfigICSPost      [nLangs]string
 	messageConfigR            [nLangs]string
+	messageConfigFilter       [nLangs]string
+	messageConfigPhotogates   [nLangs]string
+	messageConfigUnique       [nLangs]string
+	messageNameEmpty          [nLangs]string
+	messageNameLong           [nLangs]string
+	messageNameChar           [nLangs]string
+	messageNameStart          [nLangs]string
 	messageTestI              [nLangs]string
 	messageTestR              [nLangs]string
 	messageTestCS             [nLangs]string
 	messageRunI               [nLangs]string
 	messageRunR               [nLangs]string
 	messageRunCS              [nLangs]string
+	messageRunFile            [nLangs]string
 	messageStopIC             [nLangs]string
 	messageStopR              [nLangs]string
 	messageStopS              [nLangs]string
+	messageStopStarting       [nLangs]string
+	messageStopStopping       [nLangs]string
 	messageCollectICS0        [nLangs]string
 	messageCollectICS         [nLangs]string
 	messageCollectR           [nLangs]string
+	messageCollectQuery0      [nLangs]string
+	messageNotes              [nLangs]string
+	messagePlotR              [nLangs]string
+	messagePlotICS            [nLangs]string
+	messageView               [nLangs]string
+	messageView0              [nLangs]string
+	messageManage             [nLangs]string
+	messageManageConfirm      [nLangs]string
+	messageManageDone         [nLangs]string
+	messageManageError        [nLangs]string
+	messageManageAction       [nLangs]string
+	messageManageR            [nLangs]string
 	messagePoweroffICSGet     [nLangs]string
 	messagePoweroffICSPostYes [nLangs]string
 	messagePoweroffICSPostNo  [nLangs]string
 	messagePoweroffR          [nLangs]string
+	messageState              [nLangs]string
 )
 
 //Context data about the configuration of the system and the web page
@@ -162,8 +225,9 @@ type Context struct {
 	Message    string
 	AlertLevel int // HIDE, INFO, SUCCESS, WARNING, DANGER
 
-	//state of the processed
-	State int //INIT, CONFIGURED, RUNNING, STOPPED
+	//state of the processed: INIT, CONFIGURED, STARTING, RUNNING, STOPPED,
+	//POWEROFF
+	State *state.Machine
 	//time of acquisition
 	Time0 time.Time
 	//language
@@ -171,15 +235,62 @@ type Context struct {
 
 	//configuration name of the system
 	ConfigurationName string
+	//name entered in the config form, and whether it is wrong
+	NameInput string
+	NameError bool
 	// DataFilePath
 	DataFile *os.File
-	//datafiles in the data directory
-	DataFiles []string
+	//run being acquired, or the last one
+	Run experiment.Run
+	//who does the runs, and the notes of the run, for the catalog
+	Operator string
+	Notes    string
+	//search in the catalog, in the collect page
+	Query string
+	//runs archived and deleted, in the manage page
+	Archived []Collection
+	Trashed  []Collection
+	//action on a run waiting for confirmation, and the run
+	Action     string
+	Target     catalog.Entry
+	TargetArea string
 	//data file name
 	DataFileName string
+	//experiments and their runs, in the collect page
+	Collections []Collection
+	//data files of the versions before the experiments, only to download
+	LegacyFiles []string
+	//run shown in the viewer, its plots and the events of its trackers
+	Viewed catalog.Entry
+	View   view.Run
 
 	//arduino
-	SerialPort *serial.Port
+	Transport transport.Config
+	Arduino   *transport.Interruptible
+	//decoder of the frames sent by the arduino, or the lines of the ESP32
+	decoder frame.Source
+	//quality of the link with the arduino
+	LinkStats frame.Stats
+	//readers and writer of the data of the run
+	supervisor *acquisition.Supervisor
+	pipeline   *record.Pipeline
+	//values of the records of the arduino and the trackers
+	arduinoSchema *record.Schema
+	trackerSchema *record.Schema
+	//writer of the data file of the run
+	dataWriter *datafile.Writer
+	//what was flushed to the data file when the run stopped
+	Acquisition acquisition.Report
+
+	//filters of the edges of the trackers A, B, C and D, in ms
+	TrackerDebounce    [nTrackers]float64
+	TrackerMinInterval [nTrackers]float64
+	//edges dropped by the filters in the run
+	TrackerSuppressed [nTrackers]uint64
+	//photogates of the trackers A, B, C and D, and their kinematics in the
+	//run stopped or viewed; nil without the setup
+	Photogates kinematics.Setup
+	Kinematics *kinematics.Result
 
 	//settings of the sensors: ON or OFF
 	SetTrackerA      bool
@@ -201,97 +312,163 @@ type Context struct {
 	StateOfGyroscope     int
 }
 
-// SensorDataInBytes data for sensors in Arduino in bytes
-type SensorDataInBytes struct {
-	trackerMicroSecondsInBytes []byte
-	sensorMicroSecondsInBytes  []byte
-	distanceInBytes            []byte
-	accXInBytes                []byte
-	accYInBytes                []byte
-	accZInBytes                []byte
-	gyrXInBytes                []byte
-	gyrYInBytes                []byte
-	gyrZInBytes                []byte
-}
-
-// SensorData data for sensors in Arduino in numerical data types
-type SensorData struct {
-	trackerMicroSeconds uint32
-	sensorMicroSeconds  uint32
-	distance            uint32
-	accX                float32
-	accY                float32
-	accZ                float32
-	gyrX                float32
-	gyrY                float32
-	gyrZ                float32
+// Collection an experiment offered in the collect page, with its runs
+type Collection struct {
+	Name string
+	Runs []catalog.Entry
+	// Tables with data in any of the runs
+	Tables []string
 }
 
 // Oshiwasp definition of configPuration of raspberry sensors, leds and buttons
 type Oshiwasp struct {
-	statusLed hwio.Pin
-	actionLed hwio.Pin
-	buttonA   hwio.Pin
-	buttonB   hwio.Pin
-	trackerA  hwio.Pin
-	trackerB  hwio.Pin
-	trackerC  hwio.Pin
-	trackerD  hwio.Pin
+	//gpio of the raspi, or the simulated one
+	board gpio.Board
+
+	statusLed gpio.Pin
+	actionLed gpio.Pin
+	buttonA   gpio.Pin
+	buttonB   gpio.Pin
+	trackerA  gpio.Pin
+	trackerB  gpio.Pin
+	trackerC  gpio.Pin
+	trackerD  gpio.Pin
+
+	//filters of the edges of the trackers in the run, nil if not watched
+	filters [nTrackers]*gpio.Filter
 }
 
 var (
 	c chan int //channel initialitation
-	//actionLed hwio.Pin // indicating action in the system
+	//actionLed gpio.Pin // indicating action in the system
 
 	// templates = template.Must(template.ParseGlob(tmplPath+"*.tmpl"))
 	// validPath = regexp.MustCompile("^/(index|new|status|start|pause|resume|stop|download|data)/([a-zA-Z0-9]+)$")
 
-	theSensorData        = new(SensorData)
-	theSensorDataInBytes = new(SensorDataInBytes)
-
 	//All the context of the execution with system and web data
 	theContext Context //theAcq=new(Acquisition)
 
 	theOshi = new(Oshiwasp)
+
+	//cart of the simulated platform, nil with the real one
+	theCart *sim.Cart
+	//frames per second of the simulated arduino
+	simRate float64
+
+	//ask the Arduino to escape the bytes of the frames, so the end mark '$'
+	//can't be found inside the data
+	escapedFraming = true
+	//ask the Arduino to add a checksum to the frames
+	frameChecksum = true
+	//file recording the frames read from the Arduino, to replay them
+	captureFile string
+	//log every record and every edge of the trackers
+	verbose bool
+
+	//edges of the trackers written to the data file: both, so the
+	//kinematics of the photogates has the transit times through them
+	trackerEdges = gpio.Both
+
+	//photogates of a new configuration: the ones of the simulated track,
+	//or the default ones
+	defaultPhotogates = kinematics.DefaultSetup()
+
+	//records buffered for the data file, and what to do when it is full
+	recordBuffer = record.DefaultCapacity
+	recordPolicy = record.DropOldest
+
+	//runs of the experiments in the data directory
+	theStore = experiment.NewStore(filepath.Join(StaticRoot, DataFilePath))
+	//record of the runs, with their notes
+	theCatalog *catalog.Catalog
+	//records of the run streamed to the browsers, the edges of the trackers
+	//and the ones with the sync of the tracker M always
+	theHub = &live.Hub{Event: liveEvent}
+	//configuration and run told by the API, and its lock
+	theStatus   runStatus
+	statusMutex sync.Mutex
+	//lock of the context, held by the pages and the API while they read or
+	//change it
+	contextMutex sync.Mutex
+	//JSON API of the platform, with the records of the runs streamed
+	theAPI = &api.Handler{Platform: platform{}, Live: theHub}
+
+	//trackerNames names of the trackers of the base, in the data file
+	trackerNames = [nTrackers]string{"A", "B", "C", "D"}
 )
 
 //AAAAAAAAAAAAAA
 // Acquisition section
 //AAAAAAAAAAAAAA
 
-func (cntxt *Context) connectArduinoSerialBT() {
-	var err error
-	// config the comm port for serial via BT
-	commPort := &serial.Config{Name: CommDevName, Baud: Bauds}
-	// open the serial comm with the arduino via BT
-	cntxt.SerialPort, err = serial.OpenPort(commPort)
+func (cntxt *Context) connectArduino() {
+	if theCart != nil {
+		// the arduino rides the simulated cart
+		cntxt.Arduino = transport.NewInterruptible(sim.NewArduino(theCart, simRate))
+		log.Printf("Open simulated Arduino")
+		return
+	}
+	// open the comm with the arduino: BT, USB, TCP, UDP or file
+	arduino, err := transport.Open(cntxt.Transport)
 	if err != nil {
-		log.Printf("error opening the serial port with Arduino")
+		log.Printf("error opening the transport with Arduino")
 		log.Fatal(err)
 	}
+	if captureFile != "" {
+		capture, err := os.Create(captureFile)
+		if err == nil {
+			arduino, err = transport.Record(arduino, capture, transport.Framing{Escaped: escapedFraming, Checksum: frameChecksum})
+		}
+		if err != nil {
+			log.Printf("error creating the capture of the Arduino")
+			log.Fatal(err)
+		}
+		log.Printf("Recording the frames to %s", captureFile)
+	}
+	// the reads are interrupted to stop the run
+	cntxt.Arduino = transport.NewInterruptible(arduino)
 	//defer acq.serialPort.Close()
-	log.Printf("Open serial device %s", CommDevName)
+	log.Printf("Open transport %s", cntxt.Transport)
+}
+
+//framing of the frames of the Arduino: the one of the capture replayed, as
+//it was recorded, or else the one asked to the firmware
+func (cntxt *Context) framing() transport.Framing {
+	if capture, ok := cntxt.Arduino.Transport.(transport.Capture); ok {
+		return capture.Framing()
+	}
+	return transport.Framing{Escaped: escapedFraming, Checksum: frameChecksum}
 }
 
-func setArduinoStateON() {
+//setArduinoStateON asks the Arduino to send its frames, with the framing
+//of the run
+func setArduinoStateON() error {
+	// set the framing before the first frame is sent: 'e' escaped, 'r' raw,
+	// 'c' with checksum, 'u' unchecked
+	framing := theContext.framing()
+	commands := "r"
+	if framing.Escaped {
+		commands = "e"
+	}
+	if framing.Checksum {
+		commands += "c"
+	} else {
+		commands += "u"
+	}
 	// activate the readdings in Arduino sending 'ON'
-	log.Printf("before write on")
-	_, err := theContext.SerialPort.Write([]byte("n"))
-	log.Printf("after write on")
-	if err != nil {
-		log.Fatal(err)
+	if _, err := theContext.Arduino.Write([]byte(commands + "n")); err != nil {
+		return fmt.Errorf("error setting Arduino ON: %v", err)
 	}
+	return nil
 }
 
-func setArduinoStateOFF() {
+//setArduinoStateOFF asks the Arduino to stop sending
+func setArduinoStateOFF() error {
 	// deactivate the readdings in Artudino sending 'OFF'
-	log.Printf("before write off")
-	_, err := theContext.SerialPort.Write([]byte("f"))
-	log.Printf("after write off")
-	if err != nil {
-		log.Printf("error!! after write off")
-		log.Fatal(err)
+	if _, err := theContext.Arduino.Write([]byte("f")); err != nil {
+		return fmt.Errorf("error setting Arduino OFF: %v", err)
 	}
+	return nil
 }
 
 func (cntxt *Context) setTime0() {
@@ -302,38 +479,6 @@ func (cntxt *Context) getTime0() time.Time {
 	return cntxt.Time0
 }
 
-func (cntxt *Context) createOutputFile() {
-	var e error
-	cntxt.DataFileName = DataFilePath + cntxt.ConfigurationName + DataFileExtension
-	cntxt.DataFile, e = os.Create(cntxt.DataFileName)
-	if e != nil {
-		panic(e)
-	}
-	statusLine := fmt.Sprintf("### %v Data Acquisition: %s \n\n", time.Now(), cntxt.ConfigurationName)
-	cntxt.DataFile.WriteString(statusLine)
-	formatLine := fmt.Sprintf("### [Ard], localTime(us), sensorTime(us)")
-	if cntxt.SetTrackerM == ON {
-		formatLine += fmt.Sprintf(", trackerTime(us)")
-	}
-	if cntxt.SetDistance == ON {
-		formatLine += fmt.Sprintf(", distance(mm)")
-	}
-	if cntxt.SetAccelerometer == ON {
-		formatLine += fmt.Sprintf(", accX(g)")
-		formatLine += fmt.Sprintf(", accY(g)")
-		formatLine += fmt.Sprintf(", accZ(g)")
-	}
-	if cntxt.SetGyroscope == ON {
-		formatLine += fmt.Sprintf(", gyrX(gr/s)")
-		formatLine += fmt.Sprintf(", gyrY(gr/s)")
-		formatLine += fmt.Sprintf(", gyrZ(gr/s)")
-	}
-	formatLine += fmt.Sprintf("\n\n")
-	cntxt.DataFile.WriteString(formatLine)
-
-	log.Printf("Cretated output File %s", cntxt.DataFileName)
-}
-
 func (cntxt *Context) initiate() {
 
 	//set language
@@ -359,20 +504,26 @@ func (cntxt *Context) initiate() {
 	titleStop[SPANISH] = "Parada"
 	titleCollect[ENGLISH] = "Collect Data"
 	titleCollect[SPANISH] = "Recopilar los Datos"
+	titleManage[ENGLISH] = "Manage the Data"
+	titleManage[SPANISH] = "Gestionar los Datos"
 	titlePoweroff[ENGLISH] = "Power off"
 	titlePoweroff[SPANISH] = "Apagar"
 	titleAbout[ENGLISH] = "About"
 	titleAbout[SPANISH] = "Sobre mi"
 	titleHelp[ENGLISH] = "Help"
 	titleHelp[SPANISH] = "Ayuda"
+	titlePlot[ENGLISH] = "Live plots"
+	titlePlot[SPANISH] = "Gráficas en vivo"
+	titleView[ENGLISH] = "Run viewer"
+	titleView[SPANISH] = "Visor de la ejecución"
 	titleTheEnd[ENGLISH] = "The End"
 	titleTheEnd[SPANISH] = "Fin"
 
 	//set the messages of the pages
 	messageThePlatform[ENGLISH] = "Description of the Platform"
 	messageThePlatform[SPANISH] = "Descripción de la Plataforma"
-	messageInitICSGet[ENGLISH] = "Warning! You are erasing the configuration, the datafiles and restoring the platform to it's initial state."
-	messageInitICSGet[SPANISH] = "Atención! Está borrando la configuración, los archivos con los datos y restaurando la plataforma a su estado inicial."
+	messageInitICSGet[ENGLISH] = "Warning! You are erasing the configuration and restoring the platform to it's initial state. The datafiles are moved to the trash, where they can be restored from."
+	messageInitICSGet[SPANISH] = "Atención! Está borrando la configuración y restaurando la plataforma a su estado inicial. Los archivos con los datos se mueven a la papelera, desde donde se pueden restaurar."
 	messageInitICSPostYes[ENGLISH] = "The platform is now in the initial state. Now you must define a new configuration berofe run an experiment."
 	messageInitICSPostYes[SPANISH] = "La plataforma ahora está en su estado inicial. Debe definir una nueva configuración antres de ejecutar un experimento."
 	messageInitICSPostNo[ENGLISH] = "The platform initialization is canceled. The current configuration is active."
@@ -389,6 +540,20 @@ func (cntxt *Context) initiate() {
 	messageConfigICSPost[SPANISH] = "Configuración hecha! Ahora puede comprobar la plataforma o ejecutar el experimento"
 	messageConfigR[ENGLISH] = "Experiment is running! It MUST be stopped before a new configuration done."
 	messageConfigR[SPANISH] = "Experimento en ejecución! Debe ser parado antes de fijar una configuración nueva."
+	messageConfigFilter[ENGLISH] = "The debounce and the minimum interval of the trackers must be numbers of milliseconds, zero or greater."
+	messageConfigFilter[SPANISH] = "El antirrebote y el intervalo mínimo de los trackers deben ser números de milisegundos, cero o mayores."
+	messageConfigPhotogates[ENGLISH] = "The spacings of the gates and the length of the flag must be meters greater than zero, and their uncertainties zero or greater."
+	messageConfigPhotogates[SPANISH] = "Las distancias entre las puertas y la longitud de la bandera deben ser metros mayores que cero, y sus incertidumbres cero o mayores."
+	messageConfigUnique[ENGLISH] = "There is already an experiment called %q, so this configuration is called %q. Now the platform can be tested or runned the experiment"
+	messageConfigUnique[SPANISH] = "Ya hay un experimento llamado %q, así que esta configuración se llama %q. Ahora puede comprobar la plataforma o ejecutar el experimento"
+	messageNameEmpty[ENGLISH] = "The configuration must have a name."
+	messageNameEmpty[SPANISH] = "La configuración debe tener un nombre."
+	messageNameLong[ENGLISH] = "The name %q is too long, it can have up to %d characters."
+	messageNameLong[SPANISH] = "El nombre %q es demasiado largo, puede tener hasta %d caracteres."
+	messageNameChar[ENGLISH] = "The name %q is not valid, it can only have letters without accents, digits, \"-\" and \"_\"."
+	messageNameChar[SPANISH] = "El nombre %q no es válido, solo puede tener letras sin tildes, dígitos, \"-\" y \"_\"."
+	messageNameStart[ENGLISH] = "The name %q is not valid, it must start by a letter or a digit."
+	messageNameStart[SPANISH] = "El nombre %q no es válido, debe empezar por una letra o un dígito."
 	messageTestI[ENGLISH] = "The platform must be configured before you could test it!"
 	messageTestI[SPANISH] = "La plataforma debe ser configurada antes de que pueda ser comprobada!"
 	messageTestR[ENGLISH] = "Warning! You must stop the experimento before test the system."
@@ -401,16 +566,46 @@ func (cntxt *Context) initiate() {
 	messageRunR[SPANISH] = "Experimento YA en ejecución!"
 	messageRunCS[ENGLISH] = "Experiment running and gathering data from sensors."
 	messageRunCS[SPANISH] = "Experimento en ejecución y adquiriendo datos de los sensoresción y adquiriendo datos de los sensores."
+	messageRunFile[ENGLISH] = "The run can't begin: %v"
+	messageRunFile[SPANISH] = "La ejecución no puede comenzar: %v"
 	messageStopIC[ENGLISH] = "Warning! You must configure the platform and run the experiment before stop it."
 	messageStopIC[SPANISH] = "Atención! Debe configurar y ejecutar el experimento antes de poder pararlo."
 	messageStopR[ENGLISH] = "Experiment stopped. Now you can donwload the data to your permanent storage"
 	messageStopR[SPANISH] = "Experimento parado. Ahora puede descargar los datos a su almacenamiento permanente"
 	messageStopS[ENGLISH] = "The experiment is ALREADY stooped!"
 	messageStopS[SPANISH] = "El experimento YA está parado!"
+	messageStopStarting[ENGLISH] = "The experiment is starting, it can be stopped once it runs."
+	messageStopStarting[SPANISH] = "El experimento está empezando, se podrá parar cuando esté en marcha."
+	messageStopStopping[ENGLISH] = "The experiment is stopping, its data are being written."
+	messageStopStopping[SPANISH] = "El experimento se está parando, se están escribiendo sus datos."
 	messageCollectICS0[ENGLISH] = "Sorry! There is not any file with data stored in the system."
 	messageCollectICS0[SPANISH] = "Disculpe, pero no hay ningún archivo con datos almacenado en el sistema."
 	messageCollectICS[ENGLISH] = "You can download the data stored in the system."
 	messageCollectICS[SPANISH] = "Puede descargar los datos almacenados en el sistema."
+	messageCollectQuery0[ENGLISH] = "There is not any run matching \"%s\"."
+	messageCollectQuery0[SPANISH] = "No hay ninguna ejecución que coincida con \"%s\"."
+	messageNotes[ENGLISH] = "The notes of the run have been saved."
+	messageNotes[SPANISH] = "Las notas de la ejecución se han guardado."
+	messagePlotR[ENGLISH] = "The data of the sensors as they are acquired."
+	messagePlotR[SPANISH] = "Los datos de los sensores según se adquieren."
+	messagePlotICS[ENGLISH] = "The experiment is not running, the plots will begin with the next run."
+	messagePlotICS[SPANISH] = "El experimento no está en ejecución, las gráficas comenzarán con la próxima ejecución."
+	messageView[ENGLISH] = "Select a range of time in the plots, or enter it, to export only that part of the run."
+	messageView[SPANISH] = "Seleccione un intervalo de tiempo en las gráficas, o introdúzcalo, para exportar solo esa parte de la ejecución."
+	messageView0[ENGLISH] = "The run has not any record."
+	messageView0[SPANISH] = "La ejecución no tiene ningún registro."
+	messageManage[ENGLISH] = "The runs archived, and the ones deleted, in the trash until it is emptied."
+	messageManage[SPANISH] = "Las ejecuciones archivadas, y las borradas, en la papelera hasta que se vacíe."
+	messageManageConfirm[ENGLISH] = "Please confirm the action."
+	messageManageConfirm[SPANISH] = "Por favor, confirme la acción."
+	messageManageDone[ENGLISH] = "Done."
+	messageManageDone[SPANISH] = "Hecho."
+	messageManageError[ENGLISH] = "The action can't be done: %v"
+	messageManageError[SPANISH] = "No se puede realizar la acción: %v"
+	messageManageAction[ENGLISH] = "%q is not an action on this run"
+	messageManageAction[SPANISH] = "%q no es una acción sobre esta ejecución"
+	messageManageR[ENGLISH] = "The data can't be managed while the experiment is running. You must stop it before."
+	messageManageR[SPANISH] = "No se pueden gestionar los datos mientras el experimento está en ejecución. Debe pararlo antes."
 	messageCollectR[ENGLISH] = "You can't download data while the experiment is running. You must stop it before."
 	messageCollectR[SPANISH] = "No se pueden recoger datos mientas el experimento está en ejecución. Debe pararlo antes."
 
@@ -422,227 +617,412 @@ func (cntxt *Context) initiate() {
 	messagePoweroffICSPostNo[SPANISH] = "El apagado del sistema ha sido cancelado. La configuración actual sige activa."
 	messagePoweroffR[ENGLISH] = "The experiment is running! It MUST be stopped before switch the system off."
 	messagePoweroffR[SPANISH] = "El experimento está en ejecución! Debe ser parado antes de apagar el sistema."
+	messageState[ENGLISH] = "The platform can't go from %s to %s now. Check the state of the experiment and try again."
+	messageState[SPANISH] = "La plataforma no puede pasar ahora de %s a %s. Compruebe el estado del experimento e inténtelo de nuevo."
 
 	//acq.setOutputFileName(dataPath+dataFileName+dataFileExtension)
-	//acq.createOutputFile()
-	cntxt.connectArduinoSerialBT()
+	//filters of the trackers
+	for i := 0; i < nTrackers; i++ {
+		cntxt.TrackerDebounce[i] = DefaultTrackerDebounce
+		cntxt.TrackerMinInterval[i] = DefaultTrackerMinInterval
+	}
+	cntxt.Photogates = defaultPhotogates
+
+	cntxt.connectArduino()
 	log.Printf("Arduino connected!")
+	var err error
+	if theCatalog, err = catalog.Open(filepath.Join(StaticRoot, DataFilePath, CatalogFile)); err != nil {
+		log.Println("catalog:", err)
+	}
 	//cntxt.setStateNEW()
-	cntxt.State = INIT
+	cntxt.State = state.NewMachine(state.Experiment, INIT)
+	cntxt.State.OnTransition(func(t state.Transition) {
+		log.Printf("State %s", t)
+	})
 }
 
 //OOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOO
 // Oshiwasp section: Raspberry sensors
 //OOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOOO
 
-func (oshi *Oshiwasp) initiate() {
+func (oshi *Oshiwasp) initiate(board gpio.Board) {
 
 	var e error
+	oshi.board = board
 	// Set up 'trakers' as inputs
-	oshi.trackerA, e = hwio.GetPinWithMode(TrackerAPin, hwio.INPUT)
+	oshi.trackerA, e = board.Input(TrackerAPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerA\n", TrackerAPin)
 
-	oshi.trackerB, e = hwio.GetPinWithMode(TrackerBPin, hwio.INPUT)
+	oshi.trackerB, e = board.Input(TrackerBPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerB\n", TrackerBPin)
 
-	oshi.trackerC, e = hwio.GetPinWithMode(TrackerCPin, hwio.INPUT)
+	oshi.trackerC, e = board.Input(TrackerCPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerC\n", TrackerCPin)
 
-	oshi.trackerD, e = hwio.GetPinWithMode(TrackerDPin, hwio.INPUT)
+	oshi.trackerD, e = board.Input(TrackerDPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as trackerD\n", TrackerDPin)
 
 	// Set up 'buttons' as inputs
-	oshi.buttonA, e = hwio.GetPinWithMode(ButtonAPin, hwio.INPUT)
+	oshi.buttonA, e = board.Input(ButtonAPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as buttonA\n", ButtonAPin)
 
-	oshi.buttonB, e = hwio.GetPinWithMode(ButtonBPin, hwio.INPUT)
+	oshi.buttonB, e = board.Input(ButtonBPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as buttonB\n", ButtonBPin)
 
 	// Set up 'leds' as outputs
-	oshi.statusLed, e = hwio.GetPinWithMode(StatusLedPin, hwio.OUTPUT)
+	oshi.statusLed, e = board.Output(StatusLedPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as statusLed\n", StatusLedPin)
 
-	oshi.actionLed, e = hwio.GetPinWithMode(ActionLedPin, hwio.OUTPUT)
+	oshi.actionLed, e = board.Output(ActionLedPin)
 	if e != nil {
 		panic(e)
 	}
 	log.Printf("Set pin %s as actionLed\n", ActionLedPin)
 }
 
-func readTracker(name string, TrackerPin hwio.Pin) {
-
-	//value readed from tracker, initially set to 0, because the tracker was innactive
-	oldValue := 0
-	// time of the action detected
-	timeAction := time.Now()
+func simulatedBoard(cart *sim.Cart) gpio.Board {
 
-	// loop
-	for theContext.State == RUNNING {
-		// Read the tracker value
-		value, e := hwio.DigitalRead(TrackerPin)
-		if e != nil {
-			panic(e)
-		}
-		//timeActionOld=timeAction //store the last time
-		timeAction = time.Now() // time at this point
-		// Did value change?
-		if (value == 1) && (value != oldValue) {
-			dataString := fmt.Sprintf("[%s]; %d\n",
-				name, int64(timeAction.Sub(theContext.getTime0())/time.Microsecond))
-			log.Println(dataString)
-			theContext.DataFile.WriteString(dataString)
-
-			// Write the value to the led indicating somewhat is happened
-			if value == 1 {
-				hwio.DigitalWrite(theOshi.actionLed, hwio.HIGH)
-			} else {
-				hwio.DigitalWrite(theOshi.actionLed, hwio.LOW)
-			}
-		}
-		oldValue = value
+	// the trackers see the flag of the cart passing
+	board := gpio.NewFake()
+	for gate, pinName := range []string{TrackerAPin, TrackerBPin, TrackerCPin, TrackerDPin} {
+		gate := gate
+		board.Drive(pinName, func(t time.Time) int {
+			return cart.GateLevel(gate, t)
+		})
 	}
+	// the buttons are never pushed and nobody is looking at the leds
+	log.Printf("Simulated trackers, buttons and leds")
+	return board
 }
 
-func (cntxt *Context) readFromArduino() {
-
-	var register, reg []byte
-	// operate with the gobal variables theSensorData and theSensorDataInBytes; more speed?
-
-	// don't use the first readding ??  I'm not sure about that
-	reader := bufio.NewReader(cntxt.SerialPort)
-	// find the begging of an stream of data from the sensors
-	register, err := reader.ReadBytes('\x24')
-	if err != nil {
-		log.Println(err)
+//trackerReader the reader of the edges of the tracker i
+func (oshi *Oshiwasp) trackerReader(i int, pinName string, pin gpio.Pin) (acquisition.Reader, error) {
+	name := trackerNames[i]
+	watcher, e := gpio.Watch(oshi.board, pinName, pin, trackerEdges)
+	if e != nil {
+		return nil, e
 	}
-	//log.Println(register)
-	//log.Printf(">>>>>>>>>>>>>>")
+	if watcher.Polled() {
+		log.Printf("Polling tracker %s, no edge events for pin %s", name, pinName)
+	}
+	filter := gpio.NewFilter(milliseconds(theContext.TrackerDebounce[i]),
+		milliseconds(theContext.TrackerMinInterval[i]))
+	oshi.filters[i] = filter
+	return func(ctx context.Context, put func(record.Record)) error {
+		return readTracker(ctx, put, name, watcher, filter)
+	}, nil
+}
 
-	// loop
-	for cntxt.State == RUNNING {
-		// Read the serial and decode
+//startTracker starts the reader of the tracker i in the run
+func (cntxt *Context) startTracker(i int, pinName string, pin gpio.Pin) {
+	reader, e := theOshi.trackerReader(i, pinName, pin)
+	if e != nil {
+		log.Printf("Can't watch tracker %s: %s", trackerNames[i], e)
+		return
+	}
+	cntxt.supervisor.Go("Tracker "+trackerNames[i], reader)
+	log.Printf("Started Tracker %s", trackerNames[i])
+}
 
-		register = nil
-		reg = nil
+//trackerSuppressed edges dropped by the filters of the trackers
+func (oshi *Oshiwasp) trackerSuppressed() (suppressed [nTrackers]uint64) {
+	for i, filter := range oshi.filters {
+		if filter != nil {
+			suppressed[i] = filter.Suppressed()
+		}
+	}
+	return suppressed
+}
 
-		//n, err = s.Read(register)
-		for len(register) < 38 { // in case of \x24 chars repeted the length will be less than the expected 38 bytes
-			reg, err = reader.ReadBytes('\x24')
-			if err != nil {
-				log.Fatal(err)
-			}
-			register = append(register, reg...)
+func (cntxt *Context) writeFooter() {
+	// store what is known at the end of the run: the quality of the link,
+	// the edges dropped by the filters and what was lost
+	cntxt.LinkStats = cntxt.decoder.Stats()
+	log.Println("Link:", cntxt.LinkStats)
+	cntxt.TrackerSuppressed = theOshi.trackerSuppressed()
+	cntxt.publishStatus()
+	footer := datafile.Footer{
+		Stop:       time.Now(),
+		Dropped:    cntxt.Acquisition.Pipeline.Dropped,
+		Link:       linkQuality(cntxt.LinkStats),
+		Suppressed: make(map[string]uint64),
+	}
+	for i, filter := range theOshi.filters {
+		if filter != nil {
+			log.Printf("Tracker filter: [%s] %s", trackerNames[i], filter)
+			footer.Suppressed[trackerNames[i]] = filter.Suppressed()
 		}
+	}
+	for _, e := range cntxt.Acquisition.Errors {
+		footer.Errors = append(footer.Errors, e.Error())
+	}
+	if cntxt.dataWriter == nil {
+		return
+	}
+	if err := cntxt.dataWriter.Close(footer); err != nil {
+		log.Println(err.Error())
+	}
+}
 
-		receptionTime := time.Now() // time of the action detected
+//sensors the configured sensors, named as in the data file and the API
+func (cntxt *Context) sensors() map[string]bool {
+	return map[string]bool{
+		"trackerA":      cntxt.SetTrackerA,
+		"trackerB":      cntxt.SetTrackerB,
+		"trackerC":      cntxt.SetTrackerC,
+		"trackerD":      cntxt.SetTrackerD,
+		"trackerM":      cntxt.SetTrackerM,
+		"distance":      cntxt.SetDistance,
+		"accelerometer": cntxt.SetAccelerometer,
+		"gyroscope":     cntxt.SetGyroscope,
+	}
+}
 
-		if register[0] == '\x23' { // if first byte is '#', lets decode the stream of bytes in register
+//linkQuality the quality of the link in the data file and the API
+func linkQuality(stats frame.Stats) *datafile.LinkQuality {
+	return &datafile.LinkQuality{
+		Good:            stats.Good,
+		BadChecksum:     stats.BadChecksum,
+		BadFrames:       stats.BadFrames,
+		Resyncs:         stats.Resyncs,
+		DroppedBytes:    stats.DroppedBytes,
+		FramesPerSecond: stats.FramesPerSecond(),
+	}
+}
 
-			//decode the register
+//newDataHeader the description of the data of the run, at the beginning of
+//its segment of the data file
+func (cntxt *Context) newDataHeader() *datafile.Header {
+	header := datafile.NewHeader(cntxt.ConfigurationName, cntxt.Time0)
+	header.Run = cntxt.Run.Number
+	header.Sensors = cntxt.sensors()
+
+	header.Settings["trackerEdges"] = trackerEdges.String()
+	for i, name := range trackerNames {
+		header.Settings["debounce"+name] = strconv.FormatFloat(cntxt.TrackerDebounce[i], 'g', -1, 64) + "ms"
+		header.Settings["minInterval"+name] = strconv.FormatFloat(cntxt.TrackerMinInterval[i], 'g', -1, 64) + "ms"
+	}
+	cntxt.Photogates.Write(header.Settings)
+	header.Settings["recordBuffer"] = strconv.Itoa(recordBuffer)
+	header.Settings["recordPolicy"] = recordPolicy.String()
+
+	header.Transport = cntxt.Transport.String()
+	framing := cntxt.framing()
+	switch {
+	case theCart != nil:
+		header.Transport = "simulated"
+		header.Firmware = datafile.Firmware{Device: "simulated", Escaped: framing.Escaped, Checksum: framing.Checksum}
+	case cntxt.Transport.Kind == transport.ESP32:
+		header.Firmware = datafile.Firmware{Device: "esp32"}
+	default:
+		header.Firmware = datafile.Firmware{Device: "arduino", Escaped: framing.Escaped, Checksum: framing.Checksum}
+	}
 
-			theSensorDataInBytes.trackerMicroSecondsInBytes = register[1:5]
-			buf := bytes.NewReader(theSensorDataInBytes.trackerMicroSecondsInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.trackerMicroSeconds)
+	header.AddSource("Ard", cntxt.arduinoSchema)
+	sets := [nTrackers]bool{cntxt.SetTrackerA, cntxt.SetTrackerB, cntxt.SetTrackerC, cntxt.SetTrackerD}
+	for i, name := range trackerNames {
+		if sets[i] {
+			header.AddSource(name, cntxt.trackerSchema)
+		}
+	}
+	return header
+}
 
-			theSensorDataInBytes.sensorMicroSecondsInBytes = register[5:9]
-			buf = bytes.NewReader(theSensorDataInBytes.sensorMicroSecondsInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.sensorMicroSeconds)
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
 
-			theSensorDataInBytes.distanceInBytes = register[9:13]
-			buf = bytes.NewReader(theSensorDataInBytes.distanceInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.distance)
+func readTracker(ctx context.Context, put func(record.Record), name string, watcher gpio.Watcher, filter *gpio.Filter) error {
+	// closing the watcher unblocks Wait when the run stops
+	defer watcher.Close()
+	defer acquisition.OnCancel(ctx, func() { watcher.Close() })()
+	for {
+		// wait for the next edge of the tracker
+		event, e := watcher.Wait()
+		if e == gpio.ErrClosed {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		// bounces and re-triggers are counted, not written
+		if !filter.Accept(event) {
+			if verbose {
+				log.Printf("Tracker %s: suppressed edge to %d", name, event.Value)
+			}
+			continue
+		}
+		// the time of the edge, not the time it is read
+		rec := record.Record{Source: name, Schema: theContext.trackerSchema, Time: event.Time}
+		if trackerEdges != gpio.Rising {
+			// the level tells the rising edges from the falling ones
+			rec.Values = []float64{float64(event.Value)}
+		}
+		if verbose {
+			log.Printf("[%s] %v", name, event.Time.Sub(theContext.getTime0()))
+		}
+		put(rec)
 
-			theSensorDataInBytes.accXInBytes = register[13:17]
-			buf = bytes.NewReader(theSensorDataInBytes.accXInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.accX)
+		// Write the value to the led indicating somewhat is happened
+		theOshi.actionLed.Write(event.Value)
+	}
+}
 
-			theSensorDataInBytes.accYInBytes = register[17:21]
-			buf = bytes.NewReader(theSensorDataInBytes.accYInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.accY)
+//newArduinoSchema the values of the records of the arduino, as configured
+func (cntxt *Context) newArduinoSchema() *record.Schema {
+	schema := &record.Schema{}
+	schema.Add(record.Field{Name: "sensorTime", Unit: "us", Kind: record.Int})
+	if cntxt.SetTrackerM == ON {
+		schema.Add(record.Field{Name: "trackerTime", Unit: "us", Kind: record.Int},
+			record.Field{Name: "sync", Kind: record.Int})
+	}
+	if cntxt.SetDistance == ON {
+		schema.Add(record.Field{Name: "distance", Unit: "mm", Kind: record.Int})
+	}
+	if cntxt.SetAccelerometer == ON {
+		schema.Add(record.Field{Name: "accX", Unit: "g", Kind: record.Float},
+			record.Field{Name: "accY", Unit: "g", Kind: record.Float},
+			record.Field{Name: "accZ", Unit: "g", Kind: record.Float})
+	}
+	if cntxt.SetGyroscope == ON {
+		schema.Add(record.Field{Name: "gyrX", Unit: "gr/s", Kind: record.Float},
+			record.Field{Name: "gyrY", Unit: "gr/s", Kind: record.Float},
+			record.Field{Name: "gyrZ", Unit: "gr/s", Kind: record.Float})
+	}
+	if cntxt.Transport.Kind == transport.ESP32 {
+		schema.Add(record.Field{Name: "temperature", Unit: "C", Kind: record.Float})
+		for i := 0; i < frame.ESP32AnalogChannels; i++ {
+			schema.Add(record.Field{Name: fmt.Sprintf("analog%d", i), Unit: "mV", Kind: record.Int})
+		}
+	}
+	return schema
+}
 
-			theSensorDataInBytes.accZInBytes = register[21:25]
-			buf = bytes.NewReader(theSensorDataInBytes.accZInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.accZ)
+//newTrackerSchema the values of the records of the trackers: the level
+//after the edge, if not only the rising ones are recorded
+func newTrackerSchema() *record.Schema {
+	schema := &record.Schema{}
+	if trackerEdges != gpio.Rising {
+		schema.Add(record.Field{Name: "level", Kind: record.Int})
+	}
+	return schema
+}
 
-			theSensorDataInBytes.gyrXInBytes = register[25:29]
-			buf = bytes.NewReader(theSensorDataInBytes.gyrXInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.gyrX)
+func (cntxt *Context) newArduinoDecoder() {
+	if cntxt.Transport.Kind == transport.ESP32 {
+		// the ESP32 sends text lines
+		cntxt.decoder = frame.NewTextDecoder(cntxt.Arduino)
+	} else {
+		// the decoder finds the beginning of the frames by itself
+		decoder := frame.NewDecoder(cntxt.Arduino)
+		framing := cntxt.framing()
+		decoder.Escaped, decoder.Checksum = framing.Escaped, framing.Checksum
+		cntxt.decoder = decoder
+	}
+	cntxt.LinkStats = frame.Stats{}
+}
 
-			theSensorDataInBytes.gyrYInBytes = register[29:33]
-			buf = bytes.NewReader(theSensorDataInBytes.gyrYInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.gyrY)
+func (cntxt *Context) readFromArduino(ctx context.Context, put func(record.Record)) error {
+	// the Arduino may have stopped sending, interrupt the read
+	defer acquisition.OnCancel(ctx, cntxt.Arduino.Interrupt)()
 
-			theSensorDataInBytes.gyrZInBytes = register[33:37]
-			buf = bytes.NewReader(theSensorDataInBytes.gyrZInBytes)
-			err = binary.Read(buf, binary.LittleEndian, &theSensorData.gyrZ)
+	// loop
+	for {
+		// Read the serial and decode
+		sensorData, err := cntxt.decoder.Decode()
+		if ctx.Err() != nil {
+			// the run is stopped, the frame being read is lost
+			return nil
+		}
+		if err != nil {
+			if _, badFrame := err.(*frame.Error); badFrame {
+				// discard the frame, the decoder resynchronises by itself
+				log.Println(err)
+				continue
+			}
+			return fmt.Errorf("error reading from Arduino: %v", err)
+		}
 
-		} // if
+		receptionTime := time.Now() // time of the action detected
 
-		//compound the dataline and write to the output
+		//compound the record, with the values of the configured sensors
 		//receptionTime= time.Now() // Alternative: time at this point
-		dataString := fmt.Sprintf("[%s]; %d; %d", "Ard",
-			int64(receptionTime.Sub(cntxt.Time0)/time.Microsecond), theSensorData.sensorMicroSeconds)
+		values := []float64{float64(sensorData.SensorMicroSeconds)}
 		if cntxt.SetTrackerM == ON {
-			dataString += fmt.Sprintf("; %d", theSensorData.trackerMicroSeconds)
+			// sync is 1 in the first record after the tracker M fired ('@' frame)
+			sync := 0.0
+			if sensorData.Sync {
+				sync = 1
+			}
+			values = append(values, float64(sensorData.TrackerMicroSeconds), sync)
 		}
 		if cntxt.SetDistance == ON {
-			dataString += fmt.Sprintf("; %d", theSensorData.distance)
+			values = append(values, float64(sensorData.Distance))
 		}
 		if cntxt.SetAccelerometer == ON {
-			dataString += fmt.Sprintf("; %f; %f; %f",
-				theSensorData.accX, theSensorData.accY, theSensorData.accZ)
+			values = append(values, float64(sensorData.AccX), float64(sensorData.AccY), float64(sensorData.AccZ))
 		}
 		if cntxt.SetGyroscope == ON {
-			dataString += fmt.Sprintf("; %f; %f; %f",
-				theSensorData.gyrX, theSensorData.gyrY, theSensorData.gyrZ)
+			values = append(values, float64(sensorData.GyrX), float64(sensorData.GyrY), float64(sensorData.GyrZ))
+		}
+		if cntxt.Transport.Kind == transport.ESP32 {
+			values = append(values, float64(sensorData.Temperature))
+			for i := 0; i < frame.ESP32AnalogChannels; i++ {
+				mV := 0
+				if i < len(sensorData.Analog) {
+					mV = sensorData.Analog[i]
+				}
+				values = append(values, float64(mV))
+			}
 		}
-		dataString += "\n" //end of line
 
-		log.Println(dataString)
-		cntxt.DataFile.WriteString(dataString)
+		if verbose {
+			log.Println("[Ard]", values)
+		}
+		put(record.Record{Source: "Ard", Schema: cntxt.arduinoSchema, Time: receptionTime, Values: values})
 		// Write the value to the led indicating somewhat is happened
-		hwio.DigitalWrite(theOshi.actionLed, hwio.HIGH)
-		hwio.DigitalWrite(theOshi.actionLed, hwio.LOW)
+		theOshi.actionLed.Write(gpio.HIGH)
+		theOshi.actionLed.Write(gpio.LOW)
 	}
 }
 
-func blinkingLed(ledPin hwio.Pin) int {
+func blinkingLed(ledPin gpio.Pin) int {
 	// loop
 	for {
-		hwio.DigitalWrite(ledPin, hwio.HIGH)
-		hwio.Delay(500)
-		hwio.DigitalWrite(ledPin, hwio.LOW)
-		hwio.Delay(500)
+		ledPin.Write(gpio.HIGH)
+		time.Sleep(500 * time.Millisecond)
+		ledPin.Write(gpio.LOW)
+		time.Sleep(500 * time.Millisecond)
 	}
 }
 
-func waitTillButtonPushed(buttonPin hwio.Pin) int {
+func waitTillButtonPushed(buttonPin gpio.Pin) int {
 
 	// loop
 	for {
 		// Read the tracker value
-		value, e := hwio.DigitalRead(buttonPin)
+		value, e := buttonPin.Read()
 		if e != nil {
 			panic(e)
 		}
@@ -657,27 +1037,6 @@ func waitTillButtonPushed(buttonPin hwio.Pin) int {
 // Web section
 //////////////
 
-//RemoveContents erase the contents of a directory
-//intended to remove data files en data directory
-func RemoveContents(dir string) error {
-	d, err := os.Open(dir)
-	if err != nil {
-		return err
-	}
-	defer d.Close()
-	names, err := d.Readdirnames(-1)
-	if err != nil {
-		return err
-	}
-	for _, name := range names {
-		err = os.RemoveAll(filepath.Join(dir, name))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 //Home of the website
 func Home(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
@@ -703,7 +1062,7 @@ func Init(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		// correct states
 		if req.Method == "GET" {
@@ -717,16 +1076,17 @@ func Init(w http.ResponseWriter, req *http.Request) {
 			log.Println(req.Form)
 			if req.Form.Get("initializate") == "YES" {
 				//if YES, init the platform
-				theContext.State = INIT
+				if err := theContext.State.To(INIT); err != nil {
+					stateError(w, err)
+					return
+				}
 				theContext.ConfigurationName = ""
+				theContext.publishStatus()
 				//set the initial state
 				//theContext.initiate()
 				//theOshi.initiate()
-				//erase datafiles
-				dataDirectory := filepath.Join(StaticRoot, DataFilePath)
-				log.Println("DELETING ", dataDirectory)
-				err := RemoveContents(dataDirectory)
-				if err != nil {
+				//move the runs to the trash, where they can be restored from
+				if err := trashAll(); err != nil {
 					log.Println(err)
 				}
 
@@ -742,7 +1102,7 @@ func Init(w http.ResponseWriter, req *http.Request) {
 			theContext.Title = titleExperiment[theContext.Lang]
 			render(w, "experiment", theContext)
 		}
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// wrong state
 		theContext.Message = messageInitR[theContext.Lang]
 		theContext.AlertLevel = DANGER
@@ -752,19 +1112,48 @@ func Init(w http.ResponseWriter, req *http.Request) {
 
 }
 
+//trashAll moves all the runs of the experiments to the trash
+func trashAll() error {
+	experiments, err := theStore.Experiments()
+	if err != nil {
+		return err
+	}
+	for _, e := range experiments {
+		for _, run := range e.Runs {
+			if err := moveRun(run, experiment.Active, experiment.Trash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//stateError shows the experiment page when the transition of a request is
+//refused, as when two requests race for the platform
+func stateError(w http.ResponseWriter, err error) {
+	log.Println(err)
+	theContext.Message = err.Error()
+	if e, ok := err.(*state.Error); ok {
+		theContext.Message = fmt.Sprintf(messageState[theContext.Lang], e.From, e.To)
+	}
+	theContext.AlertLevel = DANGER
+	theContext.Title = titleExperiment[theContext.Lang]
+	render(w, "experiment", theContext)
+}
+
 //Experiment allows to access to the experiments
 func Experiment(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		//correct cases, shows the experiment page to config,test and run it
 		theContext.Message = messageExperimentICS[theContext.Lang]
 		theContext.AlertLevel = INFO
 		theContext.Title = titleExperiment[theContext.Lang]
 		render(w, "experiment", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		//wrong case, it must be STOPPED before
 		theContext.Message = messageExperimentR[theContext.Lang]
 		theContext.AlertLevel = DANGER
@@ -778,10 +1167,12 @@ func Config(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		//correct states, do the config process
 		if req.Method == "GET" {
+			theContext.NameInput = theContext.ConfigurationName
+			theContext.NameError = false
 			theContext.Message = messageConfigICSGet[theContext.Lang]
 			theContext.AlertLevel = INFO
 			theContext.Title = titleConfig[theContext.Lang]
@@ -789,66 +1180,48 @@ func Config(w http.ResponseWriter, req *http.Request) {
 		} else { // POST
 			log.Println("POST")
 			req.ParseForm()
-			// logic part of login
-			//validation phase will be here
-			//if valid, put the form data into the context struct
-			theContext.ConfigurationName = req.Form.Get("ConfigurationName")
-			if req.Form.Get("SetTrackerA") == SensorStateOn {
-				theContext.SetTrackerA = ON
-			} else {
-				theContext.SetTrackerA = OFF
-			}
-			if req.Form.Get("SetTrackerB") == SensorStateOn {
-				theContext.SetTrackerB = ON
-			} else {
-				theContext.SetTrackerB = OFF
-			}
-			if req.Form.Get("SetTrackerC") == SensorStateOn {
-				theContext.SetTrackerC = ON
-			} else {
-				theContext.SetTrackerC = OFF
-			}
-			if req.Form.Get("SetTrackerD") == SensorStateOn {
-				theContext.SetTrackerD = ON
-			} else {
-				theContext.SetTrackerD = OFF
-			}
-			if req.Form.Get("SetTrackerM") == SensorStateOn {
-				theContext.SetTrackerM = ON
-			} else {
-				theContext.SetTrackerM = OFF
-			}
-			if req.Form.Get("SetDistance") == SensorStateOn {
-				theContext.SetDistance = ON
-			} else {
-				theContext.SetDistance = OFF
-			}
-			if req.Form.Get("SetAccelerometer") == SensorStateOn {
-				theContext.SetAccelerometer = ON
-			} else {
-				theContext.SetAccelerometer = OFF
+			theContext.NameInput = req.Form.Get("ConfigurationName")
+			name, err := theContext.configure(req.Form)
+			_, theContext.NameError = err.(*experiment.NameError)
+			switch {
+			case theContext.NameError:
+				log.Println(err)
+				theContext.Message = nameMessage(err)
+			case err == errFilter:
+				theContext.Message = messageConfigFilter[theContext.Lang]
+			case err == errPhotogates:
+				theContext.Message = messageConfigPhotogates[theContext.Lang]
+			case err != nil:
+				stateError(w, err)
+				return
 			}
-			if req.Form.Get("SetGyroscope") == SensorStateOn {
-				theContext.SetGyroscope = ON
-			} else {
-				theContext.SetGyroscope = OFF
+			if err != nil {
+				theContext.AlertLevel = DANGER
+				theContext.Title = titleConfig[theContext.Lang]
+				render(w, "config", theContext)
+				return
 			}
-			//prepare the context
-			theContext.Message = messageConfigICSPost[theContext.Lang]
-			theContext.Title = titleExperiment[theContext.Lang]
-			theContext.AlertLevel = SUCCESS
-			theContext.State = CONFIGURED
 			//setArduinoStateON() //initiate Arduino readding sensors and transfer via BT
 
 			//log
 			log.Println(req.Form)
 			log.Println("Contex:", theContext)
+			theContext.Title = titleExperiment[theContext.Lang]
+			if clean := experiment.CleanName(theContext.NameInput); name != clean {
+				//tell the new name, instead of going to the experiment page
+				theContext.Message = fmt.Sprintf(messageConfigUnique[theContext.Lang], clean, name)
+				theContext.AlertLevel = WARNING
+				render(w, "experiment", theContext)
+				return
+			}
+			theContext.Message = messageConfigICSPost[theContext.Lang]
+			theContext.AlertLevel = SUCCESS
 			//once processed the form, reditect to the index page
 
 			//render(w, "experiment", theContext)
 			http.Redirect(w, req, "/experiment/", http.StatusFound)
 		}
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// only put a message, but don't touch the running process
 		theContext.Message = messageConfigR[theContext.Lang]
 		theContext.AlertLevel = DANGER
@@ -857,19 +1230,143 @@ func Config(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+//configurationName the name of the configuration entered in the form,
+//cleaned and validated. If other experiment has already that name the time is
+//added to it; the current configuration keeps its name, to add runs to it
+func configurationName(input string) (string, error) {
+	name := experiment.CleanName(input)
+	if err := experiment.ValidateName(name); err != nil {
+		return "", err
+	}
+	if name == theContext.ConfigurationName {
+		return name, nil
+	}
+	return theStore.UniqueName(name, time.Now())
+}
+
+//nameMessage the localized message of a wrong name of an experiment
+func nameMessage(err error) string {
+	nameErr, ok := err.(*experiment.NameError)
+	if !ok {
+		return fmt.Sprintf(messageManageError[theContext.Lang], err)
+	}
+	switch nameErr.Reason {
+	case experiment.Empty:
+		return messageNameEmpty[theContext.Lang]
+	case experiment.TooLong:
+		return fmt.Sprintf(messageNameLong[theContext.Lang], nameErr.Name, experiment.MaxNameLength)
+	case experiment.BadStart:
+		return fmt.Sprintf(messageNameStart[theContext.Lang], nameErr.Name)
+	default:
+		return fmt.Sprintf(messageNameChar[theContext.Lang], nameErr.Name)
+	}
+}
+
+//errFilter a debounce or a minimum interval of the trackers is wrong
+var errFilter = errors.New("the debounce and the minimum interval of the trackers must be milliseconds, zero or greater")
+
+//configure sets the configuration of the form: its name, the sensors and the
+//filters of the trackers, and goes to CONFIGURED. Nothing changes if the name
+//or a filter are wrong, or the platform can't be configured now. The name of
+//the configuration is returned, it is unique as configurationName tells
+func (cntxt *Context) configure(form url.Values) (string, error) {
+	//validation phase: the name will be a directory of the data
+	name, err := configurationName(form.Get("ConfigurationName"))
+	if err != nil {
+		return "", err
+	}
+	debounce, minInterval, ok := trackerFilters(form)
+	if !ok {
+		return "", errFilter
+	}
+	photogates, ok := photogates(form, cntxt.Photogates)
+	if !ok {
+		return "", errPhotogates
+	}
+	if err := cntxt.State.To(CONFIGURED); err != nil {
+		return "", err
+	}
+	//if valid, put the form data into the context struct
+	cntxt.ConfigurationName = name
+	cntxt.SetTrackerA = form.Get("SetTrackerA") == SensorStateOn
+	cntxt.SetTrackerB = form.Get("SetTrackerB") == SensorStateOn
+	cntxt.SetTrackerC = form.Get("SetTrackerC") == SensorStateOn
+	cntxt.SetTrackerD = form.Get("SetTrackerD") == SensorStateOn
+	cntxt.SetTrackerM = form.Get("SetTrackerM") == SensorStateOn
+	cntxt.SetDistance = form.Get("SetDistance") == SensorStateOn
+	cntxt.SetAccelerometer = form.Get("SetAccelerometer") == SensorStateOn
+	cntxt.SetGyroscope = form.Get("SetGyroscope") == SensorStateOn
+	cntxt.TrackerDebounce = debounce
+	cntxt.TrackerMinInterval = minInterval
+	cntxt.Photogates = photogates
+	cntxt.publishStatus()
+	return name, nil
+}
+
+//trackerFilters reads the debounce and the minimum interval of the trackers
+//from the form, DebounceA, MinIntervalA...; false if any is wrong
+func trackerFilters(form url.Values) (debounce, minInterval [nTrackers]float64, ok bool) {
+	for i, name := range trackerNames {
+		if debounce[i], ok = parseNumber(form.Get("Debounce"+name), DefaultTrackerDebounce); !ok {
+			return
+		}
+		if minInterval[i], ok = parseNumber(form.Get("MinInterval"+name), DefaultTrackerMinInterval); !ok {
+			return
+		}
+	}
+	return debounce, minInterval, true
+}
+
+//errPhotogates a spacing of the gates, the length of the flag or an
+//uncertainty is wrong
+var errPhotogates = errors.New("the spacings of the gates and the length of the flag must be meters greater than zero, and their uncertainties zero or greater")
+
+//photogates reads the setup of the photogates from the form, the spacings
+//GateSpacingAB, GateSpacingBC and GateSpacingCD, the FlagLength and the
+//LengthError in m, and the TimeError in s; the ones of current where they
+//are empty, false if any is wrong
+func photogates(form url.Values, current kinematics.Setup) (kinematics.Setup, bool) {
+	setup := current
+	fields := map[string]*float64{"FlagLength": &setup.FlagLength,
+		"LengthError": &setup.LengthError, "TimeError": &setup.TimeError}
+	for i := range setup.Spacings {
+		fields["GateSpacing"+kinematics.Gates[i:i+2]] = &setup.Spacings[i]
+	}
+	for field, v := range fields {
+		var ok bool
+		if *v, ok = parseNumber(form.Get(field), *v); !ok {
+			return setup, false
+		}
+	}
+	return setup, setup.Valid()
+}
+
+//parseNumber parses a field of the form, a number zero or greater; def if
+//it is empty
+func parseNumber(field string, def float64) (float64, bool) {
+	if field == "" {
+		return def, true
+	}
+	v, err := strconv.ParseFloat(field, 64)
+	if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
 //Test allows to test the sensors
 func Test(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT:
 		//The system must be configured before
 		theContext.Message = messageTestI[theContext.Lang]
 		theContext.AlertLevel = WARNING
 		theContext.Title = titleConfig[theContext.Lang]
 		render(w, "configure", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		//wrong state, the system must be stopped before
 		theContext.Message = messageTestR[theContext.Lang]
 		theContext.AlertLevel = DANGER
@@ -939,105 +1436,42 @@ func Run(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch current := theContext.State.Current(); current {
 	case INIT:
 		//wrong state, show experiment page
 		theContext.Message = messageRunI[theContext.Lang]
 		theContext.AlertLevel = DANGER
 		theContext.Title = titleExperiment[theContext.Lang]
 		render(w, "experiment", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// we already are in this State
 		// only put a message, but don't touch the running process
 		theContext.Message = messageRunR[theContext.Lang]
 		theContext.AlertLevel = WARNING
+		if req.Method == "POST" {
+			theContext.saveNotes(req)
+		}
 		theContext.Title = titleRun[theContext.Lang]
+		//the decoder and the filters are the ones of the run once it runs
+		if current != STARTING {
+			theContext.LinkStats = theContext.decoder.Stats()
+			theContext.TrackerSuppressed = theOshi.trackerSuppressed()
+		}
 		render(w, "run", theContext)
 	case CONFIGURED, STOPPED:
 		//correct states, do the running process
-
-		dataFileName := filepath.Join(StaticRoot, DataFilePath, theContext.ConfigurationName+DataFileExtension)
-		//detect if file exists
-		_, err := os.Stat(dataFileName)
-		//create datafile is not exists
-		if os.IsNotExist(err) {
-			//create file to write
-			log.Println("Creating ", dataFileName)
-			theContext.DataFile, err = os.Create(dataFileName)
-			if err != nil {
-				log.Println(err.Error())
-			}
-			statusLine := fmt.Sprintf("### %v Data Acquisition: %s \n\n", time.Now(), theContext.ConfigurationName)
-			theContext.DataFile.WriteString(statusLine)
-			//formatLine := fmt.Sprintf("### [Ard], localTime(us), trackerTime(us), sensorTime(us), distance(mm), accX(g), accY(g), accZ(g), gyrX(gr/s), gyrY(gr/s), gyrZ(gr/s) \n\n")
-			formatLine := fmt.Sprintf("### [Ard]; localTime(us); sensorTime(us)")
-			if theContext.SetTrackerM == ON {
-				formatLine += fmt.Sprintf("; trackerTime(us)")
-			}
-			if theContext.SetDistance == ON {
-				formatLine += fmt.Sprintf("; distance(mm)")
-			}
-			if theContext.SetAccelerometer == ON {
-				formatLine += fmt.Sprintf("; accX(g)")
-				formatLine += fmt.Sprintf("; accY(g)")
-				formatLine += fmt.Sprintf("; accZ(g)")
-			}
-			if theContext.SetGyroscope == ON {
-				formatLine += fmt.Sprintf("; gyrX(gr/s)")
-				formatLine += fmt.Sprintf("; gyrY(gr/s)")
-				formatLine += fmt.Sprintf("; gyrZ(gr/s)")
-			}
-			formatLine += fmt.Sprintf("\n\n")
-			theContext.DataFile.WriteString(formatLine)
-			// sets the new time0 only with a new scenery
-			theContext.setTime0()
-		} else {
-			//open fle to append
-			log.Println("Openning ", dataFileName)
-			theContext.DataFile, err = os.OpenFile(dataFileName, os.O_RDWR|os.O_APPEND, 0644)
-			if err != nil {
-				log.Println(err.Error())
+		if err := theContext.startRun(); err != nil {
+			if _, ok := err.(*state.Error); ok {
+				stateError(w, err)
+				return
 			}
+			theContext.Message = fmt.Sprintf(messageRunFile[theContext.Lang], err)
+			theContext.AlertLevel = DANGER
+			theContext.Title = titleExperiment[theContext.Lang]
+			render(w, "experiment", theContext)
+			return
 		}
 
-		// running process instruction here!
-		// running process instruction here!
-
-		//waitTillButtonPushed(buttonA)
-		hwio.DigitalWrite(theOshi.statusLed, hwio.HIGH)
-		log.Println("Beginning.....")
-
-		//activate arduino
-		setArduinoStateON()
-
-		// launch the trackers
-
-		log.Printf("There are %v goroutines", runtime.NumGoroutine())
-		log.Printf("Launching the Gourutines")
-
-		theContext.State = RUNNING
-
-		go theContext.readFromArduino()
-		log.Println("Started Arduino")
-		if theContext.SetTrackerA == ON {
-			go readTracker("A", theOshi.trackerA)
-			log.Println("Started Tracker A")
-		}
-		if theContext.SetTrackerB == ON {
-			go readTracker("B", theOshi.trackerB)
-			log.Println("Started Tracker B")
-		}
-		if theContext.SetTrackerC == ON {
-			go readTracker("C", theOshi.trackerC)
-			log.Println("Started Tracker C")
-		}
-		if theContext.SetTrackerD == ON {
-			go readTracker("D", theOshi.trackerD)
-			log.Println("Started Tracker D")
-		}
-		log.Printf("There are %v goroutines", runtime.NumGoroutine())
-		//defer close the file to STOP
-
 		theContext.Message = messageRunCS[theContext.Lang]
 		theContext.AlertLevel = SUCCESS
 		theContext.Title = titleRun[theContext.Lang]
@@ -1046,78 +1480,228 @@ func Run(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-//Stop allows to stop the experiments
-func Stop(w http.ResponseWriter, req *http.Request) {
-	log.Println(">>>", req.URL)
-	log.Println(">>>", theContext)
+//startRun creates the data file of the next run of the configuration and
+//launches the readers of the sensors while STARTING, and goes to RUNNING
+//once they are all there. The error is a *state.Error if the platform can't
+//run now, or else the one creating the data file or setting the Arduino
+//on, after going back to STOPPED
+func (cntxt *Context) startRun() error {
+	if err := cntxt.State.To(STARTING); err != nil {
+		return err
+	}
+	//let the Arduino be read again; a capture replayed to its end is
+	//replayed again from the beginning
+	if err := cntxt.Arduino.Resume(); err != nil {
+		cntxt.abortRun(err)
+		return err
+	}
+	//values of the records of the configured sensors
+	cntxt.arduinoSchema = cntxt.newArduinoSchema()
+	cntxt.trackerSchema = newTrackerSchema()
 
-	switch theContext.State {
-	case INIT, CONFIGURED:
-		theContext.Message = messageStopIC[theContext.Lang]
-		theContext.AlertLevel = DANGER
-		theContext.Title = titleExperiment[theContext.Lang]
-		render(w, "experiment", theContext)
-	case STOPPED:
-		// we already are in this State
-		// only put a message, but don't touch the process
-		theContext.Message = messageStopS[theContext.Lang]
+	//each run has its own data file, numbered in the experiment, and
+	//its own time0
+	cntxt.setTime0()
+	var err error
+	cntxt.Run, cntxt.DataFile, err = theStore.NewRun(cntxt.ConfigurationName)
+	if err == nil {
+		log.Println("Creating ", theStore.Path(cntxt.Run))
+		cntxt.DataFileName = cntxt.Run.File()
+		cntxt.dataWriter, err = datafile.NewWriter(cntxt.DataFile, cntxt.newDataHeader())
+	}
+	if err != nil {
+		cntxt.abortRun(err)
+		return err
+	}
+	cntxt.Notes = ""
+	entry := newCatalogEntry(cntxt.Run, []datafile.Segment{{Header: cntxt.dataWriter.Header()}})
+	entry.Operator = cntxt.Operator
+	if err := theCatalog.Put(entry); err != nil {
+		log.Println(err.Error())
+	}
+
+	// running process instruction here!
+	// running process instruction here!
+
+	//waitTillButtonPushed(buttonA)
+	log.Println("Beginning.....")
+
+	//activate arduino, forgetting what it sent since the last run
+	if cntxt.Transport.Kind != transport.File {
+		cntxt.Arduino.Discard()
+	}
+	if err := setArduinoStateON(); err != nil {
+		cntxt.abortRun(err)
+		return err
+	}
+
+	// launch the readers of the configured sensors and the writer
+
+	log.Printf("There are %v goroutines", runtime.NumGoroutine())
+	log.Printf("Launching the Gourutines")
+
+	header := cntxt.dataWriter.Header()
+	schemas := make(map[string]*record.Schema)
+	for source := range header.Sources {
+		schemas[source] = header.Schema(source)
+	}
+	theHub.Begin(cntxt.Run.ID(), cntxt.getTime0(), schemas)
+	cntxt.pipeline = record.NewPipeline(recordBuffer, recordPolicy, cntxt.dataWriter, theHub)
+	cntxt.supervisor = acquisition.New(context.Background(), cntxt.pipeline)
+	cntxt.newArduinoDecoder()
+	cntxt.supervisor.Go("Arduino", cntxt.readFromArduino)
+	log.Println("Started Arduino")
+	theOshi.filters = [nTrackers]*gpio.Filter{}
+	cntxt.TrackerSuppressed = [nTrackers]uint64{}
+	if cntxt.SetTrackerA == ON {
+		cntxt.startTracker(0, TrackerAPin, theOshi.trackerA)
+	}
+	if cntxt.SetTrackerB == ON {
+		cntxt.startTracker(1, TrackerBPin, theOshi.trackerB)
+	}
+	if cntxt.SetTrackerC == ON {
+		cntxt.startTracker(2, TrackerCPin, theOshi.trackerC)
+	}
+	if cntxt.SetTrackerD == ON {
+		cntxt.startTracker(3, TrackerDPin, theOshi.trackerD)
+	}
+	log.Printf("There are %v goroutines", runtime.NumGoroutine())
+	cntxt.publishStatus()
+	//defer close the file to STOP
+	return cntxt.State.To(RUNNING)
+}
+
+//abortRun goes back to stopped if the run can't begin
+func (cntxt *Context) abortRun(err error) {
+	log.Println(err.Error())
+	if cntxt.DataFile != nil {
+		cntxt.DataFile.Close()
+	}
+	cntxt.State.To(STOPPED)
+}
+
+//Stop allows to stop the experiments
+func Stop(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+	log.Println(">>>", theContext)
+
+	switch theContext.State.Current() {
+	case INIT, CONFIGURED:
+		theContext.Message = messageStopIC[theContext.Lang]
+		theContext.AlertLevel = DANGER
+		theContext.Title = titleExperiment[theContext.Lang]
+		render(w, "experiment", theContext)
+	case STOPPED:
+		if req.Method == "POST" {
+			// the notes of the run just stopped
+			theContext.saveNotes(req)
+			theContext.Title = titleStop[theContext.Lang]
+			render(w, "stop", theContext)
+			return
+		}
+		// we already are in this State
+		// only put a message, but don't touch the process
+		theContext.Message = messageStopS[theContext.Lang]
+		theContext.AlertLevel = WARNING
+		theContext.Title = titleStop[theContext.Lang]
+		render(w, "experiment", theContext)
+	case STARTING:
+		// another request is starting it, there's nothing to stop yet
+		theContext.Message = messageStopStarting[theContext.Lang]
+		theContext.AlertLevel = WARNING
+		theContext.Title = titleRun[theContext.Lang]
+		render(w, "run", theContext)
+	case STOPPING:
+		// another request is stopping the experiment
+		theContext.Message = messageStopStopping[theContext.Lang]
 		theContext.AlertLevel = WARNING
 		theContext.Title = titleStop[theContext.Lang]
 		render(w, "experiment", theContext)
 	case RUNNING:
 		//correct state, do the stop process
-		// stop process instruction here!
-		// stop process instruction here!
-		// stop process instruction here!
-
-		//stop gorutines??
-		log.Printf("Stop Gourutines (no at this time)")
-		log.Printf("There are %v goroutines", runtime.NumGoroutine())
-
-		//swich off the status led in the raspi
-		hwio.DigitalWrite(theOshi.statusLed, hwio.LOW)
-		// close the GPIO pins
-		//hwio.CloseAll()
-
-		//stop the arduino from read sensor and sending data via BT
-		setArduinoStateOFF()
-		log.Printf("Set Arduino OFF")
-
-		//close the file
-		err := theContext.DataFile.Sync()
-		if err != nil {
+		if _, err := theContext.stopRun(); err != nil {
+			stateError(w, err)
+			return
+		}
+		theContext.Kinematics = nil
+		if segments, err := readRuns(theContext.Run); err != nil {
 			log.Println(err.Error())
+		} else {
+			theContext.Kinematics = view.Kinematics(segments)
 		}
-		theContext.DataFile.Close()
-
 		theContext.Message = messageStopR[theContext.Lang]
 		theContext.Title = titleStop[theContext.Lang]
-		theContext.State = STOPPED
 		theContext.AlertLevel = SUCCESS
 		render(w, "stop", theContext)
 
 	}
 }
 
+//stopRun stops the readers of the sensors, writes what they have read to the
+//data file and closes it, and goes to STOPPED; the run is recorded in the
+//catalog. The error is a *state.Error if the platform isn't running
+func (cntxt *Context) stopRun() (catalog.Entry, error) {
+	if err := cntxt.State.To(STOPPING); err != nil {
+		return catalog.Entry{}, err
+	}
+
+	// close the GPIO pins
+	//hwio.CloseAll()
+
+	//stop the arduino from read sensor and sending data via BT; if it
+	//can't be told, its reader is interrupted anyway
+	offErr := setArduinoStateOFF()
+	log.Printf("Set Arduino OFF")
+
+	//stop gorutines, waiting for their records to be written
+	log.Printf("Stop Gourutines")
+	cntxt.Acquisition = cntxt.supervisor.Stop()
+	if offErr != nil {
+		cntxt.Acquisition.Errors = append(cntxt.Acquisition.Errors, offErr)
+	}
+	log.Printf("All the records flushed: %s", cntxt.Acquisition)
+	theHub.End(cntxt.Run.ID())
+	for _, e := range cntxt.Acquisition.Errors {
+		log.Println(e)
+	}
+	log.Printf("There are %v goroutines", runtime.NumGoroutine())
+
+	cntxt.writeFooter()
+
+	//close the file
+	err := cntxt.DataFile.Sync()
+	if err != nil {
+		log.Println(err.Error())
+	}
+	cntxt.DataFile.Close()
+	entry := cntxt.catalogRun(cntxt.Run)
+
+	return entry, cntxt.State.To(STOPPED)
+}
+
 //Collect the data gathered in the experiments
 func Collect(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
-		//read the data directory and offers the files to be downloaded
-		theContext.DataFiles, _ = filepath.Glob(filepath.Join(StaticRoot, DataFilePath, "*"+DataFileExtension))
-		//log.Println(">>>> " + filepath.Join(StaticRoot, DataFilePath, "*"+DataExtension))
-		//let only the file name, eliminate the path
-		for i, f := range theContext.DataFiles {
-			theContext.DataFiles[i] = path.Base(f)
+		//read the experiments and their runs, and offers the ones searched
+		//to be downloaded
+		req.ParseForm()
+		theContext.Query = strings.TrimSpace(req.Form.Get("q"))
+		theContext.Collections = theContext.collections(experiment.Active, theContext.Query)
+		legacy, err := theStore.Legacy()
+		if err != nil {
+			log.Println(err.Error())
 		}
-
-		log.Println(theContext.DataFiles)
+		theContext.LegacyFiles = legacy
 
 		theContext.Title = titleCollect[theContext.Lang]
-		if len(theContext.DataFiles) == 0 {
+		if len(theContext.Collections) == 0 && theContext.Query != "" {
+			theContext.Message = fmt.Sprintf(messageCollectQuery0[theContext.Lang], theContext.Query)
+			theContext.AlertLevel = WARNING
+		} else if len(theContext.Collections) == 0 && len(theContext.LegacyFiles) == 0 {
 			theContext.Message = messageCollectICS0[theContext.Lang]
 			theContext.AlertLevel = WARNING
 		} else {
@@ -1125,13 +1709,795 @@ func Collect(w http.ResponseWriter, req *http.Request) {
 			theContext.AlertLevel = INFO
 		}
 		render(w, "collect", theContext)
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
+		theContext.Message = messageCollectR[theContext.Lang]
+		theContext.AlertLevel = WARNING
+		theContext.Title = titleRun[theContext.Lang]
+		render(w, "run", theContext)
+	}
+
+}
+
+//collections the experiments of the area with the runs matching the
+//search
+func (cntxt *Context) collections(a experiment.Area, query string) []Collection {
+	experiments, err := theStore.ExperimentsIn(a)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	var collections []Collection
+	for _, e := range experiments {
+		if collection := cntxt.newCollection(a, e, query); len(collection.Runs) > 0 {
+			collections = append(collections, collection)
+		}
+	}
+	return collections
+}
+
+//newCollection the runs of the experiment matching the search, from the
+//catalog
+func (cntxt *Context) newCollection(a experiment.Area, e experiment.Experiment, query string) Collection {
+	collection := Collection{Name: e.Name}
+	tables := make(map[string]bool)
+	for _, run := range e.Runs {
+		entry := cntxt.catalogEntry(a, run)
+		if !entry.Matches(query) {
+			continue
+		}
+		for _, t := range entry.Tables {
+			tables[t] = true
+		}
+		collection.Runs = append(collection.Runs, entry)
+	}
+	// the tables of all the runs, in the order of the export
+	for _, t := range []string{export.IMU, export.Distance, export.Analog, export.Events} {
+		if tables[t] {
+			collection.Tables = append(collection.Tables, t)
+		}
+	}
+	return collection
+}
+
+//catalogEntry the entry of the run of the area in the catalog; the ones of
+//active runs are added from their files if they aren't there, as the runs
+//of older versions
+func (cntxt *Context) catalogEntry(a experiment.Area, run experiment.Run) catalog.Entry {
+	if entry, ok := theCatalog.Get(run.ID()); ok {
+		return entry
+	}
+	if a != experiment.Active {
+		return catalog.Entry{ID: run.ID(), Experiment: run.Experiment, Run: run.Number,
+			File: run.File(), Area: areaName(a)}
+	}
+	return cntxt.catalogRun(run)
+}
+
+//catalogRun records the run in the catalog, from its file, keeping the
+//operator and the notes
+func (cntxt *Context) catalogRun(run experiment.Run) catalog.Entry {
+	segments, err := readRuns(run)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	entry := newCatalogEntry(run, segments)
+	if old, ok := theCatalog.Get(run.ID()); ok {
+		entry.Operator = old.Operator
+		entry.Notes = old.Notes
+	}
+	if err := theCatalog.Put(entry); err != nil {
+		log.Println(err.Error())
+	}
+	return entry
+}
+
+//newCatalogEntry the entry of the run in the catalog, from the segments of
+//its file
+func newCatalogEntry(run experiment.Run, segments []datafile.Segment) catalog.Entry {
+	entry := catalog.Entry{ID: run.ID(), Experiment: run.Experiment, Run: run.Number,
+		File: run.File(), Sources: make(map[string]uint64)}
+	for _, segment := range segments {
+		if entry.Start.IsZero() {
+			entry.Start = segment.Header.Start
+			for name, set := range segment.Header.Sensors {
+				if set {
+					entry.Sensors = append(entry.Sensors, name)
+				}
+			}
+			sort.Strings(entry.Sensors)
+		}
+		for _, row := range segment.Rows {
+			entry.Sources[row.Source]++
+			entry.Records++
+		}
+		if segment.Footer != nil {
+			entry.Stop = segment.Footer.Stop
+			entry.Dropped += segment.Footer.Dropped
+		}
+	}
+	if entry.Stopped() {
+		entry.Duration = math.Round(entry.Stop.Sub(entry.Start).Seconds()*1000) / 1000
+	}
+	entry.Tables = export.Tables(segments)
+	return entry
+}
+
+//saveNotes stores the operator and the notes of the form in the entry of
+//the run
+func (cntxt *Context) saveNotes(req *http.Request) {
+	req.ParseForm()
+	cntxt.Operator = strings.TrimSpace(req.Form.Get("Operator"))
+	cntxt.Notes = strings.TrimSpace(req.Form.Get("Notes"))
+	err := theCatalog.Update(cntxt.Run.ID(), func(e *catalog.Entry) {
+		e.Operator = cntxt.Operator
+		e.Notes = cntxt.Notes
+	})
+	if err != nil {
+		log.Println(err.Error())
+		cntxt.Message = err.Error()
+		cntxt.AlertLevel = DANGER
+		return
+	}
+	cntxt.Message = messageNotes[cntxt.Lang]
+	cntxt.AlertLevel = SUCCESS
+}
+
+//actions on the runs of the manage page, and the areas where the runs can be
+var manageActions = map[string][]experiment.Area{
+	"archive":   {experiment.Active},
+	"unarchive": {experiment.Archive},
+	"rename":    {experiment.Active, experiment.Archive},
+	"delete":    {experiment.Active, experiment.Archive},
+	"restore":   {experiment.Trash},
+	"purge":     {experiment.Trash},
+	"empty":     nil,
+}
+
+//areaName the name of the area in the forms and the catalog, empty for the
+//active runs
+func areaName(a experiment.Area) string {
+	if a == experiment.Active {
+		return ""
+	}
+	return a.String()
+}
+
+//parseArea the area called name in the forms
+func parseArea(name string) (experiment.Area, bool) {
+	for _, a := range experiment.Areas {
+		if name == areaName(a) || name == a.String() {
+			return a, true
+		}
+	}
+	return experiment.Active, false
+}
+
+//Manage the runs one by one: archive them, rename them, delete them to the
+//trash and restore or purge them; every action must be confirmed
+func Manage(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+	log.Println(">>>", theContext)
+
+	switch theContext.State.Current() {
+	case STARTING, RUNNING, STOPPING:
+		theContext.Message = messageManageR[theContext.Lang]
+		theContext.AlertLevel = WARNING
+		theContext.Title = titleRun[theContext.Lang]
+		render(w, "run", theContext)
+		return
+	}
+	theContext.Title = titleManage[theContext.Lang]
+	theContext.Action = ""
+	req.ParseForm()
+	action := req.Form.Get("action")
+	if action == "" {
+		theContext.Message = messageManage[theContext.Lang]
+		theContext.AlertLevel = INFO
+		theContext.showAreas(w)
+		return
+	}
+
+	// the run of the action, in its area
+	areas, known := manageActions[action]
+	area, areaOK := parseArea(req.Form.Get("area"))
+	run, err := experiment.ParseID(req.Form.Get("run"))
+	switch {
+	case !known || action != "empty" && (!areaOK || !containsArea(areas, area)):
+		err = fmt.Errorf(messageManageAction[theContext.Lang], action)
+	case action == "empty":
+		err = nil
+	case err == nil:
+		err = theStore.RunIn(area, run)
+	}
+	if err != nil {
+		theContext.Message = fmt.Sprintf(messageManageError[theContext.Lang], err)
+		theContext.AlertLevel = DANGER
+		theContext.showAreas(w)
+		return
+	}
+
+	if req.Method != "POST" || req.Form.Get("confirm") != "YES" {
+		// ask for the confirmation
+		theContext.Action = action
+		theContext.TargetArea = areaName(area)
+		theContext.Target = catalog.Entry{}
+		if action != "empty" {
+			theContext.Target = theContext.catalogEntry(area, run)
+		}
+		theContext.Message = messageManageConfirm[theContext.Lang]
+		theContext.AlertLevel = WARNING
+		render(w, "manage", theContext)
+		return
+	}
+
+	if err := manageRun(action, area, run, strings.TrimSpace(req.Form.Get("name"))); err != nil {
+		log.Println(err.Error())
+		theContext.Message = fmt.Sprintf(messageManageError[theContext.Lang], err)
+		theContext.AlertLevel = DANGER
+	} else {
+		theContext.Message = messageManageDone[theContext.Lang]
+		theContext.AlertLevel = SUCCESS
+	}
+	theContext.showAreas(w)
+}
+
+//showAreas renders the manage page with the runs archived and deleted
+func (cntxt *Context) showAreas(w http.ResponseWriter) {
+	cntxt.Action = ""
+	cntxt.Archived = cntxt.collections(experiment.Archive, "")
+	cntxt.Trashed = cntxt.collections(experiment.Trash, "")
+	render(w, "manage", *cntxt)
+}
+
+func containsArea(areas []experiment.Area, a experiment.Area) bool {
+	for _, e := range areas {
+		if e == a {
+			return true
+		}
+	}
+	return false
+}
+
+//manageRun does the action on the run of the area, and records it in the
+//catalog
+func manageRun(action string, area experiment.Area, run experiment.Run, name string) error {
+	switch action {
+	case "archive":
+		return moveRun(run, area, experiment.Archive)
+	case "unarchive", "restore":
+		return moveRun(run, area, experiment.Active)
+	case "delete":
+		return moveRun(run, area, experiment.Trash)
+	case "rename":
+		renamed, err := theStore.Rename(run, area, experiment.CleanName(name))
+		if _, ok := err.(*experiment.NameError); ok {
+			return errors.New(nameMessage(err))
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Renamed %s to %s", run, renamed)
+		return updateEntry(run, func(e *catalog.Entry) {
+			e.ID = renamed.ID()
+			e.Experiment = renamed.Experiment
+			e.Run = renamed.Number
+			e.File = renamed.File()
+		})
+	case "purge":
+		return purgeRun(run)
+	case "empty":
+		trashed, err := theStore.ExperimentsIn(experiment.Trash)
+		if err != nil {
+			return err
+		}
+		for _, e := range trashed {
+			for _, run := range e.Runs {
+				if err := purgeRun(run); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf(messageManageAction[theContext.Lang], action)
+}
+
+//moveRun moves the run to another area, and records it in the catalog
+func moveRun(run experiment.Run, from, to experiment.Area) error {
+	if err := theStore.Move(run, from, to); err != nil {
+		return err
+	}
+	log.Printf("Moved %s from %s to %s", run, from, to)
+	return updateEntry(run, func(e *catalog.Entry) { e.Area = areaName(to) })
+}
+
+//purgeRun removes the run of the trash and of the catalog
+func purgeRun(run experiment.Run) error {
+	if err := theStore.Purge(run); err != nil {
+		return err
+	}
+	log.Printf("Purged %s", run)
+	if err := theCatalog.Remove(run.ID()); err != nil && err != catalog.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+//updateEntry changes the entry of the run in the catalog, if it's there
+func updateEntry(run experiment.Run, change func(*catalog.Entry)) error {
+	if err := theCatalog.Update(run.ID(), change); err != nil && err != catalog.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+//Legacy downloads a data file of an older version, /legacy/cart.csv, as it
+//was written
+func Legacy(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+
+	name := strings.TrimPrefix(req.URL.Path, LegacyURL)
+	f, err := theStore.OpenLegacy(name)
+	if err == experiment.ErrNoRun {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, req, name, info.ModTime(), f)
+}
+
+//Catalog the entries of the runs in JSON, all or the ones matching the
+//search ?q=
+func Catalog(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+
+	req.ParseForm()
+	entries := theCatalog.Search(req.Form.Get("q"))
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(entries); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+//View shows a run, /view/cart/2/: plots of its values, the events of its
+//trackers with the intervals between them, and the export of a range of
+//time of it
+func View(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+	log.Println(">>>", theContext)
+
+	switch theContext.State.Current() {
+	case INIT, CONFIGURED, STOPPED:
+		run, err := experiment.ParseID(strings.Trim(strings.TrimPrefix(req.URL.Path, "/view/"), "/"))
+		var segments []datafile.Segment
+		if err == nil {
+			segments, err = readRuns(run)
+		}
+		if err != nil {
+			log.Println(err.Error())
+			http.NotFound(w, req)
+			return
+		}
+		theContext.Viewed = theContext.catalogEntry(experiment.Active, run)
+		theContext.View = view.New(segments)
+		theContext.Kinematics = theContext.View.Kinematics
+
+		theContext.Title = titleView[theContext.Lang]
+		if theContext.Viewed.Records == 0 {
+			theContext.Message = messageView0[theContext.Lang]
+			theContext.AlertLevel = WARNING
+		} else {
+			theContext.Message = messageView[theContext.Lang]
+			theContext.AlertLevel = INFO
+		}
+		render(w, "view", theContext)
+	case STARTING, RUNNING, STOPPING:
 		theContext.Message = messageCollectR[theContext.Lang]
 		theContext.AlertLevel = WARNING
 		theContext.Title = titleRun[theContext.Lang]
 		render(w, "run", theContext)
 	}
+}
+
+//readRuns reads the data files of the runs
+func readRuns(runs ...experiment.Run) ([]datafile.Segment, error) {
+	var segments []datafile.Segment
+	for _, run := range runs {
+		f, err := theStore.Open(run)
+		if err != nil {
+			return nil, err
+		}
+		runSegments, err := datafile.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", run.File(), err)
+		}
+		segments = append(segments, runSegments...)
+	}
+	return segments, nil
+}
+
+//Export the tables of the runs of an experiment, /export/name/..., or of
+//one of them, /export/name/2/...: imu.csv, events.csv..., metadata.json,
+//and the bundle with all of them, name.zip or name-2.zip; or their records,
+//as JSON Lines, name.jsonl, or in columns, name.oshc. The data file of a
+//run, name-2.csv, is only served here, also archived or in the trash
+func Export(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+
+	if current := theContext.State.Current(); current == STARTING || current == RUNNING || current == STOPPING {
+		http.Error(w, messageCollectR[theContext.Lang], http.StatusConflict)
+		return
+	}
+	dir, file := path.Split(strings.TrimPrefix(req.URL.Path, ExportURL))
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" || file == "" {
+		http.NotFound(w, req)
+		return
+	}
+	// the runs exported, and the base of the names of the files
+	var runs []experiment.Run
+	base := dir
+	if run, err := experiment.ParseID(dir); err == nil {
+		runs = []experiment.Run{run}
+		base = run.Experiment + "-" + strconv.Itoa(run.Number)
+	} else if e, err := theStore.Experiment(dir); err == nil {
+		runs = e.Runs
+	} else {
+		http.NotFound(w, req)
+		return
+	}
+	// the data file of a run as it was written, wherever it is kept
+	if len(runs) == 1 && base != dir && file == base+experiment.Extension {
+		area, ok := findRun(runs[0])
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		serveDataFile(w, req, area, runs[0])
+		return
+	}
+	segments, err := readRuns(runs...)
+	if err == experiment.ErrNoRun {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// only the range of time ?from=1.5&to=3.2, in s, if asked
+	if req.FormValue("from") != "" || req.FormValue("to") != "" {
+		from, to, ok := parseRange(req.FormValue("from"), req.FormValue("to"))
+		if !ok {
+			http.Error(w, "bad range of time", http.StatusBadRequest)
+			return
+		}
+		for i := range segments {
+			segments[i] = segments[i].Slice(from, to)
+		}
+	}
+
+	attachment := fmt.Sprintf("attachment; filename=%q", base+"-"+file)
+	switch {
+	case file == base+".zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file))
+		err = export.WriteBundle(w, base, segments)
+	case file == base+".jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file))
+		err = export.WriteJSONLines(w, segments)
+	case file == base+".oshc":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file))
+		err = export.WriteColumnar(w, segments)
+	case file == "metadata.json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", attachment)
+		err = export.WriteMetadata(w, segments)
+	case path.Ext(file) == ".csv" && contains(export.Tables(segments), strings.TrimSuffix(file, ".csv")):
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", attachment)
+		err = export.WriteTable(w, segments, strings.TrimSuffix(file, ".csv"))
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		// the response has begun, only log it
+		log.Println(err.Error())
+	}
+}
+
+//parseRange the range of local time between from and to, in s; from the
+//beginning or till the end if they are empty
+func parseRange(from, to string) (time.Duration, time.Duration, bool) {
+	begin, end := time.Duration(0), time.Duration(math.MaxInt64)
+	if from != "" {
+		s, err := strconv.ParseFloat(from, 64)
+		if err != nil || math.IsNaN(s) || math.Abs(s) > 1e9 {
+			return 0, 0, false
+		}
+		begin = time.Duration(s * float64(time.Second))
+	}
+	if to != "" {
+		s, err := strconv.ParseFloat(to, 64)
+		if err != nil || math.IsNaN(s) || math.Abs(s) > 1e9 {
+			return 0, 0, false
+		}
+		end = time.Duration(s * float64(time.Second))
+	}
+	return begin, end, begin <= end
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+//// JSON API: the same workflow of the web pages, for scripts and apps
+
+//runStatus the configuration and the run for the API, copied from the
+//context by the requests that change them, as the API reads them while
+//other requests are changing the context
+type runStatus struct {
+	configuration string
+	run           experiment.Run
+	start         time.Time
+	link          frame.Stats
+	suppressed    [nTrackers]uint64
+	//decoder of the run, for the quality of the link while running
+	decoder frame.Source
+}
+
+//publishStatus copies the configuration and the run for the API
+func (cntxt *Context) publishStatus() {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	theStatus = runStatus{
+		configuration: cntxt.ConfigurationName,
+		run:           cntxt.Run,
+		start:         cntxt.getTime0(),
+		link:          cntxt.LinkStats,
+		suppressed:    cntxt.TrackerSuppressed,
+		decoder:       cntxt.decoder,
+	}
+}
+
+//publishedStatus the configuration and the run last published
+func publishedStatus() runStatus {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	return theStatus
+}
+
+//platform the sensor platform driven by the API; it holds the lock of the
+//context while reading or changing it, as the web pages
+type platform struct{}
+
+//State of the platform, from the run last published, so it doesn't wait
+//for a run being started or stopped
+func (platform) State() api.State {
+	current := theContext.State.Current()
+	status := publishedStatus()
+	body := api.State{State: current.String(), Configuration: status.configuration}
+	if status.run.Number > 0 {
+		body.Run = status.run.ID()
+		body.Start = &status.start
+		stats, suppressed := status.link, status.suppressed
+		if current == RUNNING && status.decoder != nil {
+			stats, suppressed = status.decoder.Stats(), theOshi.trackerSuppressed()
+		}
+		body.Link = linkQuality(stats)
+		body.Suppressed = make(map[string]uint64)
+		for i, name := range trackerNames {
+			body.Suppressed[name] = suppressed[i]
+		}
+	}
+	body.History = []api.Transition{}
+	for _, t := range theContext.State.History() {
+		body.History = append(body.History, api.Transition{From: t.From.String(), To: t.To.String(), At: t.At})
+	}
+	return body
+}
+
+//Config the current configuration
+func (platform) Config() api.Config {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	return theContext.apiConfig()
+}
+
+//Configure the platform as the web page; if the name is of another
+//experiment the time is added to it
+func (platform) Configure(config api.Config) (api.Config, error) {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	form, err := configForm(config)
+	if err != nil {
+		return api.Config{}, &api.ConfigError{Err: err}
+	}
+	if _, err := theContext.configure(form); err != nil {
+		if err == errFilter || err == errPhotogates {
+			err = &api.ConfigError{Err: err}
+		}
+		return api.Config{}, err
+	}
+	return theContext.apiConfig(), nil
+}
+
+//Start a new run of the configuration
+func (platform) Start() (catalog.Entry, error) {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	if err := theContext.startRun(); err != nil {
+		return catalog.Entry{}, err
+	}
+	entry, _ := theCatalog.Get(theContext.Run.ID())
+	return entry, nil
+}
+
+//Stop the run, when all its records are written
+func (platform) Stop() (catalog.Entry, error) {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	return theContext.stopRun()
+}
+
+//Runs of the catalog in the area matching the search
+func (platform) Runs(area experiment.Area, query string) []catalog.Entry {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	var entries []catalog.Entry
+	for _, collection := range theContext.collections(area, query) {
+		entries = append(entries, collection.Runs...)
+	}
+	return entries
+}
+
+//Run the entry of the run, wherever it is kept
+func (platform) Run(run experiment.Run) (catalog.Entry, experiment.Area, bool) {
+	contextMutex.Lock()
+	defer contextMutex.Unlock()
+	area, found := findRun(run)
+	if !found {
+		return catalog.Entry{}, area, false
+	}
+	return theContext.catalogEntry(area, run), area, true
+}
+
+//ServeData the data file of the run, as it was written
+func (platform) ServeData(w http.ResponseWriter, req *http.Request, area experiment.Area, run experiment.Run) {
+	serveDataFile(w, req, area, run)
+}
+
+//apiConfig the current configuration
+func (cntxt *Context) apiConfig() api.Config {
+	photogates := cntxt.Photogates
+	config := api.Config{Name: cntxt.ConfigurationName, Sensors: cntxt.sensors(),
+		Debounce: make(map[string]float64), MinInterval: make(map[string]float64),
+		Photogates: &photogates}
+	for i, name := range trackerNames {
+		config.Debounce[name] = cntxt.TrackerDebounce[i]
+		config.MinInterval[name] = cntxt.TrackerMinInterval[i]
+	}
+	return config
+}
+
+//configForm the fields of the config form with the configuration
+func configForm(config api.Config) (url.Values, error) {
+	form := url.Values{"ConfigurationName": {config.Name}}
+	known := theContext.sensors()
+	for name, set := range config.Sensors {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("no such sensor %q", name)
+		}
+		if set {
+			form.Set("Set"+strings.ToUpper(name[:1])+name[1:], SensorStateOn)
+		}
+	}
+	for field, filter := range map[string]map[string]float64{"Debounce": config.Debounce, "MinInterval": config.MinInterval} {
+		for name, ms := range filter {
+			if !contains(trackerNames[:], name) {
+				return nil, fmt.Errorf("no such tracker %q", name)
+			}
+			form.Set(field+name, strconv.FormatFloat(ms, 'g', -1, 64))
+		}
+	}
+	if p := config.Photogates; p != nil {
+		for i, d := range p.Spacings {
+			form.Set("GateSpacing"+kinematics.Gates[i:i+2], strconv.FormatFloat(d, 'g', -1, 64))
+		}
+		form.Set("FlagLength", strconv.FormatFloat(p.FlagLength, 'g', -1, 64))
+		form.Set("LengthError", strconv.FormatFloat(p.LengthError, 'g', -1, 64))
+		form.Set("TimeError", strconv.FormatFloat(p.TimeError, 'g', -1, 64))
+	}
+	return form, nil
+}
 
+//locked the handler of a page, holding the lock of the context while it
+//reads or changes it
+func locked(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		contextMutex.Lock()
+		defer contextMutex.Unlock()
+		handler(w, req)
+	}
+}
+
+//API the JSON API, served by theAPI
+func API(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+	theAPI.ServeHTTP(w, req)
+}
+
+//findRun the area where the run is kept
+func findRun(run experiment.Run) (experiment.Area, bool) {
+	for _, a := range experiment.Areas {
+		if theStore.RunIn(a, run) == nil {
+			return a, true
+		}
+	}
+	return experiment.Active, false
+}
+
+//serveDataFile sends the data file of the run of the area, as it was
+//written
+func serveDataFile(w http.ResponseWriter, req *http.Request, area experiment.Area, run experiment.Run) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", run.Experiment+"-"+path.Base(run.File())))
+	http.ServeFile(w, req, theStore.PathIn(area, run))
+}
+
+//Plot the data of the run as they are acquired, in the plots of the
+//sensors configured
+func Plot(w http.ResponseWriter, req *http.Request) {
+	log.Println(">>>", req.URL)
+	log.Println(">>>", theContext)
+
+	switch theContext.State.Current() {
+	case STARTING, RUNNING, STOPPING:
+		theContext.Message = messagePlotR[theContext.Lang]
+		theContext.AlertLevel = SUCCESS
+	case INIT, CONFIGURED, STOPPED:
+		theContext.Message = messagePlotICS[theContext.Lang]
+		theContext.AlertLevel = INFO
+	}
+	theContext.Title = titlePlot[theContext.Lang]
+	render(w, "plot", theContext)
+}
+
+//liveEvent true for the records of the trackers and the ones of the arduino
+//with the sync of the tracker M
+func liveEvent(r record.Record) bool {
+	if r.Source != "Ard" {
+		return true
+	}
+	for i, f := range r.Schema.Fields {
+		if f.Name == "sync" {
+			return r.Values[i] == 1
+		}
+	}
+	return false
 }
 
 //Poweroff the system
@@ -1139,7 +2505,7 @@ func Poweroff(w http.ResponseWriter, req *http.Request) {
 	log.Println(">>>", req.URL)
 	log.Println(">>>", theContext)
 
-	switch theContext.State {
+	switch theContext.State.Current() {
 	case INIT, CONFIGURED, STOPPED:
 		// correct states
 		if req.Method == "GET" {
@@ -1153,8 +2519,12 @@ func Poweroff(w http.ResponseWriter, req *http.Request) {
 			log.Println(req.Form)
 			if req.Form.Get("poweroff") == "YES" {
 				//if YES, switch off the platform
-				theContext.State = POWEROFF
+				if err := theContext.State.To(POWEROFF); err != nil {
+					stateError(w, err)
+					return
+				}
 				theContext.ConfigurationName = ""
+				theContext.publishStatus()
 				//message of poweroff state
 				theContext.Message = messagePoweroffICSPostYes[theContext.Lang]
 				theContext.AlertLevel = SUCCESS
@@ -1177,7 +2547,7 @@ func Poweroff(w http.ResponseWriter, req *http.Request) {
 				render(w, "experiment", theContext)
 			}
 		}
-	case RUNNING:
+	case STARTING, RUNNING, STOPPING:
 		// wrong state
 		theContext.Message = messagePoweroffR[theContext.Lang]
 		theContext.AlertLevel = DANGER
@@ -1187,6 +2557,8 @@ func Poweroff(w http.ResponseWriter, req *http.Request) {
 
 }
 
+//shutdown halts the system; if it can't, the platform goes back to its
+//initial state, so it can still be used
 func shutdown() {
 	cmd := exec.Command("shutdown", "-h", "now")
 	//cmd := exec.Command("shutdown", "-k", "now")
@@ -1194,7 +2566,9 @@ func shutdown() {
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		log.Fatal(err)
+		log.Println("error halting the system:", err)
+		theContext.State.To(INIT)
+		theContext.publishStatus()
 	} else { //command was successful
 		log.Println("Bye!")
 	}
@@ -1224,7 +2598,11 @@ func render(w http.ResponseWriter, tmpl string, cntxt Context) {
 	cntxt.Static = StaticURL
 	//list of templates, put here all the templates needed
 	tmplList := []string{"templates/base.html",
-		fmt.Sprintf("templates/message.html"),
+		"templates/message.html",
+		"templates/linkStats.html",
+		"templates/trackerStats.html",
+		"templates/notes.html",
+		"templates/kinematics.html",
 		fmt.Sprintf("templates/%s.html", tmpl)}
 	t, err := template.ParseFiles(tmplList...)
 	if err != nil {
@@ -1236,10 +2614,25 @@ func render(w http.ResponseWriter, tmpl string, cntxt Context) {
 	}
 }
 
+//privateStatic the file isn't served as static content: the data, served
+//by Export and Legacy, and the hidden files and directories
+func privateStatic(name string) bool {
+	clean := path.Clean("/" + name)
+	if clean+"/" == "/"+DataFilePath || strings.HasPrefix(clean, "/"+DataFilePath) {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
 //StaticHandler allows to server the statics references
 func StaticHandler(w http.ResponseWriter, req *http.Request) {
 	staticFile := req.URL.Path[len(StaticURL):]
-	if len(staticFile) != 0 {
+	if len(staticFile) != 0 && !privateStatic(staticFile) {
 		f, err := http.Dir(StaticRoot).Open(staticFile)
 		if err == nil {
 			content := io.ReadSeeker(f)
@@ -1251,34 +2644,123 @@ func StaticHandler(w http.ResponseWriter, req *http.Request) {
 }
 
 func main() {
+	//select the transport with the arduino, by default the BT serial device
+	flag.StringVar(&theContext.Transport.Kind, "transport", transport.BT,
+		"transport with the Arduino: bt, usb, tcp, udp, file or esp32")
+	flag.StringVar(&theContext.Transport.Device, "device", "",
+		"serial device for bt and usb (default "+transport.BTDevice+" or "+transport.USBDevice+")")
+	flag.IntVar(&theContext.Transport.Baud, "baud", 0,
+		fmt.Sprintf("bauds of the serial device for bt and usb (default %d or %d)",
+			transport.BTBauds, transport.USBBauds))
+	flag.StringVar(&theContext.Transport.Address, "address", "",
+		"host:port to connect to with tcp, or :port to listen on with udp and esp32 (default "+transport.ESP32Address+" with esp32)")
+	flag.StringVar(&theContext.Transport.File, "file", "",
+		"capture to read with file")
+	flag.BoolVar(&escapedFraming, "escaped", escapedFraming,
+		"ask the Arduino to escape the bytes of the frames; a capture is read with its own framing")
+	flag.BoolVar(&frameChecksum, "checksum", frameChecksum,
+		"ask the Arduino to add a checksum to the frames; a capture is read with its own framing")
+	flag.StringVar(&captureFile, "capture", "",
+		"file to record the frames read from the Arduino, to replay them with file")
+
+	//or simulate the whole platform
+	simulate := flag.Bool("sim", false,
+		"simulate the platform: no Raspberry Pi, trackers or Arduino needed")
+	profile := sim.DefaultProfile()
+	flag.StringVar(&profile.Motion, "sim-motion", profile.Motion,
+		"motion of the simulated cart: rest, uniform, accelerated or oscillating")
+	flag.Float64Var(&profile.Velocity, "sim-velocity", profile.Velocity,
+		"velocity (m/s) of the uniform motion of the simulated cart")
+	flag.Float64Var(&profile.Acceleration, "sim-acceleration", profile.Acceleration,
+		"acceleration (m/s2) of the accelerated motion of the simulated cart")
+	noise := flag.Float64("sim-noise", 1,
+		"noise of the simulated sensors, times the default one")
+	flag.Float64Var(&simRate, "sim-rate", sim.DefaultRate,
+		"frames per second of the simulated Arduino")
+
+	edges := flag.String("tracker-edges", trackerEdges.String(),
+		"edges of the trackers to record: rising, falling or both")
+
+	flag.IntVar(&recordBuffer, "record-buffer", recordBuffer,
+		"records buffered for the data file")
+	policy := flag.String("record-policy", recordPolicy.String(),
+		"when the buffer of records is full: block, drop-newest or drop-oldest")
+	flag.BoolVar(&verbose, "verbose", false,
+		"log every record of the sensors and every edge of the trackers")
+	flag.Parse()
+
+	var err error
+	trackerEdges, err = gpio.ParseEdges(*edges)
+	if err != nil {
+		log.Fatal(err)
+	}
+	recordPolicy, err = record.ParsePolicy(*policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *simulate {
+		profile.DistanceNoise *= *noise
+		profile.AccNoise *= *noise
+		profile.GyroNoise *= *noise
+		theCart, err = sim.NewCart(profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i := range defaultPhotogates.Spacings {
+			//to the um, without the errors of the subtraction
+			defaultPhotogates.Spacings[i] = math.Round((profile.Gates[i+1]-profile.Gates[i])*1e6) / 1e6
+		}
+		defaultPhotogates.FlagLength = profile.FlagLength
+	}
+
 	//set the initial state
 	theContext.initiate()
-	theOshi.initiate()
-
-	http.HandleFunc("/", Home)
-	http.HandleFunc("/thePlatform/", ThePlatform)
-	http.HandleFunc("/experiment/", Experiment)
-	http.HandleFunc("/init/", Init)
-	http.HandleFunc("/config/", Config)
-	http.HandleFunc("/test/", Test)
-	http.HandleFunc("/run/", Run)
-	http.HandleFunc("/stop/", Stop)
-	http.HandleFunc("/collect/", Collect)
-	http.HandleFunc("/poweroff/", Poweroff)
+	if theCart != nil {
+		theOshi.initiate(simulatedBoard(theCart))
+	} else {
+		theOshi.initiate(gpio.Hwio{})
+	}
+	//the status led is on while running
+	theContext.State.OnTransition(func(t state.Transition) {
+		if t.To == RUNNING {
+			theOshi.statusLed.Write(gpio.HIGH)
+		} else if t.From == RUNNING {
+			theOshi.statusLed.Write(gpio.LOW)
+		}
+	})
+
+	http.HandleFunc("/", locked(Home))
+	http.HandleFunc("/thePlatform/", locked(ThePlatform))
+	http.HandleFunc("/experiment/", locked(Experiment))
+	http.HandleFunc("/init/", locked(Init))
+	http.HandleFunc("/config/", locked(Config))
+	http.HandleFunc("/test/", locked(Test))
+	http.HandleFunc("/run/", locked(Run))
+	http.HandleFunc("/stop/", locked(Stop))
+	http.HandleFunc("/plot/", locked(Plot))
+	http.HandleFunc("/collect/", locked(Collect))
+	http.HandleFunc("/view/", locked(View))
+	http.HandleFunc(ExportURL, Export)
+	http.HandleFunc("/catalog/", Catalog)
+	http.HandleFunc(LegacyURL, Legacy)
+	http.HandleFunc("/manage/", locked(Manage))
+	http.HandleFunc("/poweroff/", locked(Poweroff))
 	//http.HandleFunc("/end/", End)
-	http.HandleFunc("/about/", About)
-	http.HandleFunc("/help/", Help)
+	http.HandleFunc("/about/", locked(About))
+	http.HandleFunc("/help/", locked(Help))
 	http.HandleFunc(StaticURL, StaticHandler)
+	http.HandleFunc(APIURL, API)
 
 	// change this to show the real ip address of eth0
 	//log.Println("Listening on 192.168.1.1:8000")
 
-	err := http.ListenAndServe(":8000", nil)
+	err = http.ListenAndServe(":8000", nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
 
 	// close the GPIO pins
-	defer theContext.SerialPort.Close()
-	hwio.CloseAll()
+	defer theContext.Arduino.Close()
+	theOshi.board.Close()
 }
@@ -0,0 +1,193 @@
+package sim
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/frame"
+)
+
+// limits of the HC-SR04 (mm)
+const (
+	minDistance = 20
+	maxDistance = 4000
+)
+
+// DefaultRate frames per second sent by the simulated Arduino, about the
+// rate of the real one with the HC-SR04 measuring
+const DefaultRate = 25
+
+// Arduino simulated Arduino riding the cart. It understands the commands of
+// the firmware written to it, and gives its frames when read, at Rate
+// frames per second while it is on.
+type Arduino struct {
+	cart *Cart
+	rate float64
+	boot time.Time
+	rand *rand.Rand
+
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	on       bool
+	closed   bool
+	escaping bool
+	checksum bool
+	pending  []byte
+	next     time.Time
+	// mobile tracker M: marks at the gates of the base trackers
+	lastPosition float64
+	fired        bool
+	firedMicros  uint32
+}
+
+// NewArduino returns an Arduino riding cart, sending rate frames per second
+func NewArduino(cart *Cart, rate float64) *Arduino {
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	a := &Arduino{
+		cart: cart,
+		rate: rate,
+		// as if it was switched on a while ago
+		boot: time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Second),
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	a.cond = sync.NewCond(&a.mutex)
+	a.reply("Hola, me llamo Arduino, y soy tu nuevo vecino")
+	return a
+}
+
+// Write receives the commands, one per byte, as the firmware does
+func (a *Arduino) Write(p []byte) (int, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		return 0, io.ErrClosedPipe
+	}
+	for _, command := range p {
+		switch command {
+		case 's':
+			a.reply("Status ...")
+			if a.on {
+				a.reply("[OK] On")
+			} else {
+				a.reply("[OK] Off")
+			}
+		case 'n':
+			a.reply("Readding ...")
+			a.on = true
+			a.next = time.Now()
+			a.cart.Restart()
+			a.lastPosition, _ = a.cart.State(a.next)
+		case 'f':
+			a.reply("Stopping ...")
+			a.on = false
+		case 'e':
+			a.reply("Escaping ...")
+			a.escaping = true
+		case 'r':
+			a.reply("Raw ...")
+			a.escaping = false
+		case 'c':
+			a.reply("Checksum ...")
+			a.checksum = true
+		case 'u':
+			a.reply("Unchecked ...")
+			a.checksum = false
+		default:
+			a.reply("Send 'n' to set readdings ON")
+			a.reply("Send 'f' to set readdings OFF")
+		}
+	}
+	a.cond.Broadcast()
+	return len(p), nil
+}
+
+// reply queues a line of text, as Serial.println
+func (a *Arduino) reply(line string) {
+	a.pending = append(a.pending, line+"\r\n"...)
+}
+
+// Read gives the replies to the commands and the frames. It blocks while
+// the Arduino is off and there is nothing pending.
+func (a *Arduino) Read(p []byte) (int, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for len(a.pending) == 0 {
+		if a.closed {
+			return 0, io.EOF
+		}
+		if !a.on {
+			a.cond.Wait()
+			continue
+		}
+		// wait for the time of the next frame, without blocking Write
+		wait := a.next.Sub(time.Now())
+		if wait > 0 {
+			a.mutex.Unlock()
+			time.Sleep(wait)
+			a.mutex.Lock()
+			continue
+		}
+		data := a.measure(a.next)
+		a.pending = append(a.pending, frame.Encode(&data, a.escaping, a.checksum)...)
+		a.next = a.next.Add(time.Duration(float64(time.Second) / a.rate))
+	}
+
+	n := copy(p, a.pending)
+	a.pending = a.pending[n:]
+	return n, nil
+}
+
+// Close stops the Arduino, pending reads return io.EOF
+func (a *Arduino) Close() error {
+	a.mutex.Lock()
+	a.closed = true
+	a.cond.Broadcast()
+	a.mutex.Unlock()
+	return nil
+}
+
+// micros value of the micros() of the Arduino at t
+func (a *Arduino) micros(t time.Time) uint32 {
+	return uint32(t.Sub(a.boot) / time.Microsecond)
+}
+
+// measure the sensors at t
+func (a *Arduino) measure(t time.Time) frame.SensorData {
+	p := a.cart.Profile
+	position, acceleration := a.cart.State(t)
+
+	// the tracker M fires crossing the marks of the track, and the next
+	// frame is a sync one
+	for _, mark := range p.Gates {
+		if (a.lastPosition < mark) != (position < mark) {
+			a.fired = true
+			a.firedMicros = a.micros(t)
+		}
+	}
+	a.lastPosition = position
+
+	var data frame.SensorData
+	data.SensorMicroSeconds = a.micros(t)
+	data.TrackerMicroSeconds = a.firedMicros
+	data.Sync = a.fired
+	a.fired = false
+
+	// the HC-SR04 looks at the start bumper
+	distance := position*1000 + a.rand.NormFloat64()*p.DistanceNoise
+	data.Distance = uint32(math.Max(minDistance, math.Min(maxDistance, distance)))
+
+	// the X axis of the MPU6000 is vertical, the Y axis along the track
+	data.AccX = float32(-1 + a.rand.NormFloat64()*p.AccNoise)
+	data.AccY = float32(acceleration/Gravity + a.rand.NormFloat64()*p.AccNoise)
+	data.AccZ = float32(a.rand.NormFloat64() * p.AccNoise)
+	data.GyrX = float32(a.rand.NormFloat64() * p.GyroNoise)
+	data.GyrY = float32(a.rand.NormFloat64() * p.GyroNoise)
+	data.GyrZ = float32(a.rand.NormFloat64() * p.GyroNoise)
+	return data
+}
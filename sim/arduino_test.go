@@ -0,0 +1,44 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/ecalman/OSHIWASP/frame"
+)
+
+func TestArduinoFramesDecode(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Motion = Rest
+	profile.DistanceNoise, profile.AccNoise, profile.GyroNoise = 0, 0, 0
+	cart, err := NewCart(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arduino := NewArduino(cart, 1000)
+	defer arduino.Close()
+	// escaped frames with checksum, as the server asks them
+	if _, err := arduino.Write([]byte("ecn")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the replies to the commands are skipped as noise
+	d := frame.NewDecoder(arduino)
+	d.Escaped, d.Checksum = true, true
+	var last uint32
+	for i := 0; i < 10; i++ {
+		data, err := d.Decode()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if data.Distance != uint32(profile.Start*1000) || data.AccX != -1 || data.AccY != 0 {
+			t.Errorf("frame %d: %+v, expected the cart at rest at %v m", i, data, profile.Start)
+		}
+		if i > 0 && data.SensorMicroSeconds <= last {
+			t.Errorf("frame %d at %d us, after %d us", i, data.SensorMicroSeconds, last)
+		}
+		last = data.SensorMicroSeconds
+	}
+	if stats := d.Stats(); stats.Good != 10 || stats.BadFrames != 0 {
+		t.Errorf("stats %s, expected 10 good frames", stats)
+	}
+}
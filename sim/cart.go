@@ -0,0 +1,158 @@
+// Package sim simulates the sensor platform, so the server can run on any
+// computer without the Raspberry Pi, the trackers or the Arduino.
+//
+// A Cart moves along the track following a motion profile. The simulated
+// Arduino travels on it and sends the frames of its sensors (HC-SR04
+// distance, MPU6000 accelerometer and gyroscope, mobile tracker M), and the
+// base trackers A to D see its flag passing in front of them.
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// motion profiles
+const (
+	// Rest the cart doesn't move
+	Rest = "rest"
+	// Uniform the cart moves at constant velocity
+	Uniform = "uniform"
+	// Accelerated the cart starts at rest with constant acceleration
+	Accelerated = "accelerated"
+	// Oscillating the cart oscillates around the middle of the track
+	Oscillating = "oscillating"
+)
+
+// Gravity acceleration (m/s2)
+const Gravity = 9.81
+
+// Profile motion of the cart and setup of the track. Lengths in m, times in
+// s.
+type Profile struct {
+	// Motion Rest, Uniform, Accelerated or Oscillating
+	Motion string
+	// Start position of the cart
+	Start float64
+	// Velocity of the Uniform motion
+	Velocity float64
+	// Acceleration of the Accelerated motion
+	Acceleration float64
+	// Amplitude and Period of the Oscillating motion, around the middle
+	// of the track
+	Amplitude float64
+	Period    float64
+	// TrackLength the cart stops at the bumpers, at 0 and TrackLength
+	TrackLength float64
+	// Gates positions of the base trackers A, B, C and D
+	Gates [4]float64
+	// FlagLength length of the flag of the cart which crosses the gates
+	FlagLength float64
+	// Noise standard deviation of the noise of the sensors, in their units:
+	// mm, g and gr/s
+	DistanceNoise float64
+	AccNoise      float64
+	GyroNoise     float64
+}
+
+// DefaultProfile an accelerated cart on a 2 m track
+func DefaultProfile() Profile {
+	return Profile{
+		Motion:        Accelerated,
+		Start:         0.1,
+		Velocity:      0.5,
+		Acceleration:  0.3,
+		Amplitude:     0.4,
+		Period:        2,
+		TrackLength:   2,
+		Gates:         [4]float64{0.4, 0.8, 1.2, 1.6},
+		FlagLength:    0.05,
+		DistanceNoise: 2,
+		AccNoise:      0.005,
+		GyroNoise:     0.1,
+	}
+}
+
+// Cart the mobile platform moving along the track. The motion starts again
+// each time Restart is called, that is, when the Arduino is set on.
+type Cart struct {
+	Profile Profile
+
+	mutex sync.Mutex
+	start time.Time
+}
+
+// NewCart returns a cart following profile, at rest until Restart
+func NewCart(profile Profile) (*Cart, error) {
+	switch profile.Motion {
+	case Rest, Uniform, Accelerated, Oscillating:
+	default:
+		return nil, fmt.Errorf("sim: unknown motion %q", profile.Motion)
+	}
+	return &Cart{Profile: profile}, nil
+}
+
+// Restart puts the cart at the start position and begins the motion
+func (c *Cart) Restart() {
+	c.mutex.Lock()
+	c.start = time.Now()
+	c.mutex.Unlock()
+}
+
+// elapsed seconds since the beginning of the motion at t, negative if the
+// motion didn't begin
+func (c *Cart) elapsed(t time.Time) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.start.IsZero() {
+		return -1
+	}
+	return t.Sub(c.start).Seconds()
+}
+
+// State position (m) and acceleration (m/s2) of the cart at t
+func (c *Cart) State(t time.Time) (position, acceleration float64) {
+	p := c.Profile
+	s := c.elapsed(t)
+	if s < 0 {
+		return p.Start, 0
+	}
+
+	switch p.Motion {
+	case Uniform:
+		position = p.Start + p.Velocity*s
+	case Accelerated:
+		position = p.Start + p.Acceleration*s*s/2
+		acceleration = p.Acceleration
+	case Oscillating:
+		w := 2 * math.Pi / p.Period
+		middle := p.TrackLength / 2
+		position = middle - p.Amplitude*math.Cos(w*s)
+		acceleration = -w * w * (position - middle)
+	default:
+		position = p.Start
+	}
+
+	// the bumpers stop the cart
+	if position < 0 {
+		return 0, 0
+	}
+	if position > p.TrackLength {
+		return p.TrackLength, 0
+	}
+	return position, acceleration
+}
+
+// GateLevel level of the base tracker gate (0 for A ... 3 for D) at t: 1
+// while the flag of the cart is in front of it
+func (c *Cart) GateLevel(gate int, t time.Time) int {
+	position, _ := c.State(t)
+	front := position + c.Profile.FlagLength/2
+	back := position - c.Profile.FlagLength/2
+	if back <= c.Profile.Gates[gate] && c.Profile.Gates[gate] <= front {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,183 @@
+// Package state is the state machine of the experiments of the platform.
+//
+// The platform starts in Init; it is configured, starts, runs and stops the
+// experiments, and may be initialised again or powered off, as declared by
+// the Experiment table. Every change of state goes through Machine.To,
+// which refuses the ones not in the table with an *Error, calls the hooks
+// and keeps the history. A Machine may be used from several goroutines.
+package state
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State of the platform
+type State int
+
+// states of the experiments
+const (
+	// Poweroff the platform is being switched off; it only goes back to
+	// Init if the system can't be halted
+	Poweroff State = -1
+	// Init initial state, without configuration
+	Init State = 0
+	// Configured the sensors are configured, the experiment may run
+	Configured State = 1
+	// Running the data are being acquired
+	Running State = 2
+	// Stopped the experiment ended, the data can be collected
+	Stopped State = 3
+	// Starting the data file and the readers of a run are being set up
+	Starting State = 4
+	// Stopping the readers are stopping and their data being written
+	Stopping State = 5
+)
+
+var names = map[State]string{
+	Poweroff:   "POWEROFF",
+	Init:       "INIT",
+	Configured: "CONFIGURED",
+	Running:    "RUNNING",
+	Stopped:    "STOPPED",
+	Starting:   "STARTING",
+	Stopping:   "STOPPING",
+}
+
+func (s State) String() string {
+	if name, ok := names[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Table the states that can follow each state
+type Table map[State][]State
+
+// Experiment the lifecycle of the experiments: a run is set up before
+// running, or stopped if it can't be; while running, the only way out is to
+// stop, flushing the data before being stopped; a failed poweroff leaves
+// the platform as initialised
+var Experiment = Table{
+	Poweroff:   {Init},
+	Init:       {Init, Configured, Poweroff},
+	Configured: {Init, Configured, Starting, Poweroff},
+	Starting:   {Running, Stopped},
+	Running:    {Stopping},
+	Stopping:   {Stopped},
+	Stopped:    {Init, Configured, Starting, Poweroff},
+}
+
+// Allowed tells if the table lets go from one state to the other
+func (t Table) Allowed(from, to State) bool {
+	for _, s := range t[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition a change of state
+type Transition struct {
+	From State
+	To   State
+	At   time.Time
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%s -> %s", t.From, t.To)
+}
+
+// Error a transition not in the table
+type Error struct {
+	From State
+	To   State
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("state: can't go from %s to %s", e.From, e.To)
+}
+
+// Hook called after each transition, outside the lock of the machine
+type Hook func(t Transition)
+
+// MaxHistory transitions kept by a machine, the older ones are forgotten
+const MaxHistory = 256
+
+// Machine the state of the platform, changed only through the transitions
+// of its table
+type Machine struct {
+	mutex   sync.RWMutex
+	table   Table
+	current State
+	hooks   []Hook
+	history []Transition
+}
+
+// NewMachine returns a machine in the initial state
+func NewMachine(table Table, initial State) *Machine {
+	return &Machine{table: table, current: initial}
+}
+
+// Current state
+func (m *Machine) Current() State {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.current
+}
+
+// Is tells if the machine is in the state s
+func (m *Machine) Is(s State) bool {
+	return m.Current() == s
+}
+
+// Can tells if the machine can go now to the state
+func (m *Machine) Can(to State) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.table.Allowed(m.current, to)
+}
+
+// To goes to the state, if the table allows it from the current one;
+// otherwise it returns an *Error and the state doesn't change
+func (m *Machine) To(to State) error {
+	m.mutex.Lock()
+	if !m.table.Allowed(m.current, to) {
+		err := &Error{m.current, to}
+		m.mutex.Unlock()
+		return err
+	}
+	t := Transition{m.current, to, time.Now()}
+	m.current = to
+	if len(m.history) == MaxHistory {
+		m.history = append(m.history[:0], m.history[1:]...)
+	}
+	m.history = append(m.history, t)
+	hooks := m.hooks
+	m.mutex.Unlock()
+
+	for _, hook := range hooks {
+		hook(t)
+	}
+	return nil
+}
+
+// OnTransition adds a hook, called after each transition
+func (m *Machine) OnTransition(hook Hook) {
+	m.mutex.Lock()
+	m.hooks = append(m.hooks[:len(m.hooks):len(m.hooks)], hook)
+	m.mutex.Unlock()
+}
+
+// History the last transitions, the oldest first
+func (m *Machine) History() []Transition {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]Transition(nil), m.history...)
+}
+
+func (m *Machine) String() string {
+	return m.Current().String()
+}
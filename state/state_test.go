@@ -0,0 +1,108 @@
+package state
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestExperimentTable(t *testing.T) {
+	all := []State{Poweroff, Init, Configured, Starting, Running, Stopping, Stopped}
+	allowed := map[Transition]bool{}
+	for _, tr := range []Transition{
+		{From: Init, To: Init}, {From: Init, To: Configured}, {From: Init, To: Poweroff},
+		{From: Configured, To: Init}, {From: Configured, To: Configured},
+		{From: Configured, To: Starting}, {From: Configured, To: Poweroff},
+		{From: Starting, To: Running}, {From: Starting, To: Stopped},
+		{From: Running, To: Stopping},
+		{From: Stopping, To: Stopped},
+		{From: Stopped, To: Init}, {From: Stopped, To: Configured},
+		{From: Stopped, To: Starting}, {From: Stopped, To: Poweroff},
+		{From: Poweroff, To: Init},
+	} {
+		allowed[tr] = true
+	}
+	for _, from := range all {
+		for _, to := range all {
+			expected := allowed[Transition{From: from, To: to}]
+			if Experiment.Allowed(from, to) != expected {
+				t.Errorf("%s -> %s allowed %v, expected %v", from, to, !expected, expected)
+			}
+		}
+	}
+}
+
+func TestMachine(t *testing.T) {
+	m := NewMachine(Experiment, Init)
+	var hooked []Transition
+	m.OnTransition(func(t Transition) { hooked = append(hooked, t) })
+
+	for _, s := range []State{Configured, Starting, Running, Stopping, Stopped} {
+		if err := m.To(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := m.To(Running)
+	if e, ok := err.(*Error); !ok || e.From != Stopped || e.To != Running {
+		t.Errorf("error %v, expected one from STOPPED to RUNNING", err)
+	}
+	if !m.Is(Stopped) {
+		t.Errorf("state %s after a refused transition, expected STOPPED", m)
+	}
+	if !m.Can(Starting) || m.Can(Stopping) {
+		t.Error("STOPPED can't start or can stop")
+	}
+
+	history := m.History()
+	if len(history) != 5 || len(hooked) != 5 {
+		t.Fatalf("%d transitions in the history and %d hooked, expected 5", len(history), len(hooked))
+	}
+	for i, tr := range history {
+		if tr != hooked[i] {
+			t.Errorf("transition %d %s in the history, %s hooked", i, tr, hooked[i])
+		}
+	}
+	if history[0].From != Init || history[4].To != Stopped {
+		t.Errorf("history %v", history)
+	}
+}
+
+func TestMachineStartsOnce(t *testing.T) {
+	m := NewMachine(Experiment, Configured)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	started := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.To(Starting) == nil {
+				mutex.Lock()
+				started++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if started != 1 {
+		t.Errorf("started %d times, expected once", started)
+	}
+}
+
+func TestMaxHistory(t *testing.T) {
+	m := NewMachine(Experiment, Init)
+	for i := 0; i < MaxHistory+10; i++ {
+		m.To(Init)
+	}
+	if n := len(m.History()); n != MaxHistory {
+		t.Errorf("%d transitions kept, expected %d", n, MaxHistory)
+	}
+}
+
+func TestString(t *testing.T) {
+	if s := Starting.String(); s != "STARTING" {
+		t.Errorf("%q, expected STARTING", s)
+	}
+	if s := State(42).String(); s != "State(42)" {
+		t.Errorf("%q, expected State(42)", s)
+	}
+}
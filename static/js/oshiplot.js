@@ -0,0 +1,593 @@
+/*
+ * oshiplot plots the records of the runs on canvas, without other libraries,
+ * so the platform works without internet.
+ *
+ * A Plot draws some fields of the records versus the local time of the run,
+ * in us, with the events of the trackers as vertical lines. All the plots of
+ * a page share a View: the time window shown, zoomed with the wheel of the
+ * mouse and dragged when it is not following the run, or where a range of
+ * time is selected.
+ */
+var oshiplot = (function () {
+   "use strict";
+
+   var COLORS = ["#d9534f", "#5cb85c", "#337ab7", "#f0ad4e", "#5bc0de", "#777777"];
+   var MARKER = "#8a6d3b";
+   var MARGIN = {left: 60, right: 10, top: 18, bottom: 22};
+   // window of time shown, in us
+   var MIN_WIDTH = 0.2e6, MAX_WIDTH = 600e6;
+
+   // View the window of time of the plots, from start to end in us; live
+   // views follow the last record
+   function View(width) {
+      this.width = width;
+      this.end = width;
+      this.live = true;
+      // dragging on the plots moves them, "pan", or selects a range, "select"
+      this.mode = "pan";
+      // selected range, {start, end} in us, or null
+      this.selection = null;
+      this.plots = [];
+      this.onchange = null;
+      this.onselect = null;
+   }
+
+   View.prototype.start = function () {
+      return this.end - this.width;
+   };
+
+   // zoom by factor around the time t, the end if live
+   View.prototype.zoom = function (factor, t) {
+      var width = Math.min(MAX_WIDTH, Math.max(MIN_WIDTH, this.width * factor));
+      if (this.live || t === undefined) {
+         this.width = width;
+      } else {
+         // keep t at the same place of the window
+         var right = (this.end - t) / this.width;
+         this.end = t + right * width;
+         this.width = width;
+      }
+      this.changed();
+   };
+
+   // show from start to end
+   View.prototype.show = function (start, end) {
+      if (end - start < MIN_WIDTH) {
+         end = start + MIN_WIDTH;
+      }
+      this.width = end - start;
+      this.end = end;
+      this.changed();
+   };
+
+   // follow the time t of the last record, if live
+   View.prototype.follow = function (t) {
+      if (this.live && t > this.end) {
+         this.end = t;
+         this.changed();
+      }
+   };
+
+   // select the range from start to end, or nothing if start is null
+   View.prototype.select = function (start, end) {
+      this.selection = start === null ? null : {start: Math.min(start, end), end: Math.max(start, end)};
+      for (var i = 0; i < this.plots.length; i++) {
+         this.plots[i].dirty = true;
+      }
+      if (this.onselect) {
+         this.onselect(this.selection);
+      }
+   };
+
+   View.prototype.changed = function () {
+      for (var i = 0; i < this.plots.length; i++) {
+         this.plots[i].dirty = true;
+      }
+      if (this.onchange) {
+         this.onchange(this);
+      }
+   };
+
+   // Plot the fields of the records on the canvas; markers are shared by the
+   // plots, {time, label}
+   function Plot(canvas, fields, view, markers) {
+      this.canvas = canvas;
+      this.fields = fields;
+      this.view = view;
+      this.markers = markers;
+      this.series = {};
+      this.dirty = true;
+      for (var i = 0; i < fields.length; i++) {
+         this.series[fields[i]] = [];
+      }
+      view.plots.push(this);
+      this.listen();
+   }
+
+   // add the values of a record at the time t
+   Plot.prototype.add = function (t, values) {
+      for (var i = 0; i < this.fields.length; i++) {
+         var v = values[this.fields[i]];
+         if (v !== undefined && v !== null) {
+            this.series[this.fields[i]].push([t, v]);
+            this.dirty = true;
+         }
+      }
+   };
+
+   // forget the points older than t
+   Plot.prototype.forget = function (t) {
+      for (var name in this.series) {
+         var points = this.series[name], n = 0;
+         while (n < points.length && points[n][0] < t) {
+            n++;
+         }
+         if (n > 0) {
+            points.splice(0, n);
+         }
+      }
+   };
+
+   Plot.prototype.clear = function () {
+      for (var name in this.series) {
+         this.series[name] = [];
+      }
+      this.dirty = true;
+   };
+
+   // first and last times of the points
+   Plot.prototype.extent = function () {
+      var first = Infinity, last = -Infinity;
+      for (var name in this.series) {
+         var points = this.series[name];
+         if (points.length > 0) {
+            first = Math.min(first, points[0][0]);
+            last = Math.max(last, points[points.length - 1][0]);
+         }
+      }
+      return {first: first, last: last};
+   };
+
+   // time of the x coordinate of the canvas
+   Plot.prototype.time = function (x) {
+      var w = this.canvas.clientWidth - MARGIN.left - MARGIN.right;
+      return this.view.start() + (x - MARGIN.left) / w * this.view.width;
+   };
+
+   Plot.prototype.draw = function () {
+      var canvas = this.canvas, ratio = window.devicePixelRatio || 1;
+      var width = canvas.clientWidth, height = canvas.clientHeight;
+      if (canvas.width !== Math.round(width * ratio) || canvas.height !== Math.round(height * ratio)) {
+         canvas.width = Math.round(width * ratio);
+         canvas.height = Math.round(height * ratio);
+      }
+      var ctx = canvas.getContext("2d");
+      ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+      ctx.clearRect(0, 0, width, height);
+      ctx.font = "11px sans-serif";
+
+      var start = this.view.start(), end = this.view.end;
+      var w = width - MARGIN.left - MARGIN.right, h = height - MARGIN.top - MARGIN.bottom;
+      var x = function (t) {
+         return MARGIN.left + (t - start) / (end - start) * w;
+      };
+
+      // range of the values shown
+      var min = Infinity, max = -Infinity, name, i, points;
+      for (name in this.series) {
+         points = this.series[name];
+         for (i = first(points, start); i < points.length && points[i][0] <= end; i++) {
+            min = Math.min(min, points[i][1]);
+            max = Math.max(max, points[i][1]);
+         }
+      }
+      if (min === Infinity) {
+         min = -1;
+         max = 1;
+      } else if (max - min < 1e-9) {
+         min -= 1;
+         max += 1;
+      } else {
+         var pad = (max - min) * 0.05;
+         min -= pad;
+         max += pad;
+      }
+      var y = function (v) {
+         return MARGIN.top + (max - v) / (max - min) * h;
+      };
+
+      // selection
+      var selection = this.view.selection;
+      if (selection) {
+         ctx.fillStyle = "rgba(51, 122, 183, 0.15)";
+         var x0 = Math.max(MARGIN.left, x(selection.start)), x1 = Math.min(MARGIN.left + w, x(selection.end));
+         if (x1 > x0) {
+            ctx.fillRect(x0, MARGIN.top, x1 - x0, h);
+         }
+      }
+
+      // axes and grid
+      ctx.strokeStyle = "#dddddd";
+      ctx.fillStyle = "#333333";
+      ctx.lineWidth = 1;
+      ctx.textAlign = "right";
+      ctx.textBaseline = "middle";
+      var ticks = niceTicks(min, max, 5), tick;
+      for (i = 0; i < ticks.length; i++) {
+         tick = y(ticks[i]);
+         line(ctx, MARGIN.left, tick, MARGIN.left + w, tick);
+         ctx.fillText(label(ticks[i]), MARGIN.left - 4, tick);
+      }
+      ctx.textAlign = "center";
+      ctx.textBaseline = "top";
+      ticks = niceTicks(start / 1e6, end / 1e6, Math.max(2, Math.floor(w / 90)));
+      for (i = 0; i < ticks.length; i++) {
+         tick = x(ticks[i] * 1e6);
+         line(ctx, tick, MARGIN.top, tick, MARGIN.top + h);
+         ctx.fillText(label(ticks[i]) + " s", tick, MARGIN.top + h + 4);
+      }
+      ctx.strokeStyle = "#999999";
+      ctx.strokeRect(MARGIN.left, MARGIN.top, w, h);
+
+      ctx.save();
+      ctx.beginPath();
+      ctx.rect(MARGIN.left, MARGIN.top, w, h);
+      ctx.clip();
+
+      // the events of the trackers
+      ctx.strokeStyle = MARKER;
+      ctx.fillStyle = MARKER;
+      ctx.textAlign = "left";
+      ctx.setLineDash([4, 3]);
+      for (i = 0; i < this.markers.length; i++) {
+         var m = this.markers[i];
+         if (m.time >= start && m.time <= end) {
+            tick = x(m.time);
+            line(ctx, tick, MARGIN.top, tick, MARGIN.top + h);
+            ctx.fillText(m.label, tick + 2, MARGIN.top + 2);
+         }
+      }
+      ctx.setLineDash([]);
+
+      // the values, at most a point by pixel and field
+      var n = 0;
+      for (name in this.series) {
+         points = this.series[name];
+         ctx.strokeStyle = COLORS[n % COLORS.length];
+         ctx.lineWidth = 1.5;
+         ctx.beginPath();
+         var lastX = -Infinity, begun = false;
+         for (i = Math.max(0, first(points, start) - 1); i < points.length; i++) {
+            var px = x(points[i][0]);
+            if (px - lastX >= 0.5 || i === points.length - 1) {
+               if (begun) {
+                  ctx.lineTo(px, y(points[i][1]));
+               } else {
+                  ctx.moveTo(px, y(points[i][1]));
+                  begun = true;
+               }
+               lastX = px;
+            }
+            if (points[i][0] > end) {
+               break;
+            }
+         }
+         ctx.stroke();
+         n++;
+      }
+      ctx.restore();
+
+      // legend
+      ctx.textAlign = "left";
+      ctx.textBaseline = "top";
+      var lx = MARGIN.left;
+      n = 0;
+      for (name in this.series) {
+         ctx.fillStyle = COLORS[n % COLORS.length];
+         ctx.fillRect(lx, 4, 10, 10);
+         ctx.fillStyle = "#333333";
+         ctx.fillText(name, lx + 14, 3);
+         lx += ctx.measureText(name).width + 30;
+         n++;
+      }
+      this.dirty = false;
+   };
+
+   // the wheel zooms, and dragging moves the window if it isn't live, or
+   // selects a range; with the mouse, the pen or the finger
+   Plot.prototype.listen = function () {
+      var plot = this, canvas = this.canvas, dragging = null;
+      // the page still scrolls vertically on the tablets
+      canvas.style.touchAction = "pan-y";
+      var time = function (e) {
+         return plot.time(e.clientX - canvas.getBoundingClientRect().left);
+      };
+      canvas.addEventListener("wheel", function (e) {
+         e.preventDefault();
+         plot.view.zoom(e.deltaY > 0 ? 1.25 : 0.8, time(e));
+      });
+      canvas.addEventListener("pointerdown", function (e) {
+         if (plot.view.mode === "select") {
+            dragging = {select: time(e)};
+            plot.view.select(dragging.select, dragging.select);
+         } else if (!plot.view.live) {
+            dragging = {x: e.clientX, end: plot.view.end};
+         } else {
+            return;
+         }
+         if (canvas.setPointerCapture) {
+            canvas.setPointerCapture(e.pointerId);
+         }
+      });
+      canvas.addEventListener("pointermove", function (e) {
+         if (!dragging) {
+            return;
+         }
+         if (dragging.select !== undefined) {
+            plot.view.select(dragging.select, time(e));
+            return;
+         }
+         var w = canvas.clientWidth - MARGIN.left - MARGIN.right;
+         plot.view.end = dragging.end - (e.clientX - dragging.x) / w * plot.view.width;
+         plot.view.changed();
+      });
+      var stop = function () {
+         dragging = null;
+      };
+      canvas.addEventListener("pointerup", stop);
+      canvas.addEventListener("pointercancel", stop);
+   };
+
+   // index of the first point at t or later
+   function first(points, t) {
+      var lo = 0, hi = points.length;
+      while (lo < hi) {
+         var mid = (lo + hi) >> 1;
+         if (points[mid][0] < t) {
+            lo = mid + 1;
+         } else {
+            hi = mid;
+         }
+      }
+      return lo;
+   }
+
+   function line(ctx, x0, y0, x1, y1) {
+      ctx.beginPath();
+      ctx.moveTo(Math.round(x0) + 0.5, Math.round(y0) + 0.5);
+      ctx.lineTo(Math.round(x1) + 0.5, Math.round(y1) + 0.5);
+      ctx.stroke();
+   }
+
+   // about n round values between min and max
+   function niceTicks(min, max, n) {
+      var step = Math.pow(10, Math.floor(Math.log(Math.max((max - min) / n, 1e-12)) / Math.LN10));
+      var err = (max - min) / n / step;
+      if (err >= 5) {
+         step *= 5;
+      } else if (err >= 2) {
+         step *= 2;
+      }
+      var ticks = [];
+      for (var t = Math.ceil(min / step) * step; t <= max; t += step) {
+         ticks.push(Math.abs(t) < step / 1e6 ? 0 : t);
+      }
+      return ticks;
+   }
+
+   function label(v) {
+      return Math.abs(v) >= 1e4 || (Math.abs(v) < 1e-3 && v !== 0) ? v.toExponential(1) : String(+v.toPrecision(4));
+   }
+
+   // the label of the marker of an event: the tracker, A to D, or M for the
+   // records of the arduino with its sync
+   function markerLabel(record) {
+      return record.source === "Ard" ? "M" : record.source;
+   }
+
+   // redraws the plots of the view when they change
+   function animate(view) {
+      var frame = function () {
+         for (var i = 0; i < view.plots.length; i++) {
+            if (view.plots[i].dirty) {
+               view.plots[i].draw();
+            }
+         }
+         window.requestAnimationFrame(frame);
+      };
+      window.addEventListener("resize", function () {
+         view.changed();
+      });
+      window.requestAnimationFrame(frame);
+   }
+
+   // plots of the canvas.plot of the container
+   function plots(container, view, markers) {
+      var list = [], canvases = container.querySelectorAll("canvas.plot");
+      for (var i = 0; i < canvases.length; i++) {
+         canvases[i].style.width = "100%";
+         canvases[i].style.height = canvases[i].getAttribute("height") + "px";
+         list.push(new Plot(canvases[i], canvases[i].getAttribute("data-fields").split(","), view, markers));
+      }
+      return list;
+   }
+
+   // live plots the records streamed by the server in the canvas.plot of the
+   // container, with the texts in its data attributes
+   function live(container) {
+      var view = new View(10e6), markers = [], list = plots(container, view, markers);
+      var text = function (name) {
+         return container.getAttribute("data-" + name);
+      };
+      var status = document.getElementById("plotStatus");
+      var windowText = document.getElementById("plotWindow");
+      var dropped = document.getElementById("plotDropped");
+      var pause = document.getElementById("plotPause");
+      var state = "waiting", last = 0, received = 0;
+
+      var show = function () {
+         status.textContent = view.live || state !== "running" ? text(state) : text("paused");
+         windowText.textContent = "(" + label(view.width / 1e6) + " s)";
+         pause.lastElementChild.textContent = view.live ? pause.getAttribute("data-pause") : pause.getAttribute("data-resume");
+         pause.firstElementChild.className = "glyphicon glyphicon-" + (view.live ? "pause" : "play");
+      };
+      view.onchange = function () {
+         windowText.textContent = "(" + label(view.width / 1e6) + " s)";
+      };
+
+      pause.addEventListener("click", function () {
+         view.live = !view.live;
+         if (view.live) {
+            view.end = Math.max(last, view.width);
+            view.changed();
+         }
+         show();
+      });
+      document.getElementById("plotZoomIn").addEventListener("click", function () {
+         view.zoom(0.5);
+      });
+      document.getElementById("plotZoomOut").addEventListener("click", function () {
+         view.zoom(2);
+      });
+
+      var source = new EventSource(text("live"));
+      source.addEventListener("run", function () {
+         for (var i = 0; i < list.length; i++) {
+            list[i].clear();
+         }
+         markers.length = 0;
+         last = 0;
+         view.end = view.width;
+         view.live = true;
+         view.changed();
+         state = "running";
+         show();
+      });
+      source.addEventListener("record", function (e) {
+         var record = JSON.parse(e.data);
+         if (record.event && (record.source !== "Ard" || record.values.sync === 1)) {
+            markers.push({time: record.time, label: markerLabel(record)});
+            view.changed();
+         }
+         // keep what can be shown
+         var old = ++received % 1000 === 0 ? record.time - MAX_WIDTH : -Infinity;
+         for (var i = 0; i < list.length; i++) {
+            list[i].add(record.time, record.values);
+            list[i].forget(old);
+         }
+         last = Math.max(last, record.time);
+         view.follow(last);
+      });
+      source.addEventListener("stop", function () {
+         state = "stopped";
+         show();
+      });
+      source.addEventListener("stats", function (e) {
+         var stats = JSON.parse(e.data);
+         dropped.textContent = stats.dropped > 0 ? stats.dropped + " " + text("dropped") : "";
+      });
+      show();
+      animate(view);
+   }
+
+   // viewer plots the records of a stored run, the JSON Lines of the
+   // data-records of the container, in its canvas.plot; the range selected is
+   // in the inputs #rangeFrom and #rangeTo, in s, and in the links
+   // a.range-export to export it
+   function viewer(container) {
+      var view = new View(10e6), markers = [], list = plots(container, view, markers);
+      view.live = false;
+      var from = document.getElementById("rangeFrom"), to = document.getElementById("rangeTo");
+      var links = container.querySelectorAll("a.range-export");
+      var extent = {first: 0, last: 10e6};
+
+      var seconds = function (t) {
+         return String(Math.round(t) / 1e6);
+      };
+      view.onselect = function (selection) {
+         from.value = selection ? seconds(Math.max(0, selection.start)) : "";
+         to.value = selection ? seconds(Math.max(0, selection.end)) : "";
+         for (var i = 0; i < links.length; i++) {
+            var href = links[i].getAttribute("data-href");
+            links[i].href = selection ? href + "?from=" + from.value + "&to=" + to.value : href;
+         }
+      };
+      var typed = function () {
+         var start = from.value === "" ? extent.first : parseFloat(from.value) * 1e6;
+         var end = to.value === "" ? extent.last : parseFloat(to.value) * 1e6;
+         if (!isNaN(start) && !isNaN(end)) {
+            view.select(start, end);
+         }
+      };
+      from.addEventListener("change", typed);
+      to.addEventListener("change", typed);
+      document.getElementById("rangeClear").addEventListener("click", function () {
+         view.select(null);
+      });
+
+      var all = function () {
+         view.show(extent.first, extent.last);
+      };
+      document.getElementById("plotAll").addEventListener("click", all);
+      document.getElementById("plotZoomIn").addEventListener("click", function () {
+         view.zoom(0.5, view.end - view.width / 2);
+      });
+      document.getElementById("plotZoomOut").addEventListener("click", function () {
+         view.zoom(2, view.end - view.width / 2);
+      });
+      document.getElementById("plotZoomSelection").addEventListener("click", function () {
+         if (view.selection) {
+            view.show(view.selection.start, view.selection.end);
+         }
+      });
+      var modes = container.querySelectorAll("input[name=plotMode]");
+      for (var i = 0; i < modes.length; i++) {
+         modes[i].addEventListener("change", function (e) {
+            view.mode = e.target.value;
+         });
+      }
+
+      var request = new XMLHttpRequest();
+      request.open("GET", container.getAttribute("data-records"));
+      request.onload = function () {
+         if (request.status !== 200) {
+            return;
+         }
+         var lines = request.responseText.split("\n");
+         for (var i = 0; i < lines.length; i++) {
+            if (lines[i] === "") {
+               continue;
+            }
+            var record = JSON.parse(lines[i]);
+            if (record.source !== "Ard" || record.sync === 1) {
+               markers.push({time: record.localTime, label: markerLabel(record)});
+            }
+            for (var j = 0; j < list.length; j++) {
+               list[j].add(record.localTime, record);
+            }
+         }
+         var first = Infinity, last = -Infinity;
+         for (i = 0; i < list.length; i++) {
+            var e = list[i].extent();
+            first = Math.min(first, e.first);
+            last = Math.max(last, e.last);
+         }
+         if (isFinite(first)) {
+            extent = {first: first, last: last};
+         }
+         all();
+      };
+      request.send();
+      animate(view);
+   }
+
+   return {
+      View: View,
+      Plot: Plot,
+      plots: plots,
+      animate: animate,
+      markerLabel: markerLabel,
+      live: live,
+      viewer: viewer
+   };
+})();
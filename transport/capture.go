@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CaptureMark first line of a capture recorded by Record, followed by the
+// framing of its frames in JSON
+const CaptureMark = "#OSHIWASP-CAPTURE"
+
+// Framing how the firmware sends the frames, as asked by the server
+type Framing struct {
+	// Escaped the bytes between the marks are escaped
+	Escaped bool `json:"escaped"`
+	// Checksum the frames have a checksum
+	Checksum bool `json:"checksum"`
+}
+
+// Capture a transport replaying a capture, whose frames were sent with
+// their own framing
+type Capture interface {
+	Transport
+	// Framing of the frames of the capture; the one of the firmware of the
+	// older versions, raw and unchecked, if it wasn't recorded by Record
+	Framing() Framing
+}
+
+// recorder copies the bytes read from the transport to the capture
+type recorder struct {
+	Transport
+	capture io.WriteCloser
+}
+
+// Record returns t writing the bytes read from it to capture, after a line
+// with their framing, so that File replays them as they were sent
+func Record(t Transport, capture io.WriteCloser, framing Framing) (Transport, error) {
+	line, err := json.Marshal(framing)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(capture, "%s %s\n", CaptureMark, line); err != nil {
+		return nil, err
+	}
+	return &recorder{t, capture}, nil
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.Transport.Read(p)
+	if n > 0 {
+		if _, werr := r.capture.Write(p[:n]); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+func (r *recorder) Close() error {
+	err := r.Transport.Close()
+	if cerr := r.capture.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readFraming reads the line of the framing of a capture, if it has one
+func readFraming(r *bufio.Reader) (Framing, error) {
+	var framing Framing
+	mark, err := r.Peek(len(CaptureMark))
+	if err != nil || string(mark) != CaptureMark {
+		// shorter than the mark, or not recorded by Record: read it raw
+		return framing, nil
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return framing, fmt.Errorf("transport: capture without frames: %v", err)
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, CaptureMark))
+	if err := json.Unmarshal([]byte(line), &framing); err != nil {
+		return framing, fmt.Errorf("transport: bad framing of the capture: %v", err)
+	}
+	return framing, nil
+}
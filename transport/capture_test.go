@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeArduino a transport sending frames, and its commands
+type fakeArduino struct {
+	frames []byte
+}
+
+func (a *fakeArduino) Read(p []byte) (int, error) {
+	if len(a.frames) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, a.frames)
+	a.frames = a.frames[n:]
+	return n, nil
+}
+
+func (a *fakeArduino) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (a *fakeArduino) Close() error {
+	return nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "capture")
+	capture, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := "#frame$#other$"
+	recorded, err := Record(&fakeArduino{[]byte(frames)}, capture, Framing{Escaped: true, Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := io.ReadAll(recorded)
+	if err != nil || string(read) != frames {
+		t.Fatalf("read %q, %v through the recorder", read, err)
+	}
+	if err := recorded.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := Open(Config{Kind: File, File: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	if framing := replay.(Capture).Framing(); !framing.Escaped || !framing.Checksum {
+		t.Errorf("framing %+v of the capture, expected escaped with checksum", framing)
+	}
+	if read, err = io.ReadAll(replay); err != nil || string(read) != frames {
+		t.Errorf("replayed %q, %v; expected only the frames %q", read, err, frames)
+	}
+}
+
+func TestReplayOldCapture(t *testing.T) {
+	// recorded before the captures had their framing
+	name := filepath.Join(t.TempDir(), "capture")
+	frames := "#frame$"
+	if err := os.WriteFile(name, []byte(frames), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := Open(Config{Kind: File, File: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	if framing := replay.(Capture).Framing(); framing != (Framing{}) {
+		t.Errorf("framing %+v of an old capture, expected raw and unchecked", framing)
+	}
+	if read, err := io.ReadAll(replay); err != nil || string(read) != frames {
+		t.Errorf("replayed %q, %v; expected %q", read, err, frames)
+	}
+}
@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrInterrupted returned by the reads of an Interruptible after Interrupt
+var ErrInterrupted = errors.New("transport: read interrupted")
+
+// chunkSize bytes read at once from the transport
+const chunkSize = 512
+
+// chunks read ahead, the reading stops when they are not consumed
+const bufferedChunks = 64
+
+type chunk struct {
+	data []byte
+	err  error
+}
+
+// Interruptible a transport whose blocked reads can be interrupted. A
+// goroutine reads the transport for as long as it is open; the reads of
+// the Interruptible take what it read, or return ErrInterrupted once
+// Interrupt is called. The serial ports can't be unblocked otherwise when
+// the Arduino stops sending.
+//
+// A transport that can be read again from the beginning, as a capture, is
+// rewound by Resume once it was read to the end, so each run replays it.
+type Interruptible struct {
+	Transport
+
+	chunks  chan chunk
+	pending []byte
+	err     error
+
+	mutex       sync.Mutex
+	interrupt   chan struct{}
+	interrupted bool
+
+	// done closed by Close, so the pump doesn't block on chunks no one reads
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewInterruptible starts reading the transport
+func NewInterruptible(t Transport) *Interruptible {
+	i := &Interruptible{
+		Transport: t,
+		chunks:    make(chan chunk, bufferedChunks),
+		interrupt: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go i.pump(i.chunks)
+	return i
+}
+
+// Rewinder a transport that can be read again from the beginning
+type Rewinder interface {
+	Rewind() error
+}
+
+func (i *Interruptible) pump(chunks chan<- chunk) {
+	defer close(chunks)
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := i.Transport.Read(buf)
+		if n > 0 && !i.send(chunks, chunk{data: buf[:n]}) {
+			return
+		}
+		if err != nil {
+			i.send(chunks, chunk{err: err})
+			return
+		}
+	}
+}
+
+// send the chunk to the reads, false if the Interruptible is closed
+func (i *Interruptible) send(chunks chan<- chunk, c chunk) bool {
+	select {
+	case chunks <- c:
+		return true
+	case <-i.done:
+		return false
+	}
+}
+
+// Close the transport and stop the reading goroutine
+func (i *Interruptible) Close() error {
+	i.closeOnce.Do(func() { close(i.done) })
+	return i.Transport.Close()
+}
+
+// Read what was read from the transport, blocking till there is something
+// or the read is interrupted. Only one goroutine may read.
+func (i *Interruptible) Read(p []byte) (int, error) {
+	if len(i.pending) == 0 {
+		if i.err != nil {
+			return 0, i.err
+		}
+		i.mutex.Lock()
+		interrupt := i.interrupt
+		i.mutex.Unlock()
+		select {
+		case c, ok := <-i.chunks:
+			if !ok {
+				if i.err == nil {
+					// closed before the transport failed
+					i.err = io.ErrClosedPipe
+				}
+				return 0, i.err
+			}
+			if c.err != nil {
+				i.err = c.err
+				return 0, c.err
+			}
+			i.pending = c.data
+		case <-interrupt:
+			return 0, ErrInterrupted
+		}
+	}
+	n := copy(p, i.pending)
+	i.pending = i.pending[n:]
+	return n, nil
+}
+
+// Interrupt makes the blocked read, and the following ones, return
+// ErrInterrupted until Resume
+func (i *Interruptible) Interrupt() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if !i.interrupted {
+		i.interrupted = true
+		close(i.interrupt)
+	}
+}
+
+// Resume lets the reads go on, rewinding the transport if it was read to
+// the end and is a Rewinder; it must not be called while reading
+func (i *Interruptible) Resume() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.interrupted {
+		i.interrupted = false
+		i.interrupt = make(chan struct{})
+	}
+	rewinder, ok := i.Transport.(Rewinder)
+	if i.err != io.EOF || !ok {
+		return nil
+	}
+	// the pump ended with the EOF: read it again with a new one
+	if err := rewinder.Rewind(); err != nil {
+		return err
+	}
+	i.err = nil
+	i.pending = nil
+	i.chunks = make(chan chunk, bufferedChunks)
+	go i.pump(i.chunks)
+	return nil
+}
+
+// Discard drops what was read and not consumed yet, as the records sent
+// between two runs; it must not be called while reading
+func (i *Interruptible) Discard() {
+	i.pending = nil
+	for {
+		select {
+		case c, ok := <-i.chunks:
+			if !ok {
+				return
+			}
+			if c.err != nil {
+				i.err = c.err
+				return
+			}
+		default:
+			return
+		}
+	}
+}
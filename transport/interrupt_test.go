@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// endless a transport always with data to read, as an Arduino sending
+type endless struct{}
+
+func (e *endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = '#'
+	}
+	return len(p), nil
+}
+
+func (e *endless) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (e *endless) Close() error {
+	return nil
+}
+
+func TestInterruptibleInterrupt(t *testing.T) {
+	r, w := io.Pipe()
+	i := NewInterruptible(struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{r, io.Discard, r})
+	defer i.Close()
+
+	go w.Write([]byte("abc"))
+	buf := make([]byte, 8)
+	if n, err := i.Read(buf); err != nil || string(buf[:n]) != "abc" {
+		t.Fatalf("read %q, %v", buf[:n], err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := i.Read(buf)
+		done <- err
+	}()
+	i.Interrupt()
+	select {
+	case err := <-done:
+		if err != ErrInterrupted {
+			t.Errorf("error %v, expected %v", err, ErrInterrupted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read not interrupted")
+	}
+
+	i.Resume()
+	go w.Write([]byte("d"))
+	if n, err := i.Read(buf); err != nil || string(buf[:n]) != "d" {
+		t.Errorf("read %q, %v after resuming", buf[:n], err)
+	}
+}
+
+func TestInterruptibleClose(t *testing.T) {
+	// nothing reads the chunks, so the pump fills them and blocks
+	i := NewInterruptible(&endless{})
+	time.Sleep(10 * time.Millisecond)
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Close(); err != nil {
+		t.Errorf("closed twice: %v", err)
+	}
+
+	// the pump ends, closing the chunks after the ones read ahead
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-i.chunks:
+			if !ok {
+				if _, err := i.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+					t.Errorf("error %v after closing, expected %v", err, io.ErrClosedPipe)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("the pump didn't end")
+		}
+	}
+}
+
+func TestInterruptibleReplaysTwice(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "capture")
+	frames := "#frame$#other$"
+	if err := os.WriteFile(name, []byte(CaptureMark+` {"escaped":true}`+"\n"+frames), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := Open(Config{Kind: File, File: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := NewInterruptible(replay)
+	defer i.Close()
+
+	// two runs, each till the end of the capture and stopped
+	for run := 1; run <= 2; run++ {
+		if err := i.Resume(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		read, err := io.ReadAll(i)
+		if err != nil || string(read) != frames {
+			t.Errorf("run %d replayed %q, %v; expected %q", run, read, err, frames)
+		}
+		i.Interrupt()
+	}
+}
@@ -0,0 +1,224 @@
+// Package transport opens the channel with the Arduino of the sensor
+// platform, whatever it is: the Bluetooth serial device, a wired USB serial
+// port, a TCP socket, a UDP listener or a file with a recorded capture.
+//
+// All of them give the same stream of frames, so the acquisition reads
+// from a Transport without knowing which one is in use. The ESP32 is the
+// exception: it broadcasts text records over UDP, and its transport ends
+// every datagram with a new line for the frame.TextDecoder.
+//
+// A capture recorded by Record keeps the framing of its frames, so File
+// replays it as it was sent, whatever the framing asked to the firmware now.
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/tarm/serial"
+)
+
+// kinds of transport
+const (
+	// BT Bluetooth serial device
+	BT = "bt"
+	// USB wired serial port
+	USB = "usb"
+	// TCP client socket
+	TCP = "tcp"
+	// UDP listener
+	UDP = "udp"
+	// File recorded capture
+	File = "file"
+	// ESP32 UDP listener of the text records broadcast by the ESP32
+	ESP32 = "esp32"
+)
+
+// defaults of the serial transports
+const (
+	// BTDevice name of the BT device
+	BTDevice = "/dev/rfcomm1"
+	// BTBauds bauds of the BT serial channel
+	BTBauds = 9600
+	// USBDevice name of the USB serial port
+	USBDevice = "/dev/ttyACM0"
+	// USBBauds bauds of the USB serial port
+	USBBauds = 115200
+	// ESP32Address address where the ESP32 broadcasts
+	ESP32Address = ":2255"
+)
+
+// Transport channel with the Arduino. Commands are written to it and
+// frames are read from it.
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// Config selects and sets up a transport
+type Config struct {
+	// Kind BT, USB, TCP, UDP or File
+	Kind string
+	// Device serial device, for BT and USB; the default of the kind if empty
+	Device string
+	// Baud speed of the serial device; the default of the kind if 0
+	Baud int
+	// Address host:port to connect to with TCP, or [host]:port to listen
+	// on with UDP and ESP32; ESP32Address if empty with ESP32
+	Address string
+	// File path of the capture
+	File string
+}
+
+func (cfg Config) String() string {
+	switch cfg.Kind {
+	case BT, USB:
+		return fmt.Sprintf("%s %s at %d bauds", cfg.Kind, cfg.Device, cfg.Baud)
+	case TCP, UDP, ESP32:
+		return fmt.Sprintf("%s %s", cfg.Kind, cfg.Address)
+	case File:
+		return fmt.Sprintf("%s %s", cfg.Kind, cfg.File)
+	}
+	return cfg.Kind
+}
+
+// Open opens the transport selected by cfg
+func Open(cfg Config) (Transport, error) {
+	switch cfg.Kind {
+	case BT:
+		return openSerial(cfg.Device, BTDevice, cfg.Baud, BTBauds)
+	case USB:
+		return openSerial(cfg.Device, USBDevice, cfg.Baud, USBBauds)
+	case TCP:
+		return net.Dial("tcp", cfg.Address)
+	case UDP:
+		return listenUDP(cfg.Address, false)
+	case ESP32:
+		address := cfg.Address
+		if address == "" {
+			address = ESP32Address
+		}
+		return listenUDP(address, true)
+	case File:
+		return openFile(cfg.File)
+	}
+	return nil, fmt.Errorf("transport: unknown kind %q", cfg.Kind)
+}
+
+func openSerial(device, defaultDevice string, baud, defaultBaud int) (Transport, error) {
+	if device == "" {
+		device = defaultDevice
+	}
+	if baud == 0 {
+		baud = defaultBaud
+	}
+	return serial.OpenPort(&serial.Config{Name: device, Baud: baud})
+}
+
+// udpTransport reads the datagrams received as a stream of bytes, and
+// sends the commands to the last peer heard
+type udpTransport struct {
+	conn    *net.UDPConn
+	pending []byte
+	buffer  []byte
+	// lines ends every datagram with a new line, if it hasn't one
+	lines bool
+
+	// the peer is set by the reader and used by the writers
+	mutex sync.Mutex
+	peer  *net.UDPAddr
+}
+
+func listenUDP(address string, lines bool) (Transport, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTransport{conn: conn, buffer: make([]byte, 64*1024+1), lines: lines}, nil
+}
+
+func (t *udpTransport) Read(p []byte) (int, error) {
+	// a datagram bigger than p is kept for the next calls
+	for len(t.pending) == 0 {
+		n, peer, err := t.conn.ReadFromUDP(t.buffer[:len(t.buffer)-1])
+		if err != nil {
+			return 0, err
+		}
+		if t.lines && n > 0 && t.buffer[n-1] != '\n' {
+			t.buffer[n] = '\n'
+			n++
+		}
+		t.mutex.Lock()
+		t.peer = peer
+		t.mutex.Unlock()
+		t.pending = t.buffer[:n]
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+func (t *udpTransport) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	peer := t.peer
+	t.mutex.Unlock()
+	// nobody to talk to yet: the command is lost, as on a broadcast
+	if peer == nil {
+		return len(p), nil
+	}
+	return t.conn.WriteToUDP(p, peer)
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// fileTransport reads a capture; the commands are ignored
+type fileTransport struct {
+	*os.File
+	reader  *bufio.Reader
+	framing Framing
+}
+
+func openFile(name string) (Transport, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	t := &fileTransport{File: f, reader: bufio.NewReader(f)}
+	if t.framing, err = readFraming(t.reader); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *fileTransport) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *fileTransport) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Framing of the frames of the capture
+func (t *fileTransport) Framing() Framing {
+	return t.framing
+}
+
+// Rewind goes back to the first frame of the capture
+func (t *fileTransport) Rewind() error {
+	if _, err := t.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	t.reader.Reset(t.File)
+	_, err := readFraming(t.reader)
+	return err
+}
@@ -0,0 +1,83 @@
+// Package view prepares a stored run for the viewer, /view/cart/2/: the plots
+// of its values, the events of its trackers and the kinematics of the
+// photogates, all read from the segments of its data file.
+package view
+
+import (
+	"strings"
+
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/export"
+	"github.com/ecalman/OSHIWASP/kinematics"
+)
+
+// Plot a plot of the viewer, with the fields of the same unit
+type Plot struct {
+	// Title the fields and their unit: "accX, accY, accZ (g)"
+	Title string
+	// Fields the names of the fields in the records, separated by commas
+	Fields string
+}
+
+// Run what the viewer shows of a run
+type Run struct {
+	Plots  []Plot
+	Events []export.Event
+	// Kinematics nil if the run has no setup of the photogates
+	Kinematics *kinematics.Result
+}
+
+// New the view of the segments of a run
+func New(segments []datafile.Segment) Run {
+	return Run{
+		Plots:      Plots(segments),
+		Events:     export.TrackerEvents(segments),
+		Kinematics: Kinematics(segments),
+	}
+}
+
+// Plots the plots of the values of the segments: a plot for the fields of
+// each unit, in the order of the columns, without the times and the sync
+func Plots(segments []datafile.Segment) []Plot {
+	var plots []Plot
+	var fields [][]string
+	units := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, segment := range segments {
+		for _, c := range segment.Header.Columns[datafile.FirstValue:] {
+			switch c.Name {
+			case "sensorTime", "trackerTime", "sync", "level":
+				continue
+			}
+			if seen[c.Name] {
+				continue
+			}
+			seen[c.Name] = true
+			i, ok := units[c.Unit]
+			if !ok {
+				i = len(plots)
+				units[c.Unit] = i
+				plots = append(plots, Plot{})
+				fields = append(fields, nil)
+			}
+			fields[i] = append(fields[i], c.Name)
+			plots[i].Title = strings.Join(fields[i], ", ")
+			if c.Unit != "" {
+				plots[i].Title += " (" + c.Unit + ")"
+			}
+			plots[i].Fields = strings.Join(fields[i], ",")
+		}
+	}
+	return plots
+}
+
+// Kinematics the kinematics of the last segment with the setup of the
+// photogates, nil if none has it
+func Kinematics(segments []datafile.Segment) *kinematics.Result {
+	for i := len(segments) - 1; i >= 0; i-- {
+		if result, ok := kinematics.Analyze(segments[i]); ok {
+			return result
+		}
+	}
+	return nil
+}
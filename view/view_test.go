@@ -0,0 +1,134 @@
+package view
+
+import (
+	"bytes"
+	"html/template"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecalman/OSHIWASP/catalog"
+	"github.com/ecalman/OSHIWASP/datafile"
+	"github.com/ecalman/OSHIWASP/kinematics"
+	"github.com/ecalman/OSHIWASP/record"
+	"github.com/ecalman/OSHIWASP/state"
+)
+
+// cartRun a run of the arduino, and of the trackers A and B crossed by the
+// cart at 0.5 m/s, with both edges and the default setup of the photogates
+func cartRun() datafile.Segment {
+	arduino := &record.Schema{}
+	arduino.Add(record.Field{Name: "sensorTime", Unit: "us", Kind: record.Int},
+		record.Field{Name: "sync", Kind: record.Int},
+		record.Field{Name: "distance", Unit: "mm", Kind: record.Int},
+		record.Field{Name: "accX", Unit: "g", Kind: record.Float},
+		record.Field{Name: "accY", Unit: "g", Kind: record.Float})
+	tracker := &record.Schema{}
+	tracker.Add(record.Field{Name: "level", Kind: record.Int})
+
+	h := datafile.NewHeader("cart", time.Date(2016, 10, 18, 5, 35, 0, 0, time.UTC))
+	h.Run = 3
+	h.AddSource("Ard", arduino)
+	h.AddSource("A", tracker)
+	h.AddSource("B", tracker)
+	h.Settings["trackerEdges"] = "both"
+	kinematics.DefaultSetup().Write(h.Settings)
+	nan := math.NaN()
+	ms := func(n int64) time.Duration { return time.Duration(n) * time.Millisecond }
+	edge := func(source string, t time.Duration, level float64) datafile.Row {
+		return datafile.Row{Source: source, Time: t, Values: []float64{nan, nan, nan, nan, nan, level}}
+	}
+	return datafile.Segment{Header: h, Rows: []datafile.Row{
+		{Source: "Ard", Time: ms(40), Values: []float64{286078321, 0, 95, -1.000891, 0.1, nan}},
+		edge("A", ms(1000), 1),
+		edge("A", ms(1100), 0),
+		edge("B", ms(1800), 1),
+		edge("B", ms(1900), 0),
+	}}
+}
+
+func TestNew(t *testing.T) {
+	v := New([]datafile.Segment{cartRun()})
+	plots := []Plot{{"distance (mm)", "distance"}, {"accX, accY (g)", "accX,accY"}}
+	if !reflect.DeepEqual(v.Plots, plots) {
+		t.Errorf("plots %+v, expected %+v", v.Plots, plots)
+	}
+	var events []string
+	for _, e := range v.Events {
+		events = append(events, e.Tracker+" "+e.Time.String()+" "+e.Interval.String()+" "+e.Period.String())
+	}
+	expected := "A 1s 0s 0s|A 1.1s 100ms 100ms|B 1.8s 700ms 0s|B 1.9s 100ms 100ms"
+	if strings.Join(events, "|") != expected {
+		t.Errorf("events %q, expected %q", strings.Join(events, "|"), expected)
+	}
+	if v.Kinematics == nil || len(v.Kinematics.Crossings) != 2 || len(v.Kinematics.Intervals) != 1 {
+		t.Fatalf("kinematics %+v, expected the crossings of A and B", v.Kinematics)
+	}
+	if speed := v.Kinematics.Intervals[0].Velocity.Value; math.Abs(speed-0.5) > 1e-9 {
+		t.Errorf("velocity %v between A and B, expected 0.5 m/s", speed)
+	}
+
+	// without the setup, as the runs of older versions
+	old := cartRun()
+	old.Header.Settings = map[string]string{}
+	if k := Kinematics([]datafile.Segment{cartRun(), old}); k == nil {
+		t.Error("no kinematics, expected the one of the first segment")
+	}
+	if k := Kinematics([]datafile.Segment{old}); k != nil {
+		t.Errorf("kinematics %+v without the setup", k)
+	}
+}
+
+// page the fields of the context of the server used by the viewer page
+type page struct {
+	Static            string
+	Lang              int
+	State             *state.Machine
+	ConfigurationName string
+	Title             string
+	Message           string
+	AlertLevel        int
+	Viewed            catalog.Entry
+	View              Run
+	Kinematics        *kinematics.Result
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := template.ParseFiles("../templates/base.html", "../templates/message.html",
+		"../templates/kinematics.html", "../templates/view.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New([]datafile.Segment{cartRun()})
+	p := page{Static: "/static/", State: state.NewMachine(state.Experiment, state.Stopped),
+		Title: "Viewer", Message: "The run", AlertLevel: 1,
+		Viewed: catalog.Entry{ID: "cart/3", Experiment: "cart", Run: 3, Records: 5, Tables: []string{"imu", "events"}},
+		View:   v, Kinematics: v.Kinematics}
+	for lang, title := range []string{"Kinematics of the photogates", "Cinemática de las fotopuertas"} {
+		p.Lang = lang
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, p); err != nil {
+			t.Fatal(err)
+		}
+		html := out.String()
+		for _, s := range []string{
+			`Viewer <small>cart #3</small>`,
+			`data-records="/export/cart/3/cart-3.jsonl"`,
+			`href="/export/cart/3/imu.csv"`,
+			`href="/export/cart/3/cart-3.zip"`,
+			`<h3 class="panel-title">accX, accY (g)</h3>`,
+			`data-fields="accX,accY"`,
+			title,
+			`<td>0.500 ± 0.010</td>`,
+			`<td>0.5000 ± 0.0013</td>`,
+			`<td>B</td>`,
+			`<td>0.700000</td>`,
+		} {
+			if !strings.Contains(html, s) {
+				t.Errorf("language %d: %q not in the page", lang, s)
+			}
+		}
+	}
+}